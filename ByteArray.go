@@ -1,6 +1,10 @@
 package gifencoder
 
-import "bytes"
+import (
+	"bytes"
+	"io"
+	"sync"
+)
 
 // ByteArray implements a growing byte buffer similar to the JavaScript version
 type ByteArray struct {
@@ -25,24 +29,88 @@ func NewByteArray() *ByteArray {
 
 func (ba *ByteArray) newPage() {
 	ba.page++
-	ba.pages = append(ba.pages, make([]byte, ba.pageSize))
+	if ba.page >= len(ba.pages) {
+		ba.pages = append(ba.pages, make([]byte, ba.pageSize))
+	}
+	ba.cursor = 0
+}
+
+// Reset empties the buffer but keeps its pages for reuse. Data previously
+// returned by GetPages is overwritten by later writes.
+func (ba *ByteArray) Reset() {
+	if len(ba.pages) == 0 {
+		ba.page = -1
+		ba.newPage()
+		return
+	}
+	ba.page = 0
 	ba.cursor = 0
 }
 
-// WriteByte writes a single byte to the buffer
-func (ba *ByteArray) WriteByte(val byte) {
+// byteArrayPool recycles output buffers between encodes
+var byteArrayPool = sync.Pool{
+	New: func() interface{} {
+		return NewByteArray()
+	},
+}
+
+// getByteArray borrows an empty buffer from the pool
+func getByteArray() *ByteArray {
+	ba := byteArrayPool.Get().(*ByteArray)
+	ba.Reset()
+	return ba
+}
+
+// putByteArray returns a buffer to the pool, it must not be used afterwards
+func putByteArray(ba *ByteArray) {
+	byteArrayPool.Put(ba)
+}
+
+// WriteByte writes a single byte to the buffer, it never fails
+func (ba *ByteArray) WriteByte(val byte) error {
 	if ba.cursor >= ba.pageSize {
 		ba.newPage()
 	}
 	ba.pages[ba.page][ba.cursor] = val
 	ba.cursor++
+	return nil
 }
 
 // WriteBytes writes a byte slice to the buffer
 func (ba *ByteArray) WriteBytes(data []byte) {
-	for _, b := range data {
-		ba.WriteByte(b)
+	ba.Write(data)
+}
+
+// Write implements io.Writer, filling the current page and starting new
+// ones as needed. It never fails.
+func (ba *ByteArray) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if ba.cursor >= ba.pageSize {
+			ba.newPage()
+		}
+		copied := copy(ba.pages[ba.page][ba.cursor:], p)
+		ba.cursor += copied
+		p = p[copied:]
 	}
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo, writing the complete pages and the used
+// part of the last one to w without copying them into a single slice
+func (ba *ByteArray) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for i, page := range ba.pages[:ba.page+1] {
+		if i == ba.page {
+			page = page[:ba.cursor]
+		}
+		n, err := w.Write(page)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
 }
 
 // WriteUTFBytes writes a string as UTF-8 bytes
@@ -52,11 +120,36 @@ func (ba *ByteArray) WriteUTFBytes(s string) {
 	}
 }
 
+// Len returns the number of bytes written so far
+func (ba *ByteArray) Len() int {
+	return ba.page*ba.pageSize + ba.cursor
+}
+
+// ReadFrom implements io.ReaderFrom, reading from r straight into the pages
+// until EOF. The returned error is nil at EOF.
+func (ba *ByteArray) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		if ba.cursor >= ba.pageSize {
+			ba.newPage()
+		}
+		n, err := r.Read(ba.pages[ba.page][ba.cursor:])
+		ba.cursor += n
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
 // GetData returns all written data as a single byte slice
 func (ba *ByteArray) GetData() []byte {
-	var buf bytes.Buffer
-	for i, page := range ba.pages {
-		if i < len(ba.pages)-1 {
+	buf := bytes.NewBuffer(make([]byte, 0, ba.Len()))
+	for i, page := range ba.pages[:ba.page+1] {
+		if i < ba.page {
 			buf.Write(page)
 		} else {
 			buf.Write(page[:ba.cursor])
@@ -65,9 +158,9 @@ func (ba *ByteArray) GetData() []byte {
 	return buf.Bytes()
 }
 
-// GetPages returns the internal pages for direct access
+// GetPages returns the internal pages in use for direct access
 func (ba *ByteArray) GetPages() [][]byte {
-	return ba.pages
+	return ba.pages[:ba.page+1]
 }
 
 // GetCursor returns the current cursor position
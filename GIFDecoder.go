@@ -0,0 +1,321 @@
+package gifencoder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// GIF block introducers and extension labels
+const (
+	gifExtension      = 0x21
+	gifImageSeparator = 0x2C
+	gifTrailer        = 0x3B
+
+	gifGraphicControl = 0xF9
+)
+
+// gifDecoder holds the state needed to read a GIF stream and composite its
+// frames onto a canvas
+type gifDecoder struct {
+	r *bufio.Reader
+
+	width, height int
+	globalPalette color.Palette
+
+	// graphic control of the next image
+	delay      int
+	disposal   int
+	transIndex int // -1 = no transparency
+
+	canvas *compositor
+	count  int                                        // frames decoded so far
+	emit   func(frame image.Image, delayMs int) error // receives each composited frame
+}
+
+// DecodeGIF decodes every frame of a GIF. Frames are composited onto the
+// logical screen following their disposal methods, so each returned image
+// is the full picture as a viewer would show it. Delays are in milliseconds.
+func DecodeGIF(data []byte) ([]image.Image, []int, error) {
+	return DecodeGIFReader(bytes.NewReader(data))
+}
+
+// DecodeGIFReader decodes every frame of a GIF read from r, see DecodeGIF
+func DecodeGIFReader(r io.Reader) ([]image.Image, []int, error) {
+	var frames []image.Image
+	var delays []int
+	err := DecodeGIFStream(r, func(frame image.Image, delayMs int) error {
+		frames = append(frames, frame)
+		delays = append(delays, delayMs)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return frames, delays, nil
+}
+
+// DecodeGIFStream decodes a GIF read from r and passes each frame to fn as
+// soon as it is parsed, composited as in DecodeGIF, with its delay in
+// milliseconds. Only the canvas and the current frame are kept in memory.
+// Decoding stops at the first error returned by fn, which is returned as is.
+func DecodeGIFStream(r io.Reader, fn func(frame image.Image, delayMs int) error) error {
+	d := &gifDecoder{r: bufio.NewReader(r), transIndex: -1, emit: fn}
+	return d.decode()
+}
+
+// errPosterFound stops DecodeGIFStream once PosterFrame has its frame
+var errPosterFound = errors.New("poster frame found")
+
+// PosterFrame decodes the frame at index of a GIF, composited with the
+// frames before it as in DecodeGIF, for use as a still preview. The image
+// is an *image.RGBA the size of the logical screen. Index -1 selects the
+// last frame. Frames after the requested one are not decoded.
+func PosterFrame(gifData []byte, index int) (image.Image, error) {
+	if index < -1 {
+		return nil, fmt.Errorf("invalid frame index %d", index)
+	}
+
+	var poster image.Image
+	count := 0
+	err := DecodeGIFStream(bytes.NewReader(gifData), func(frame image.Image, delayMs int) error {
+		poster = frame
+		count++
+		if count-1 == index {
+			return errPosterFound
+		}
+		return nil
+	})
+	if err != nil && err != errPosterFound {
+		return nil, err
+	}
+	if index >= count {
+		return nil, fmt.Errorf("frame index %d out of range, the GIF has %d frames", index, count)
+	}
+	return poster, nil
+}
+
+func (d *gifDecoder) decode() error {
+	if err := d.readHeaderAndScreen(); err != nil {
+		return err
+	}
+
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("gif: reading block: %w", unexpectedEOF(err))
+		}
+		switch b {
+		case gifExtension:
+			if err := d.readExtension(); err != nil {
+				return err
+			}
+		case gifImageSeparator:
+			if err := d.readImage(); err != nil {
+				return err
+			}
+		case gifTrailer:
+			if d.count == 0 {
+				return errors.New("gif: no image found")
+			}
+			return nil
+		default:
+			return fmt.Errorf("gif: unknown block type 0x%02x", b)
+		}
+	}
+}
+
+// readHeaderAndScreen reads the signature, the logical screen descriptor
+// and the global color table
+func (d *gifDecoder) readHeaderAndScreen() error {
+	var buf [13]byte
+	if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+		return fmt.Errorf("gif: reading header: %w", unexpectedEOF(err))
+	}
+	if sig := string(buf[:6]); sig != "GIF87a" && sig != "GIF89a" {
+		return fmt.Errorf("gif: invalid signature %q", sig)
+	}
+
+	d.width = int(buf[6]) | int(buf[7])<<8
+	d.height = int(buf[8]) | int(buf[9])<<8
+	d.canvas = newCompositor(image.Rect(0, 0, d.width, d.height))
+
+	if flags := buf[10]; flags&0x80 != 0 {
+		palette, err := d.readColorTable(flags)
+		if err != nil {
+			return err
+		}
+		d.globalPalette = palette
+	}
+	return nil
+}
+
+// readColorTable reads a color table whose size is encoded in flags
+func (d *gifDecoder) readColorTable(flags byte) (color.Palette, error) {
+	n := 1 << (flags&0x07 + 1)
+	raw := make([]byte, 3*n)
+	if _, err := io.ReadFull(d.r, raw); err != nil {
+		return nil, fmt.Errorf("gif: reading color table: %w", unexpectedEOF(err))
+	}
+	palette := make(color.Palette, n)
+	for i := range palette {
+		palette[i] = color.RGBA{raw[i*3], raw[i*3+1], raw[i*3+2], 0xFF}
+	}
+	return palette, nil
+}
+
+// readExtension reads a graphic control extension and skips all others
+func (d *gifDecoder) readExtension() error {
+	label, err := d.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("gif: reading extension: %w", unexpectedEOF(err))
+	}
+
+	if label == gifGraphicControl {
+		var buf [6]byte
+		if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+			return fmt.Errorf("gif: reading graphic control: %w", unexpectedEOF(err))
+		}
+		if buf[0] != 4 {
+			return fmt.Errorf("gif: invalid graphic control block size %d", buf[0])
+		}
+		flags := buf[1]
+		d.disposal = int(flags>>2) & 0x07
+		d.delay = int(buf[2]) | int(buf[3])<<8
+		d.transIndex = -1
+		if flags&0x01 != 0 {
+			d.transIndex = int(buf[4])
+		}
+		if buf[5] != 0 {
+			return errors.New("gif: missing graphic control block terminator")
+		}
+		return nil
+	}
+
+	_, err = d.readSubBlocks()
+	return err
+}
+
+// readSubBlocks reads data sub-blocks up to the block terminator and
+// returns their joined content
+func (d *gifDecoder) readSubBlocks() ([]byte, error) {
+	var data []byte
+	for {
+		n, err := d.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("gif: reading sub-block: %w", unexpectedEOF(err))
+		}
+		if n == 0 {
+			return data, nil
+		}
+		start := len(data)
+		data = append(data, make([]byte, n)...)
+		if _, err := io.ReadFull(d.r, data[start:]); err != nil {
+			return nil, fmt.Errorf("gif: reading sub-block: %w", unexpectedEOF(err))
+		}
+	}
+}
+
+// readImage reads an image descriptor and its pixels, then composites the
+// frame onto the canvas
+func (d *gifDecoder) readImage() error {
+	var buf [9]byte
+	if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+		return fmt.Errorf("gif: reading image descriptor: %w", unexpectedEOF(err))
+	}
+	left := int(buf[0]) | int(buf[1])<<8
+	top := int(buf[2]) | int(buf[3])<<8
+	w := int(buf[4]) | int(buf[5])<<8
+	h := int(buf[6]) | int(buf[7])<<8
+	flags := buf[8]
+
+	palette := d.globalPalette
+	if flags&0x80 != 0 {
+		local, err := d.readColorTable(flags)
+		if err != nil {
+			return err
+		}
+		palette = local
+	}
+	if palette == nil {
+		return errors.New("gif: no color table")
+	}
+
+	minCodeSize, err := d.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("gif: reading image data: %w", unexpectedEOF(err))
+	}
+	data, err := d.readSubBlocks()
+	if err != nil {
+		return err
+	}
+	pixels, err := NewLZWDecoder(int(minCodeSize)).Decode(data, w*h)
+	if err != nil {
+		return fmt.Errorf("gif: frame %d: %w", d.count, err)
+	}
+	if flags&0x40 != 0 {
+		pixels = deinterlace(pixels, w, h)
+	}
+
+	// transparent pixels let the canvas show through
+	if d.transIndex >= 0 {
+		n := len(palette)
+		if d.transIndex >= n {
+			n = d.transIndex + 1
+		}
+		transparent := make(color.Palette, n)
+		for i := range transparent {
+			transparent[i] = color.RGBA{}
+		}
+		copy(transparent, palette)
+		transparent[d.transIndex] = color.RGBA{}
+		palette = transparent
+	}
+	for _, index := range pixels {
+		if int(index) >= len(palette) {
+			return fmt.Errorf("gif: frame %d: color index %d out of range", d.count, index)
+		}
+	}
+	frame := &image.Paletted{
+		Pix:     pixels,
+		Stride:  w,
+		Rect:    image.Rect(left, top, left+w, top+h),
+		Palette: palette,
+	}
+
+	shown := d.canvas.add(frame, d.disposal)
+	delay := d.delay * 10
+	d.count++
+
+	// a graphic control extension only applies to the image that follows it
+	d.delay = 0
+	d.disposal = 0
+	d.transIndex = -1
+	return d.emit(shown, delay)
+}
+
+// deinterlace reorders the rows of an interlaced image
+func deinterlace(pixels []byte, w, h int) []byte {
+	out := make([]byte, len(pixels))
+	row := 0
+	for _, pass := range [][2]int{{0, 8}, {4, 8}, {2, 4}, {1, 2}} {
+		for y := pass[0]; y < h; y += pass[1] {
+			copy(out[y*w:(y+1)*w], pixels[row*w:(row+1)*w])
+			row++
+		}
+	}
+	return out
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, a GIF always ends
+// with a trailer
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -1,10 +1,21 @@
 package gifencoder
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strings"
 )
 
+// fillColor is the channel value used for canvas cells not covered by a frame
+const fillColor = 0
+
 // GIFEncoder encodes images into GIF format
 type GIFEncoder struct {
 	// image size
@@ -17,85 +28,491 @@ type GIFEncoder struct {
 	// transparent index in color table
 	transIndex int
 
+	// transparent index set by SetTransparentIndex, -1 = none
+	fixedTransIndex int
+
+	// transparent index matched against the global palette, -1 = not yet
+	globalTransIndex int
+
 	// -1 = no repeat, 0 = forever. anything else is repeat count
 	repeat int
 
+	// background color index written in the logical screen descriptor
+	backgroundIndex int
+
+	// pixel aspect ratio byte, 0 = no aspect ratio information
+	aspectRatio byte
+
 	// frame delay (hundredths)
 	delay int
 
-	image           image.Image // current frame
-	pixels          []byte      // RGB byte array from frame
-	indexedPixels   []byte      // converted frame indexed to palette
-	colorDepth      int         // number of bit planes
-	colorTab        []byte      // RGB palette
-	neuQuant        *NeuQuant   // NeuQuant instance that was used to generate colorTab
-	usedEntry       []bool      // active palette entries
-	palSize         int         // color table size (bits-1)
-	dispose         int         // disposal code (-1 = use default)
-	firstFrame      bool
-	sample          int          // default sample interval for quantizer
-	ditherMethod    DitherMethod // dithering method
-	serpentine      bool         // serpentine scanning for dithering
-	saturationBoost float64      // 饱和度增强
-	contrastBoost   float64      // 对比度增强
-	globalPalette   []byte
+	// per-frame delays in milliseconds from SetDelays, starting at frame delaysStart
+	delays      []int
+	delaysStart int
+
+	// smallest delay written for any frame (hundredths), 0 = no limit
+	minDelay int
+
+	// smallest delay SetFrameRate may choose (hundredths)
+	frameRateMinDelay int
+
+	// receives the indices and color table of each frame before it is written
+	indexSink func(indices, colorTab []byte)
+
+	image            image.Image      // current frame
+	pixels           []byte           // RGB byte array from frame
+	pixelBuf         []byte           // backing store of pixels, reused across frames
+	framesWritten    int              // number of frames written so far
+	progress         ProgressFunc     // called after each frame is written
+	progressTotal    int              // total frames reported to progress, 0 = unknown
+	frameStats       FrameStatsFunc   // called with the statistics of each written frame
+	lastStats        FrameStats       // statistics of the last written frame
+	resizeMode       ResizeMode       // scaling of frames of a different size
+	letterbox        bool             // keep the aspect ratio when scaling
+	indexedPixels    []byte           // converted frame indexed to palette
+	colorDepth       int              // number of bit planes
+	colorTab         []byte           // RGB palette
+	quantizer        Quantizer        // quantizer instance that was used to generate colorTab
+	quantizerMethod  QuantizerMethod  // color quantization algorithm
+	quantizerFactory QuantizerFactory // builds a quantizer per frame, overrides quantizerMethod
+	maxColors        int              // palette size limit of built quantizers, 0 = 256
+	forceColors      []color.RGBA     // exact colors put into built palettes
+	adaptivePalette  bool             // exact palettes for frames with few colors
+	customQuantizer  Quantizer        // user quantizer shared by all frames
+	customBuilt      bool             // whether customQuantizer's colormap has been built
+	usedEntry        []bool           // active palette entries
+	palSize          int              // color table size (bits-1)
+	dispose          int              // disposal code (-1 = use default)
+	firstFrame       bool
+	sample           int                              // default sample interval for quantizer
+	autoQuality      bool                             // pick the sample interval from the frame size
+	ditherMethod     DitherMethod                     // dithering method
+	serpentine       bool                             // serpentine scanning for dithering
+	ditherStrength   float64                          // error diffusion factor 0..1
+	ditherKernels    map[DitherMethod]DitheringKernel // user registered kernels
+	saturationBoost  float64                          // 饱和度增强
+	contrastBoost    float64                          // 对比度增强
+	hueShift         float64                          // 色相旋转（度）
+	brightness       float64                          // 亮度系数, 1.0为原始
+	posterize        []byte                           // per-channel level map, nil = off
+	gammaTable       []byte                           // per-channel gamma curve, nil = off
+	globalPalette    []byte
+	globalQuantizer  Quantizer       // quantizer that built globalPalette, if any
+	grayscale        int             // number of gray levels, 0 = color output
+	monochrome       *MonoOptions    // black and white output settings, nil = color output
+	optimize         bool            // inter-frame transparency optimization
+	prevPixels       []byte          // RGB byte array of the previous frame
+	unchanged        []bool          // pixels equal to the previous frame
+	frameRect        image.Rectangle // area of the canvas covered by the current frame
+	frameOffset      image.Point     // position of a sub-frame added with AddFrameAt
+	screen           image.Point     // logical screen size while a sub-frame is encoded
+	frameTransIndex  *int            // transparent index override for the current frame
+	lastColorTab     []byte          // color table of the last written frame
+	dedupPalettes    bool            // skip local tables equal to the global one
+	gctTab           []byte          // global color table written with the first frame
+	deferClear       bool            // defer LZW table clears, see LZWEncoder.SetDeferredClear
+	minimalExt       bool            // leave out graphic control extensions holding only defaults
+	xmp              string          // XMP packet written after the header, "" = none
+	version87a       bool            // write GIF87a without any extension blocks
+	lastTransIndex   int             // transparent index of the last written frame, -1 if none
+	lastUsedColors   int             // palette entries referenced by the last written frame
+	sharedFrames     int             // frames sampled for the shared palette, 0 = off
+	pending          []pendingFrame  // frames held until the shared palette is trained
+	heldFirst        image.Image     // first frame from NewGIFEncoderFromImage, written with the next frame
+	sharedTrained    bool            // globalPalette was trained for the shared palette
+	tree             *kdTree         // nearest-color index over treePalette
+	lookupCache      *lookupCache    // nearest-color results of the current frame
+	treePalette      []byte          // color table the tree was built for
+	perceptual       bool            // match colors by Lab distance instead of RGB
+	linearLight      bool            // diffuse dithering error in linear light
+	sortPalette      bool            // order adaptive color tables by frequency
+	tableSorted      bool            // the current frame's color table is sorted
+	reserveTrans     bool            // keep a palette slot for the transparent color alone
+	transMask        []bool          // pixels of the current frame written as transparent
+	matte            color.RGBA      // color translucent pixels are composited over
+	alphaThreshold   int             // pixels with a lower 8-bit alpha are transparent, 0 = off
+	labColors        []labColor      // labTab converted to Lab
+	labTab           []byte          // color table labColors was built for
 
 	out *ByteArray
 }
 
-// NewGIFEncoder creates a new GIF encoder
+// NewGIFEncoder creates a new GIF encoder. The size must be 1-65535 pixels
+// in each direction, AddFrame fails otherwise.
 func NewGIFEncoder(width, height int) *GIFEncoder {
 	return &GIFEncoder{
-		width:           width,
-		height:          height,
-		repeat:          -1,
-		delay:           0,
-		dispose:         -1,
-		firstFrame:      true,
-		sample:          10,
-		ditherMethod:    DitherNone,
-		serpentine:      false,
-		palSize:         7,
-		saturationBoost: 1.0,
-		contrastBoost:   1.0,
-		out:             NewByteArray(),
-		usedEntry:       make([]bool, 256),
+		width:             width,
+		height:            height,
+		repeat:            -1,
+		delay:             0,
+		frameRateMinDelay: defaultFrameRateMinDelay,
+		fixedTransIndex:   -1,
+		globalTransIndex:  -1,
+		dispose:           -1,
+		firstFrame:        true,
+		sample:            10,
+		ditherMethod:      DitherNone,
+		quantizerMethod:   QuantizerNeuQuant,
+		serpentine:        false,
+		ditherStrength:    1.0,
+		palSize:           7,
+		saturationBoost:   1.0,
+		contrastBoost:     1.0,
+		brightness:        1.0,
+		out:               getByteArray(),
+		usedEntry:         make([]bool, 256),
+		lastTransIndex:    -1,
+	}
+}
+
+// NewGIFEncoderFromImage creates a GIF encoder the size of img with img as
+// the first frame. The frame is held until the next frame is added or
+// Finish is called, so settings made in between, such as SetRepeat,
+// SetDelay or SetDither, apply to it and to the stream header.
+func NewGIFEncoderFromImage(img image.Image) (*GIFEncoder, error) {
+	bounds := img.Bounds()
+	ge := NewGIFEncoder(bounds.Dx(), bounds.Dy())
+	if ge.width <= 0 || ge.height <= 0 || ge.width > 0xffff || ge.height > 0xffff {
+		ge.CleanupAll()
+		return nil, fmt.Errorf("invalid frame size %dx%d, width and height must be 1-65535", ge.width, ge.height)
+	}
+	ge.heldFirst = img
+	return ge, nil
+}
+
+// writeHeldFirst writes the frame held by NewGIFEncoderFromImage with the
+// settings in effect now
+func (ge *GIFEncoder) writeHeldFirst(ctx context.Context) error {
+	if ge.heldFirst == nil {
+		return nil
 	}
+	img := ge.heldFirst
+	ge.heldFirst = nil
+	return ge.AddFrameContext(ctx, img)
 }
 
 // SetDelay sets the delay time between each frame, or changes it for subsequent frames
+// It replaces delays set with SetDelays. GIF stores delays in whole
+// centiseconds, so milliseconds are rounded to the nearest one: 95ms is
+// written as 10cs (100ms). Use SetDelayCentiseconds to give the stored
+// value directly.
 func (ge *GIFEncoder) SetDelay(milliseconds int) {
-	ge.delay = milliseconds / 10
+	ge.delay = msToCentiseconds(milliseconds)
+	ge.delays = nil
+}
+
+// SetDelayCentiseconds sets the delay of subsequent frames in
+// centiseconds, the unit GIF stores, so the value is written exactly.
+// Negative delays are raised to 0 and longer ones than 65535 are clamped.
+// It replaces delays set with SetDelays.
+func (ge *GIFEncoder) SetDelayCentiseconds(centiseconds int) {
+	switch {
+	case centiseconds < 0:
+		centiseconds = 0
+	case centiseconds > 0xffff:
+		centiseconds = 0xffff
+	}
+	ge.delay = centiseconds
+	ge.delays = nil
+}
+
+// msToCentiseconds converts a delay in milliseconds to the nearest whole
+// centisecond
+func msToCentiseconds(milliseconds int) int {
+	return (milliseconds + 5) / 10
+}
+
+// SetDelays sets the delays in milliseconds of the frames added next, the
+// first AddFrame call takes delays[0], the second delays[1] and so on.
+// Frames past the end of delays keep its last value. Reset starts over
+// from delays[0]. SetDelay or an empty slice turns it off.
+func (ge *GIFEncoder) SetDelays(delays []int) {
+	ge.delays = nil
+	if len(delays) > 0 {
+		ge.delays = append([]int(nil), delays...)
+	}
+	ge.delaysStart = ge.FrameCount()
+}
+
+// applyDelays picks the delay of the next frame from SetDelays. It only
+// depends on the frame's index, so frames replayed by the shared palette
+// get the same delay again.
+func (ge *GIFEncoder) applyDelays() {
+	if ge.delays == nil {
+		return
+	}
+	i := ge.FrameCount() - ge.delaysStart
+	if i < 0 {
+		return
+	}
+	if i >= len(ge.delays) {
+		i = len(ge.delays) - 1
+	}
+	ge.delay = msToCentiseconds(ge.delays[i])
 }
 
-// SetFrameRate sets frame rate in frames per second
+// defaultFrameRateMinDelay is the smallest delay SetFrameRate produces, most
+// viewers play faster frames at a much slower fallback speed
+const defaultFrameRateMinDelay = 2
+
+// SetFrameRate sets frame rate in frames per second. GIF delays are whole
+// centiseconds, so the delay is rounded to the nearest one and rates above
+// 50 fps can't be represented exactly: 30 fps plays at 33.3 fps (3cs) and
+// 60 fps is clamped to the 2cs (50 fps) minimum, see SetFrameRateMinDelay.
 func (ge *GIFEncoder) SetFrameRate(fps int) {
-	ge.delay = 100 / fps
+	if fps <= 0 {
+		return
+	}
+	ge.delay = (100 + fps/2) / fps
+	if ge.delay < ge.frameRateMinDelay {
+		ge.delay = ge.frameRateMinDelay
+	}
+}
+
+// SetMinDelay raises every frame delay below centiseconds to centiseconds
+// when it is written, whether it came from SetDelay, SetFrameRate or
+// AddFrameWithOptions. Most browsers play delays of 0 or 1 centisecond at
+// 10 centiseconds instead, so a GIF authored that fast plays slower and
+// differently from viewer to viewer; a minimum of 2 avoids that. 0, the
+// default, writes delays unchanged.
+func (ge *GIFEncoder) SetMinDelay(centiseconds int) {
+	if centiseconds < 0 {
+		centiseconds = 0
+	}
+	ge.minDelay = centiseconds
 }
 
-// SetDispose sets the GIF frame disposal code
-func (ge *GIFEncoder) SetDispose(disposalCode int) {
-	if disposalCode >= 0 {
-		ge.dispose = disposalCode
+// SetFrameRateMinDelay changes the smallest delay in centiseconds that
+// SetFrameRate may choose, default 2. Use 1 to allow 100 fps, or 0 to allow
+// a delay of 0 which many viewers play as fast as possible.
+func (ge *GIFEncoder) SetFrameRateMinDelay(centiseconds int) {
+	if centiseconds >= 0 {
+		ge.frameRateMinDelay = centiseconds
 	}
 }
 
-// SetRepeat sets the number of times the set of GIF frames should be played
+// Disposal methods telling the viewer what to do with a frame's area
+// before the next frame is drawn
+const (
+	DisposalNone              = 0 // unspecified, viewers usually keep the frame
+	DisposalKeep              = 1 // leave the frame in place
+	DisposalRestoreBackground = 2 // clear the frame's area to the background
+	DisposalRestorePrevious   = 3 // restore the area to what it was before the frame
+)
+
+// SetDispose sets the GIF frame disposal code (DisposalNone to
+// DisposalRestorePrevious), or -1 to go back to the default which picks
+// DisposalRestoreBackground for transparent frames and DisposalNone otherwise
+func (ge *GIFEncoder) SetDispose(disposalCode int) error {
+	if disposalCode < -1 || disposalCode > DisposalRestorePrevious {
+		return fmt.Errorf("invalid disposal code %d, expected 0-3", disposalCode)
+	}
+	ge.dispose = disposalCode
+	return nil
+}
+
+// SetRepeat sets the loop count written to the Netscape extension, the
+// number of times the animation repeats after it is first played: 0 loops
+// forever and 1 plays it twice in browsers. A positive count is capped at
+// 65535, the largest value the extension can hold. Any negative value
+// leaves the extension out, which plays once in viewers that honor its
+// absence, see SetPlayOnce for an explicit marker.
 func (ge *GIFEncoder) SetRepeat(repeat int) {
+	switch {
+	case repeat < 0:
+		repeat = -1
+	case repeat > 0xffff:
+		repeat = 0xffff
+	}
 	ge.repeat = repeat
 }
 
+// SetLoopCount sets the loop count written to the Netscape extension: 0
+// loops forever and n >= 1 writes n, which browsers take as n repetitions
+// after the first play. Counts above 65535 are clamped to the 16-bit field.
+// Negative counts are rejected, use SetPlayOnce or SetRepeat(-1) to play a
+// single time.
+func (ge *GIFEncoder) SetLoopCount(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid loop count %d, expected 0 (forever) or more", n)
+	}
+	ge.SetRepeat(n)
+	return nil
+}
+
+// SetPlayOnce writes an explicit play-once marker: the Netscape extension
+// with a loop count of 1, which the original Netscape semantics read as a
+// single play in total. Some players default to looping forever when the
+// extension is absent, this keeps them from it. Players that take the
+// count as repetitions after the first play, as image/gif does with its
+// LoopCount of 1, show the animation twice; SetRepeat(-1) leaves the
+// extension out for those.
+func (ge *GIFEncoder) SetPlayOnce() {
+	ge.repeat = 1
+}
+
+// SetDedupPalettes makes frames whose color table equals the global color
+// table, written with the first frame, use it instead of repeating the same
+// table as a local one. It has no effect while a global palette is set
+// since no local tables are written then.
+func (ge *GIFEncoder) SetDedupPalettes(dedup bool) {
+	ge.dedupPalettes = dedup
+}
+
+// SetDeferredClear keeps the LZW code table once it is full instead of
+// clearing it right away, see LZWEncoder.SetDeferredClear. Off by default.
+func (ge *GIFEncoder) SetDeferredClear(deferClear bool) {
+	ge.deferClear = deferClear
+}
+
+// SetMinimalExtensions leaves out the graphic control extension of frames
+// that have no delay, no transparency and the default disposal, since such
+// an extension holds nothing a viewer would not assume anyway. A single
+// static frame then becomes a plain image as in GIF87a. Frames of an
+// animation keep their extension as long as they carry a delay.
+func (ge *GIFEncoder) SetMinimalExtensions(minimal bool) {
+	ge.minimalExt = minimal
+}
+
+// SetVersion87a writes a GIF87a stream for very old or embedded decoders
+// that don't know GIF89a. GIF87a has no extension blocks, so everything they
+// carry is lost: there is no transparency, transparent pixels show the color
+// of their palette entry, no delays or disposal, no loop count and no XMP
+// metadata. The sort flags and the aspect ratio are not written either.
+// Frames after the first are drawn over it at once, so for a still image
+// add a single frame.
+func (ge *GIFEncoder) SetVersion87a(enable bool) {
+	ge.version87a = enable
+}
+
 // SetTransparent sets the transparent color
 func (ge *GIFEncoder) SetTransparent(c *color.RGBA) {
 	ge.transparent = c
+	ge.globalTransIndex = -1
+}
+
+// SetTransparentIndex marks the given palette index (0-255) transparent in
+// every frame, bypassing the nearest-color match of SetTransparent. The
+// color table is then written whole so the index keeps its meaning.
+// Pass -1 to disable it.
+func (ge *GIFEncoder) SetTransparentIndex(index int) {
+	if index > 255 {
+		index = 255
+	}
+	if index < 0 {
+		index = -1
+	}
+	ge.fixedTransIndex = index
+}
+
+// SetBackgroundIndex sets the background color index written in the
+// logical screen descriptor, shown by frames with disposal 2 (restore to
+// background) in viewers that honor it. The index must fall inside the
+// global palette if one is set.
+func (ge *GIFEncoder) SetBackgroundIndex(index int) error {
+	size := 256
+	if ge.globalPalette != nil {
+		size = len(ge.globalPalette) / 3
+	}
+	if index < 0 || index >= size {
+		return fmt.Errorf("background index %d out of range [0, %d)", index, size)
+	}
+	ge.backgroundIndex = index
+	return nil
+}
+
+// SetBackgroundColor sets the background color index to the global palette
+// entry closest to c. It needs a global palette.
+func (ge *GIFEncoder) SetBackgroundColor(c color.RGBA) error {
+	if ge.globalPalette == nil {
+		return errors.New("background color needs a global palette")
+	}
+
+	ge.backgroundIndex = closestInPalette(ge.globalPalette, c.R, c.G, c.B)
+	return nil
+}
+
+// SetAspectRatio sets the pixel aspect ratio (pixel width / height) stored
+// in the logical screen descriptor as (ratio*64)-15, which covers ratios
+// from 1:4 to 4:1 in steps of 1/64. A ratio of 1 or less than or equal
+// to 0 writes no aspect ratio information.
+func (ge *GIFEncoder) SetAspectRatio(ratio float64) {
+	if ratio <= 0 || ratio == 1 {
+		ge.aspectRatio = 0
+		return
+	}
+	ge.aspectRatio = clamp(int(math.Round(ratio*64 - 15)))
+	if ge.aspectRatio == 0 {
+		ge.aspectRatio = 1
+	}
 }
 
-// SetQuality sets quality of color quantization (1-30, lower is better)
+// hasTransparency reports whether every frame has a transparent index
+func (ge *GIFEncoder) hasTransparency() bool {
+	return ge.transparent != nil || ge.fixedTransIndex >= 0 || ge.alphaThreshold > 0
+}
+
+// resolveTransIndex picks the palette entry written as transparent. With a
+// global palette the index matched for the first frame is reused, so all
+// frames mark the same entry transparent.
+func (ge *GIFEncoder) resolveTransIndex() {
+	switch {
+	case ge.fixedTransIndex >= 0:
+		ge.transIndex = ge.fixedTransIndex
+	case ge.transparent == nil, ge.usesTransMask():
+		return
+	case ge.globalPalette != nil && ge.globalTransIndex >= 0:
+		ge.transIndex = ge.globalTransIndex
+	default:
+		ge.transIndex = ge.findClosest(*ge.transparent, true)
+		if ge.globalPalette != nil {
+			ge.globalTransIndex = ge.transIndex
+		}
+	}
+	ge.usedEntry[ge.transIndex] = true
+}
+
+// SetQuality sets quality of color quantization (1-30, lower is better).
+// It is the interval at which NeuQuant samples pixels: 1 looks at every
+// pixel and gives the best palette, 30 is the fastest. Values outside the
+// range are clamped. It turns SetAutoQuality off.
 func (ge *GIFEncoder) SetQuality(quality int) {
 	if quality < 1 {
 		quality = 1
 	}
+	// NeuQuant 的 alphadec 在 samplefac > 30 时失去意义
+	if quality > 30 {
+		quality = 30
+	}
 	ge.sample = quality
+	ge.autoQuality = false
+}
+
+// autoSampleBudget is the number of pixels SetAutoQuality lets NeuQuant
+// sample per frame
+const autoSampleBudget = 1 << 16
+
+// SetAutoQuality picks the quantizer sample interval from each frame's
+// pixel count instead of SetQuality: frames up to 65536 pixels are fully
+// sampled, larger ones are sampled coarser so training time stays bounded,
+// up to the coarsest interval of 30. Calling SetQuality turns it off.
+func (ge *GIFEncoder) SetAutoQuality(auto bool) {
+	ge.autoQuality = auto
+}
+
+// sampleFactor returns the quantizer sample interval for nPix pixels
+func (ge *GIFEncoder) sampleFactor(nPix int) int {
+	if !ge.autoQuality {
+		return ge.sample
+	}
+	sample := (nPix + autoSampleBudget - 1) / autoSampleBudget
+	if sample < 1 {
+		sample = 1
+	}
+	if sample > 30 {
+		sample = 30
+	}
+	return sample
 }
 
 // SetDither sets dithering method. Available methods:
@@ -104,7 +521,14 @@ func (ge *GIFEncoder) SetQuality(quality int) {
 // - "FalseFloydSteinberg": False Floyd-Steinberg dithering
 // - "Stucki": Stucki dithering
 // - "Atkinson": Atkinson dithering
-// Add "-serpentine" suffix to use serpentine scanning (e.g., "FloydSteinberg-serpentine")
+// - "SierraTwoRow", "SierraLite": lighter kernels, faster but slightly noisier than Stucki
+// - "Ordered2x2", "Ordered4x4", "Ordered8x8": Bayer ordered dithering, stable across animation frames
+// - "BlueNoise": ordered dithering with a 64x64 blue-noise mask, as stable but without a visible pattern
+// Add "-serpentine" suffix to use serpentine scanning (e.g., "FloydSteinberg-serpentine"),
+// "-serpentine" alone selects serpentine Floyd-Steinberg.
+// Names are matched ignoring case, spaces, '-' and '_', and the aliases "fs"
+// and "false-fs" are accepted, so "floyd-steinberg" selects FloydSteinberg.
+// Names of kernels added with SetDitherKernel must match exactly.
 func (ge *GIFEncoder) SetDither(method interface{}) {
 	ge.serpentine = false
 
@@ -116,46 +540,268 @@ func (ge *GIFEncoder) SetDither(method interface{}) {
 			ge.ditherMethod = DitherNone
 		}
 	case string:
-		// 检查是否有 serpentine 后缀
-		if len(v) > 11 && v[len(v)-11:] == "-serpentine" {
-			ge.serpentine = true
-			v = v[:len(v)-11]
-		}
-
-		switch v {
-		case "FloydSteinberg":
-			ge.ditherMethod = DitherFloydSteinberg
-		case "FalseFloydSteinberg":
-			ge.ditherMethod = DitherFalseFloydSteinberg
-		case "Stucki":
-			ge.ditherMethod = DitherStucki
-		case "Atkinson":
-			ge.ditherMethod = DitherAtkinson
-		case "none", "":
-			ge.ditherMethod = DitherNone
-		default:
+		v = strings.TrimSpace(v)
+		v, ge.serpentine = cutSerpentine(v)
+
+		// 自定义抖动核心区分大小写
+		if _, ok := ge.ditherKernels[DitherMethod(v)]; ok {
+			ge.ditherMethod = DitherMethod(v)
+		} else if m, ok := parseDitherName(v); ok {
+			ge.ditherMethod = m
+		} else {
 			ge.ditherMethod = DitherNone
 		}
 	case DitherMethod:
 		ge.ditherMethod = v
+		if _, ok := ge.ditherKernels[v]; !ok && !isBuiltinDither(v) {
+			ge.ditherMethod = DitherNone
+		}
 	default:
 		ge.ditherMethod = DitherNone
 	}
 }
 
+// SetDitherKernel registers a custom error diffusion kernel under name and
+// selects it. Each kernel row is [weight, dx, dy] where weight > 0 and
+// (dx, dy) points to a pixel not yet visited in scan order.
+func (ge *GIFEncoder) SetDitherKernel(name string, kernel DitheringKernel) error {
+	method := DitherMethod(name)
+	if name == "" || method == DitherNone || isBuiltinDither(method) {
+		return fmt.Errorf("dither kernel name %q is reserved", name)
+	}
+	if err := kernel.validate(); err != nil {
+		return err
+	}
+
+	if ge.ditherKernels == nil {
+		ge.ditherKernels = make(map[DitherMethod]DitheringKernel)
+	}
+	ge.ditherKernels[method] = kernel
+	ge.ditherMethod = method
+	return nil
+}
+
+// SetDitherStrength scales the error diffused to neighbouring pixels.
+// 0 behaves like no dithering, 1 (default) diffuses the full error.
+// Values outside [0,1] are clamped.
+func (ge *GIFEncoder) SetDitherStrength(strength float64) {
+	ge.ditherStrength = minFloat(1.0, maxFloat(0.0, strength))
+}
+
+// SetQuantizerMethod sets the color quantization algorithm:
+// - QuantizerNeuQuant: neural-net quantizer, best for photographic frames (default)
+// - QuantizerMedianCut: median cut, exact for frames with at most 256 colors
+// - QuantizerOctree: octree color reduction, exact for frames with at most 256 colors
+// - QuantizerPopularity: most populated cells of a color histogram, fastest, for previews
+// - QuantizerWebSafe: fixed 216-color web-safe global palette, no per-frame quantization
+func (ge *GIFEncoder) SetQuantizerMethod(method QuantizerMethod) {
+	ge.clearFixedPalette()
+
+	switch method {
+	case QuantizerMedianCut, QuantizerOctree, QuantizerPopularity:
+		ge.quantizerMethod = method
+	case QuantizerWebSafe:
+		ge.quantizerMethod = method
+		ge.setFixedPalette(webSafeQuantizer{})
+	default:
+		ge.quantizerMethod = QuantizerNeuQuant
+	}
+}
+
+// setFixedPalette installs q's colormap as global palette and uses q for
+// every pixel lookup
+func (ge *GIFEncoder) setFixedPalette(q Quantizer) {
+	ge.SetGlobalPalette(q.GetColormap())
+	ge.globalQuantizer = q
+}
+
+// clearFixedPalette leaves the web-safe, grayscale or monochrome mode and
+// drops the global palette it installed
+func (ge *GIFEncoder) clearFixedPalette() {
+	if ge.quantizerMethod == QuantizerWebSafe || ge.grayscale > 0 || ge.monochrome != nil {
+		ge.SetGlobalPalette(nil)
+	}
+	if ge.quantizerMethod == QuantizerWebSafe {
+		ge.quantizerMethod = QuantizerNeuQuant
+	}
+	ge.grayscale = 0
+	ge.monochrome = nil
+}
+
+// SetQuantizer sets a quantizer shared by all frames. Its colormap is built
+// once, before the first frame is indexed. Pass nil to restore the default.
+func (ge *GIFEncoder) SetQuantizer(q Quantizer) {
+	ge.customQuantizer = q
+	ge.customBuilt = false
+}
+
+// SetQuantizerFactory sets a factory that creates a new quantizer for every
+// frame. It takes precedence over SetQuantizerMethod. Pass nil to restore
+// the default.
+func (ge *GIFEncoder) SetQuantizerFactory(factory QuantizerFactory) {
+	ge.quantizerFactory = factory
+}
+
+// SetMaxColors limits the palettes built by the quantizer to n colors,
+// 2-256. Fewer colors make smaller files at the cost of banding. NeuQuant
+// and factory palettes are reduced with a median cut over their colors.
+// It has no effect on a fixed or caller supplied palette.
+func (ge *GIFEncoder) SetMaxColors(n int) {
+	if n < 2 || n > 256 {
+		n = 0
+	}
+	ge.maxColors = n
+}
+
+// SetAdaptivePaletteSize makes frames with no more distinct colors than
+// the palette may hold use exactly those colors instead of a quantized
+// approximation. Together with the compaction every local color table
+// gets, the table and the LZW code size of such a frame shrink to the
+// smallest power of two covering its colors, while frames with more colors
+// are quantized to the full palette as usual. It only applies to palettes
+// built per frame, not to a global or shared palette.
+func (ge *GIFEncoder) SetAdaptivePaletteSize(adaptive bool) {
+	ge.adaptivePalette = adaptive
+}
+
+// countColors returns the number of distinct colors of RGB pixels, but
+// stops counting at limit
+func countColors(pixels []byte, limit int) int {
+	seen := make(map[uint32]struct{}, limit)
+	for i := 0; i+2 < len(pixels); i += 3 {
+		seen[packRGB(pixels[i], pixels[i+1], pixels[i+2])] = struct{}{}
+		if len(seen) >= limit {
+			break
+		}
+	}
+	return len(seen)
+}
+
+// SetForceColors makes the palettes built by the quantizer contain the
+// given exact colors, e.g. brand colors of a logo. Missing colors are
+// added while there is room and otherwise replace the closest entry. It
+// has no effect on a fixed or caller supplied palette.
+func (ge *GIFEncoder) SetForceColors(colors []color.RGBA) {
+	ge.forceColors = append([]color.RGBA(nil), colors...)
+}
+
 // SetGlobalPalette sets global palette for all frames
 func (ge *GIFEncoder) SetGlobalPalette(palette []byte) {
 	ge.globalPalette = palette
+	ge.globalQuantizer = nil
+	ge.globalTransIndex = -1
+	ge.sharedTrained = false
+}
+
+// SetGlobalPaletteFromColors sets global palette for all frames from a
+// color.Palette. Palettes with more than 256 colors are rejected. Pixels
+// are matched against it with a linear nearest-color search.
+func (ge *GIFEncoder) SetGlobalPaletteFromColors(p color.Palette) error {
+	if len(p) == 0 {
+		return errors.New("global palette is empty")
+	}
+	if len(p) > 256 {
+		return fmt.Errorf("global palette has %d colors, at most 256 are allowed", len(p))
+	}
+
+	palette := make([]byte, 0, len(p)*3)
+	for _, c := range p {
+		r, g, b, _ := c.RGBA()
+		palette = append(palette, byte(r>>8), byte(g>>8), byte(b>>8))
+	}
+	ge.SetGlobalPalette(palette)
+	return nil
+}
+
+// maxGlobalSamplePixels bounds the pixel pool used by BuildGlobalPalette
+const maxGlobalSamplePixels = 512 * 512
+
+// BuildGlobalPalette trains one quantizer over a sampled union of all frames
+// and sets the result as global palette, so no local color tables are
+// written. Frames should be passed to AddFrame afterwards as usual.
+func (ge *GIFEncoder) BuildGlobalPalette(frames []image.Image) {
+	// only a cancelled context can make it fail
+	ge.buildGlobalPalette(context.Background(), frames)
+}
+
+// buildGlobalPalette is BuildGlobalPalette honoring ctx while training
+func (ge *GIFEncoder) buildGlobalPalette(ctx context.Context, frames []image.Image) error {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	total := len(frames) * ge.width * ge.height
+	step := 1
+	if total > maxGlobalSamplePixels {
+		step = (total + maxGlobalSamplePixels - 1) / maxGlobalSamplePixels
+	}
+
+	pool := make([]byte, 0, (total/step+1)*3)
+	offset := 0
+	for _, img := range frames {
+		ge.image = img
+		ge.getImagePixels()
+		nPix := len(ge.pixels) / 3
+		for ; offset < nPix; offset += step {
+			pool = append(pool, ge.pixels[offset*3], ge.pixels[offset*3+1], ge.pixels[offset*3+2])
+		}
+		// carry the stride over frame boundaries
+		offset -= nPix
+	}
+	ge.image = nil
+
+	q := ge.newQuantizer(pool)
+	ge.pixels = nil
+	if err := buildColormap(ctx, q); err != nil {
+		return err
+	}
+
+	ge.setFixedPalette(q)
+	return nil
 }
 
 // SetColorEnhancement 设置颜色增强选项
 // saturationBoost: 饱和度 ([0.0,2.0], 1.0为原始)
 // contrastBoost: 对比度 ([0.0,2.0], 1.0为原始)
+// The values are used as given, SetColorAdjust sets them together with
+// brightness and gamma and clamps them to their ranges.
 func (ge *GIFEncoder) SetColorEnhancement(saturationBoost, contrastBoost float64) {
 	ge.saturationBoost = saturationBoost
 	ge.contrastBoost = contrastBoost
 }
 
+// SetHueShift rotates the hue of every pixel by the given number of
+// degrees before quantization, 0 leaves colors unchanged
+func (ge *GIFEncoder) SetHueShift(degrees float64) {
+	ge.hueShift = math.Mod(degrees, 360)
+}
+
+// SetBrightness scales the HSL lightness of every pixel before
+// quantization, 1.0 leaves colors unchanged and 0 turns them black
+func (ge *GIFEncoder) SetBrightness(brightness float64) {
+	if brightness < 0 {
+		brightness = 0
+	}
+	ge.brightness = brightness
+}
+
+// SetPosterize reduces each color channel to the given number of evenly
+// spaced levels before quantization, after the color adjustments. It gives
+// a flat, stylized look, and the fewer colors compress better. Levels
+// outside 2-255 turn it off.
+func (ge *GIFEncoder) SetPosterize(levels int) {
+	if levels < 2 || levels > 255 {
+		ge.posterize = nil
+		return
+	}
+	ge.posterize = make([]byte, 256)
+	steps := levels - 1
+	for v := range ge.posterize {
+		level := (v*steps + 127) / 255
+		ge.posterize[v] = byte((level*255 + steps/2) / steps)
+	}
+}
+
 // GetGlobalPalette returns global palette used for all frames
 func (ge *GIFEncoder) GetGlobalPalette() []byte {
 	if ge.globalPalette != nil && len(ge.globalPalette) > 0 {
@@ -168,37 +814,95 @@ func (ge *GIFEncoder) GetGlobalPalette() []byte {
 
 // AddFrame adds next GIF frame
 func (ge *GIFEncoder) AddFrame(img image.Image) error {
+	return ge.AddFrameContext(context.Background(), img)
+}
+
+// AddFrameContext adds next GIF frame, aborting color quantization when ctx
+// is done. Nothing is written to the stream for a cancelled frame.
+func (ge *GIFEncoder) AddFrameContext(ctx context.Context, img image.Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := ge.writeHeldFirst(ctx); err != nil {
+		return err
+	}
+	if ge.width <= 0 || ge.height <= 0 || ge.width > 0xffff || ge.height > 0xffff {
+		return fmt.Errorf("invalid frame size %dx%d, width and height must be 1-65535", ge.width, ge.height)
+	}
+
+	ge.applyDelays()
+	if held, err := ge.holdOrFlush(ctx, img, nil); held {
+		return err
+	}
+
 	ge.image = img
+	ge.frameRect = image.Rect(0, 0, ge.width, ge.height)
 
 	if ge.globalPalette != nil && len(ge.globalPalette) > 0 {
 		ge.colorTab = ge.globalPalette
+		ge.quantizer = ge.globalQuantizer
 	} else {
 		ge.colorTab = nil
 	}
 
-	ge.getImagePixels() // convert to correct format if necessary
-	ge.analyzePixels()  // build color table & map pixels
+	if p, ok := img.(*image.Paletted); ok && ge.canUsePaletted(p) {
+		// already indexed, reuse the frame's own palette
+		ge.prevPixels = nil
+		ge.unchanged = nil
+		ge.usePalettedPixels(p)
+	} else {
+		ge.getImagePixels() // convert to correct format if necessary
+		ge.diffPixels()     // find pixels unchanged since the previous frame
+		if err := ge.analyzePixels(ctx); err != nil {
+			ge.pixels = nil
+			ge.image = nil
+			return err
+		}
+	}
+
+	if t := ge.frameTransIndex; t != nil && *t >= len(ge.colorTab)/3 {
+		ge.pixels = nil
+		ge.indexedPixels = nil
+		ge.image = nil
+		return fmt.Errorf("transparent index %d out of range [0, %d)", *t, len(ge.colorTab)/3)
+	}
+
+	if ge.indexSink != nil {
+		ge.indexSink(ge.indexedPixels, ge.colorTab)
+	}
 
 	if ge.firstFrame {
 		ge.writeHeader()  // GIF header
 		ge.writeLSD()     // logical screen descriptor
 		ge.writePalette() // global color table
-		if ge.repeat >= 0 {
+		ge.gctTab = append(ge.gctTab[:0], ge.colorTab...)
+		if ge.repeat >= 0 && !ge.version87a {
 			ge.writeNetscapeExt()
 		}
+		if ge.xmp != "" && !ge.version87a {
+			ge.writeXMPExt()
+		}
 	}
 
+	ge.cropIndexedPixels() // drop pixels outside the frame rectangle
+
 	ge.writeGraphicCtrlExt() // write graphic control extension
 	ge.writeImageDesc()      // image descriptor
 
-	if !ge.firstFrame && ge.globalPalette == nil {
+	if ge.hasLocalTable() {
 		ge.writePalette() // local color table
 	}
 
 	ge.writePixels() // encode and write pixel data
 
+	ge.lastColorTab = ge.colorTab
+	ge.lastUsedColors = ge.countUsedEntries()
+	ge.lastStats.UniqueColors = ge.lastUsedColors
+	ge.frameWritten()
+
 	// gc
 	ge.indexedPixels = nil
+	ge.unchanged = nil
 	ge.image = nil
 	if ge.globalPalette == nil && !ge.firstFrame {
 		ge.colorTab = nil
@@ -208,10 +912,162 @@ func (ge *GIFEncoder) AddFrame(img image.Image) error {
 	return nil
 }
 
-// Finish adds final trailer to the GIF stream
+// ProgressFunc receives the 0-based index of the frame just written and
+// the total number of frames, 0 if unknown
+type ProgressFunc func(frameIndex, totalFrames int)
+
+// SetProgressCallback sets a function called once after every frame is
+// written, with increasing frame indices. totalFrames is passed through to
+// fn, use 0 if the number of frames is not known in advance.
+func (ge *GIFEncoder) SetProgressCallback(totalFrames int, fn ProgressFunc) {
+	ge.progressTotal = totalFrames
+	ge.progress = fn
+}
+
+// frameWritten counts a written frame and reports progress
+func (ge *GIFEncoder) frameWritten() {
+	if ge.progress != nil {
+		ge.progress(ge.framesWritten, ge.progressTotal)
+	}
+	if ge.frameStats != nil {
+		ge.lastStats.Index = ge.framesWritten
+		ge.frameStats(ge.lastStats)
+	}
+	ge.framesWritten++
+}
+
+// FrameCount returns the number of frames accepted since the encoder was
+// created or last Reset, including frames still held for a shared palette
+func (ge *GIFEncoder) FrameCount() int {
+	n := ge.framesWritten + len(ge.pending)
+	if ge.heldFirst != nil {
+		n++
+	}
+	return n
+}
+
+// FrameOptions holds metadata that applies to a single frame only.
+// Zero values fall back to the encoder settings.
+type FrameOptions struct {
+	DelayMs          int  // frame delay in milliseconds, 0 = use SetDelay value
+	Disposal         int  // disposal code, 0 = use SetDispose value
+	TransparentIndex *int // palette index drawn as transparent, nil = use SetTransparent
+}
+
+// AddFrameWithOptions adds next GIF frame with per-frame metadata. The
+// encoder's delay and disposal settings, including delays from SetDelays,
+// are left untouched for later frames. A TransparentIndex must fall inside
+// the frame's color table.
+func (ge *GIFEncoder) AddFrameWithOptions(img image.Image, opts FrameOptions) error {
+	if t := opts.TransparentIndex; t != nil && (*t < 0 || *t > 255) {
+		return fmt.Errorf("transparent index %d out of range [0, 255]", *t)
+	}
+	// the options below are for img only
+	if err := ge.writeHeldFirst(context.Background()); err != nil {
+		return err
+	}
+
+	delay, delays, dispose := ge.delay, ge.delays, ge.dispose
+	defer func() {
+		ge.delay, ge.delays, ge.dispose = delay, delays, dispose
+		ge.frameTransIndex = nil
+	}()
+
+	if opts.DelayMs > 0 {
+		// SetDelay drops the SetDelays slice so applyDelays keeps this
+		// frame's delay, the slice is restored afterwards
+		ge.SetDelay(opts.DelayMs)
+	}
+	if opts.Disposal > 0 {
+		if err := ge.SetDispose(opts.Disposal); err != nil {
+			return err
+		}
+	}
+	ge.frameTransIndex = opts.TransparentIndex
+
+	return ge.AddFrame(img)
+}
+
+// UsedColorCountLastFrame returns how many palette entries the most
+// recently written frame refers to, including its transparent entry. The
+// count covers that frame only and is 0 before the first frame is written.
+func (ge *GIFEncoder) UsedColorCountLastFrame() int {
+	return ge.lastUsedColors
+}
+
+// countUsedEntries counts the palette entries marked in usedEntry
+func (ge *GIFEncoder) countUsedEntries() int {
+	n := 0
+	for _, used := range ge.usedEntry {
+		if used {
+			n++
+		}
+	}
+	return n
+}
+
+// GetPalette returns the color table of the most recently added frame as a
+// color.Palette. The transparent entry, if any, is fully transparent.
+// It returns nil before the first frame is added.
+func (ge *GIFEncoder) GetPalette() color.Palette {
+	if ge.lastColorTab == nil {
+		return nil
+	}
+	return colormapToPalette(ge.lastColorTab, ge.lastTransIndex)
+}
+
+// Finish adds final trailer to the GIF stream. Frames still held for the
+// shared palette are written first, a frame failing then is left out
+// without notice, use FinishContext to get the error.
 func (ge *GIFEncoder) Finish() {
+	ge.FinishContext(context.Background())
+}
+
+// FinishContext writes the frames still held for the shared palette,
+// training the palette and quantizing them under ctx, and adds the final
+// trailer. It returns the first error from those frames, the stream is
+// terminated anyway and holds the frames written before it.
+func (ge *GIFEncoder) FinishContext(ctx context.Context) error {
+	err := ge.writeHeldFirst(ctx)
+	if err == nil {
+		err = ge.flushPending(ctx)
+	}
+
 	ge.out.WriteByte(0x3b) // gif trailer
-	ge.Cleanup()
+	ge.releaseFrameState()
+	return err
+}
+
+// Reset prepares the encoder for another GIF with the same settings. The
+// output buffer is emptied and reused, so a ByteArray obtained from Stream
+// is overwritten while slices returned by GetData stay valid. Palettes
+// trained by SetSharedPalette are dropped and trained again; global
+// palettes set by the caller are kept unless Cleanup was called.
+func (ge *GIFEncoder) Reset() {
+	ge.releaseFrameState()
+	if ge.out == nil {
+		ge.out = getByteArray()
+	} else {
+		ge.out.Reset()
+	}
+
+	ge.firstFrame = true
+	ge.transIndex = 0
+	ge.globalTransIndex = -1
+	ge.frameTransIndex = nil
+	ge.lastColorTab = nil
+	ge.lastTransIndex = -1
+	ge.lastUsedColors = 0
+	ge.lastStats = FrameStats{}
+	ge.gctTab = ge.gctTab[:0]
+	ge.framesWritten = 0
+	ge.delaysStart = 0
+	ge.customBuilt = false
+	if ge.sharedTrained {
+		ge.globalPalette = nil
+		ge.globalQuantizer = nil
+		ge.sharedTrained = false
+	}
 }
 
 // GetData retrieves the GIF stream as byte array
@@ -219,6 +1075,12 @@ func (ge *GIFEncoder) GetData() []byte {
 	return ge.out.GetData()
 }
 
+// WriteTo implements io.WriterTo, writing the output to w page by page
+// without the copy GetData makes. Call it after Finish for a complete GIF.
+func (ge *GIFEncoder) WriteTo(w io.Writer) (int64, error) {
+	return ge.out.WriteTo(w)
+}
+
 // Stream returns the output ByteArray
 func (ge *GIFEncoder) Stream() *ByteArray {
 	return ge.out
@@ -226,25 +1088,48 @@ func (ge *GIFEncoder) Stream() *ByteArray {
 
 // writeHeader writes GIF file header
 func (ge *GIFEncoder) writeHeader() {
+	if ge.version87a {
+		ge.out.WriteUTFBytes("GIF87a")
+		return
+	}
 	ge.out.WriteUTFBytes("GIF89a")
 }
 
 // analyzePixels analyzes current frame colors and creates color map
-func (ge *GIFEncoder) analyzePixels() {
+func (ge *GIFEncoder) analyzePixels(ctx context.Context) error {
+	ge.resetUsedEntries()
+	ge.tableSorted = false
+
 	if ge.colorTab == nil {
-		ge.neuQuant = NewNeuQuant(ge.pixels, ge.sample)
-		ge.neuQuant.BuildColormap() // create reduced palette
-		ge.colorTab = ge.neuQuant.GetColormap()
+		ge.quantizer = nil
 
-		// free pixel array
-		if ge.neuQuant != nil {
-			ge.neuQuant.pixels = nil
+		q := ge.customQuantizer
+		if q == nil {
+			q = ge.newQuantizer(ge.changedPixels())
 		}
+
+		// create reduced palette
+		if q != ge.customQuantizer || !ge.customBuilt {
+			if err := buildColormap(ctx, q); err != nil {
+				return err
+			}
+			if q == ge.customQuantizer {
+				ge.customBuilt = true
+			}
+		}
+		ge.quantizer = q
+		ge.colorTab = q.GetColormap()
 	}
 
+	// find pixels written as transparent before the RGB data is released
+	ge.buildTransMask()
+
 	// map image pixels to new palette
-	if ge.ditherMethod != DitherNone {
-		// 使用抖动
+	if matrix := orderedMatrix(ge.ditherMethod); matrix != nil {
+		// 使用有序抖动
+		ge.orderedDitherPixels(matrix)
+	} else if ge.ditherMethod != DitherNone {
+		// 使用误差扩散抖动
 		ge.ditherPixels(ge.ditherMethod, ge.serpentine)
 	} else {
 		// 不使用抖动
@@ -252,23 +1137,231 @@ func (ge *GIFEncoder) analyzePixels() {
 	}
 
 	ge.pixels = nil
-	ge.colorDepth = 8
-	ge.palSize = 7
 
 	// get closest match to transparent color if specified
-	if ge.transparent != nil {
-		ge.transIndex = ge.findClosest(*ge.transparent, true)
+	ge.resolveTransIndex()
+	ge.applyTransMask()
+
+	// make pixels unchanged since the previous frame transparent
+	ge.applyUnchangedMask()
+
+	if ge.globalPalette != nil || ge.frameTransIndex != nil || ge.fixedTransIndex >= 0 {
+		// the global table is shared by all frames and a caller supplied
+		// transparent index must keep its meaning, keep the table whole
+		n := len(ge.colorTab) / 3
+		if ge.fixedTransIndex >= n {
+			n = ge.fixedTransIndex + 1
+		}
+		ge.colorDepth = colorDepthFor(n)
+	} else {
+		ge.compactPalette()
+		if ge.sortPalette {
+			ge.sortByFrequency()
+		}
+	}
+	ge.palSize = ge.colorDepth - 1
+	return nil
+}
+
+// canUsePaletted reports whether the paletted frame p can be written with
+// its own palette and indices. Anything that changes pixel colors before
+// quantization rules that out, since usePalettedPixels skips getImagePixels,
+// and so do forced colors or a palette larger than SetMaxColors allows.
+func (ge *GIFEncoder) canUsePaletted(p *image.Paletted) bool {
+	return ge.colorTab == nil && len(p.Palette) > 0 && len(p.Palette) <= 256 &&
+		!ge.needsResize(p) && !ge.usesTransMask() && ge.posterize == nil &&
+		ge.saturationBoost == 1.0 && ge.contrastBoost == 1.0 &&
+		ge.hueShift == 0 && ge.brightness == 1.0 && ge.gammaTable == nil &&
+		(ge.maxColors == 0 || ge.maxColors >= len(p.Palette)) &&
+		len(ge.forceColors) == 0
+}
+
+// resetUsedEntries clears the active palette entries for a new frame
+func (ge *GIFEncoder) resetUsedEntries() {
+	if ge.usedEntry == nil {
+		ge.usedEntry = make([]bool, 256)
+	}
+	for i := range ge.usedEntry {
+		ge.usedEntry[i] = false
+	}
+}
+
+// compactPalette drops color table entries no pixel refers to, so the
+// written table and the LZW code size shrink to the smallest power of two
+// covering the colors actually used
+func (ge *GIFEncoder) compactPalette() {
+	nColors := len(ge.colorTab) / 3
+	remap := make([]byte, 256)
+	table := make([]byte, 0, 256*3)
+	for i, used := range ge.usedEntry {
+		if !used {
+			continue
+		}
+		remap[i] = byte(len(table) / 3)
+		if i < nColors {
+			table = append(table, ge.colorTab[i*3], ge.colorTab[i*3+1], ge.colorTab[i*3+2])
+		} else {
+			// slot past the end of the quantizer palette, e.g. reserved for transparency
+			table = append(table, 0, 0, 0)
+		}
+	}
+	if len(table) == 0 {
+		table = append(table, 0, 0, 0)
+	}
+
+	for j, index := range ge.indexedPixels {
+		ge.indexedPixels[j] = remap[index]
+	}
+	if ge.transIndex >= 0 && ge.transIndex < 256 {
+		ge.transIndex = int(remap[ge.transIndex])
+	}
+	ge.colorTab = table
+	ge.colorDepth = colorDepthFor(len(table) / 3)
+}
+
+// SetSortPalette orders each adaptive color table by how many pixels use
+// each color, most used first, and sets the sort flag of the table, which
+// lets viewers limited to fewer colors keep the important ones. Tables
+// used as given, a global palette or the palette of an *image.Paletted
+// frame, keep their order and the flag stays clear.
+func (ge *GIFEncoder) SetSortPalette(sort bool) {
+	ge.sortPalette = sort
+}
+
+// sortByFrequency reorders the color table of the current frame by
+// decreasing pixel count and remaps the pixels to match
+func (ge *GIFEncoder) sortByFrequency() {
+	n := len(ge.colorTab) / 3
+	counts := make([]int, n)
+	for _, index := range ge.indexedPixels {
+		if int(index) < n {
+			counts[index]++
+		}
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return counts[order[a]] > counts[order[b]]
+	})
+
+	remap := make([]byte, 256)
+	table := make([]byte, len(ge.colorTab))
+	for i, old := range order {
+		remap[old] = byte(i)
+		copy(table[i*3:i*3+3], ge.colorTab[old*3:old*3+3])
+	}
+	for j, index := range ge.indexedPixels {
+		ge.indexedPixels[j] = remap[index]
 	}
+	if ge.transIndex >= 0 && ge.transIndex < n {
+		ge.transIndex = int(remap[ge.transIndex])
+	}
+	ge.colorTab = table
+	ge.tableSorted = true
+}
+
+// usePalettedPixels takes the color table and indexed pixels straight from a
+// paletted frame, skipping quantization and closest-color search
+func (ge *GIFEncoder) usePalettedPixels(p *image.Paletted) {
+	ge.resetUsedEntries()
+	ge.tableSorted = false
+	ge.quantizer = nil
+	ge.colorTab = make([]byte, 0, len(p.Palette)*3)
+	for _, c := range p.Palette {
+		r, g, b := ge.flatten(c.RGBA())
+		ge.colorTab = append(ge.colorTab, r, g, b)
+	}
+
+	bounds := p.Bounds()
+	w := bounds.Dx()
+	if w > ge.width {
+		w = ge.width
+	}
+	h := bounds.Dy()
+	if h > ge.height {
+		h = ge.height
+	}
+
+	ge.indexedPixels = make([]byte, ge.width*ge.height)
+	if w < ge.width || h < ge.height {
+		// 未覆盖的区域使用最接近填充色的调色板索引
+		fill := byte(ge.findClosestRGB(fillColor, fillColor, fillColor))
+		for i := range ge.indexedPixels {
+			ge.indexedPixels[i] = fill
+		}
+		ge.usedEntry[fill] = true
+	}
+
+	for y := 0; y < h; y++ {
+		src := p.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+		row := ge.indexedPixels[y*ge.width : y*ge.width+w]
+		copy(row, p.Pix[src:src+w])
+		for _, index := range row {
+			ge.usedEntry[index] = true
+		}
+	}
+
+	ge.resolveTransIndex()
+	n := len(p.Palette)
+	if ge.fixedTransIndex >= n {
+		n = ge.fixedTransIndex + 1
+	}
+	ge.colorDepth = colorDepthFor(n)
+	ge.palSize = ge.colorDepth - 1
+}
+
+// colorDepthFor returns the number of bit planes needed for n palette entries
+func colorDepthFor(n int) int {
+	depth := 1
+	for (1 << depth) < n {
+		depth++
+	}
+	return depth
+}
+
+// newQuantizer creates a quantizer for the given RGB pixels
+func (ge *GIFEncoder) newQuantizer(pixels []byte) Quantizer {
+	maxColors := ge.maxColors
+	if maxColors == 0 {
+		maxColors = 256
+	}
+
+	var q Quantizer
+	sized := true // q builds at most maxColors colors
+	switch {
+	case ge.quantizerFactory != nil:
+		q = ge.quantizerFactory(pixels, ge.sampleFactor(len(pixels)/3))
+		sized = false
+	case ge.quantizerMethod == QuantizerMedianCut ||
+		(ge.adaptivePalette && countColors(pixels, maxColors+1) <= maxColors):
+		// 颜色不多时中位切分得到精确调色板
+		q = NewMedianCutQuantizer(pixels, maxColors)
+	case ge.quantizerMethod == QuantizerOctree:
+		q = NewOctreeQuantizer(pixels, maxColors)
+	case ge.quantizerMethod == QuantizerPopularity:
+		q = NewPopularityQuantizer(pixels, maxColors)
+	default:
+		// NeuQuant 固定输出 256 色
+		q = NewNeuQuant(pixels, ge.sampleFactor(len(pixels)/3))
+		sized = false
+	}
+	if (!sized && maxColors < 256) || len(ge.forceColors) > 0 {
+		q = &adjustedQuantizer{Quantizer: q, maxColors: maxColors, forceColors: ge.forceColors}
+	}
+	return q
 }
 
 // indexPixels indexes pixels without dithering
 func (ge *GIFEncoder) indexPixels() {
 	nPix := len(ge.pixels) / 3
 	ge.indexedPixels = make([]byte, nPix)
+	ge.resetLookupCache()
 
 	k := 0
 	for j := 0; j < nPix; j++ {
-		index := ge.findClosestRGB(
+		index := ge.findClosestCached(
 			ge.pixels[k]&0xff,
 			ge.pixels[k+1]&0xff,
 			ge.pixels[k+2]&0xff,
@@ -290,95 +1383,187 @@ func (ge *GIFEncoder) findClosestRGB(r, g, b byte) int {
 		return -1
 	}
 
-	if ge.neuQuant != nil {
-		return ge.neuQuant.LookupRGB(r, g, b)
+	if ge.perceptual && ge.monochrome == nil {
+		return ge.findClosestLab(r, g, b)
 	}
 
-	minpos := 0
-	dmin := 256 * 256 * 256
-	length := len(ge.colorTab)
+	if ge.quantizer != nil {
+		return ge.quantizer.LookupRGB(r, g, b)
+	}
 
-	for i, index := 0, 0; i < length; index++ {
-		dr := int(r) - int(ge.colorTab[i])
-		i++
-		dg := int(g) - int(ge.colorTab[i])
-		i++
-		db := int(b) - int(ge.colorTab[i])
-		i++
+	return ge.colorTree().nearest(r, g, b)
+}
 
-		d := dr*dr + dg*dg + db*db
-		if d < dmin {
-			dmin = d
-			minpos = index
-		}
+// colorTree returns a k-d tree over the current color table, rebuilt only
+// when the table changes, so a global palette is indexed once per encode
+func (ge *GIFEncoder) colorTree() *kdTree {
+	if ge.tree == nil || len(ge.treePalette) != len(ge.colorTab) ||
+		(len(ge.colorTab) > 0 && &ge.treePalette[0] != &ge.colorTab[0]) {
+		ge.tree = newKDTree(ge.colorTab)
+		ge.treePalette = ge.colorTab
 	}
-
-	return minpos
+	return ge.tree
 }
 
 // getImagePixels extracts image pixels into byte array
 func (ge *GIFEncoder) getImagePixels() {
-	w := ge.width
-	h := ge.height
+	// the frame size is fixed, so the buffer is allocated once and reused
+	if len(ge.pixelBuf) != ge.width*ge.height*3 {
+		ge.pixelBuf = make([]byte, ge.width*ge.height*3)
+	}
+	ge.pixels = ge.pixelBuf
 
-	ge.pixels = make([]byte, w*h*3)
+	// 缩放到编码器尺寸
+	ge.image = ge.resizeFrame(ge.image)
 
 	bounds := ge.image.Bounds()
-
 	minX := bounds.Min.X
 	minY := bounds.Min.Y
-	maxX := bounds.Max.X
-	maxY := bounds.Max.Y
 
-	availWidth := maxX - minX
-	availHeight := maxY - minY
+	// 使用较小的尺寸避免越界
+	w := bounds.Dx()
+	if w > ge.width {
+		w = ge.width
+	}
+	h := bounds.Dy()
+	if h > ge.height {
+		h = ge.height
+	}
 
-	if availWidth != w || availHeight != h {
-		// 使用较小的尺寸避免越界
-		if availWidth < w {
-			w = availWidth
-		}
-		if availHeight < h {
-			h = availHeight
+	// 如果帧小于编码器尺寸，未覆盖的区域用黑色填充
+	if w < ge.width || h < ge.height {
+		for i := range ge.pixels {
+			ge.pixels[i] = fillColor
 		}
 	}
 
-	// 是否启用颜色增强
-	enhanceColors := ge.saturationBoost != 1.0 || ge.contrastBoost != 1.0
+	// pixels below the alpha threshold, uncovered areas stay opaque
+	ge.transMask = nil
+	if ge.alphaThreshold > 0 && ge.usesTransMask() {
+		ge.transMask = make([]bool, ge.width*ge.height)
+	}
 
-	count := 0
+	// 是否启用颜色增强
+	enhanceColors := ge.saturationBoost != 1.0 || ge.contrastBoost != 1.0 ||
+		ge.hueShift != 0 || ge.brightness != 1.0
+
+	// 常见图像类型直接读取像素，避免逐像素的接口调用，结果与 At 相同
+	switch src := ge.image.(type) {
+	case *image.RGBA:
+		for y := 0; y < h; y++ {
+			k := y * ge.width * 3
+			row := src.Pix[src.PixOffset(minX, minY+y):]
+			for x := 0; x < w; x++ {
+				s := row[x*4 : x*4+4 : x*4+4]
+				ge.storePixel(k, uint32(s[0])*0x101, uint32(s[1])*0x101, uint32(s[2])*0x101, uint32(s[3])*0x101, enhanceColors)
+				k += 3
+			}
+		}
+	case *image.NRGBA:
+		for y := 0; y < h; y++ {
+			k := y * ge.width * 3
+			row := src.Pix[src.PixOffset(minX, minY+y):]
+			for x := 0; x < w; x++ {
+				s := row[x*4 : x*4+4 : x*4+4]
+				// premultiply as color.NRGBA.RGBA does
+				a := uint32(s[3]) * 0x101
+				r := uint32(s[0]) * 0x101 * a / 0xffff
+				g := uint32(s[1]) * 0x101 * a / 0xffff
+				b := uint32(s[2]) * 0x101 * a / 0xffff
+				ge.storePixel(k, r, g, b, a, enhanceColors)
+				k += 3
+			}
+		}
+	case *image.Gray:
+		for y := 0; y < h; y++ {
+			k := y * ge.width * 3
+			row := src.Pix[src.PixOffset(minX, minY+y):]
+			for x := 0; x < w; x++ {
+				v := uint32(row[x]) * 0x101
+				ge.storePixel(k, v, v, v, 0xffff, enhanceColors)
+				k += 3
+			}
+		}
+	case *image.YCbCr:
+		// JPEG 解码结果；按色度子采样取 Cb/Cr，换算与 color.YCbCr.RGBA 相同
+		for y := 0; y < h; y++ {
+			k := y * ge.width * 3
+			for x := 0; x < w; x++ {
+				yi := src.YOffset(minX+x, minY+y)
+				ci := src.COffset(minX+x, minY+y)
+				r, g, b, _ := color.YCbCr{Y: src.Y[yi], Cb: src.Cb[ci], Cr: src.Cr[ci]}.RGBA()
+				ge.storePixel(k, r, g, b, 0xffff, enhanceColors)
+				k += 3
+			}
+		}
+	case *image.CMYK:
+		for y := 0; y < h; y++ {
+			k := y * ge.width * 3
+			row := src.Pix[src.PixOffset(minX, minY+y):]
+			for x := 0; x < w; x++ {
+				s := row[x*4 : x*4+4 : x*4+4]
+				r, g, b, _ := color.CMYK{C: s[0], M: s[1], Y: s[2], K: s[3]}.RGBA()
+				ge.storePixel(k, r, g, b, 0xffff, enhanceColors)
+				k += 3
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			// each source row starts at its own stride offset in the output buffer
+			k := y * ge.width * 3
+			for x := 0; x < w; x++ {
+				r, g, b, a := ge.image.At(minX+x, minY+y).RGBA()
+				ge.storePixel(k, r, g, b, a, enhanceColors)
+				k += 3
+			}
+		}
+	}
+}
 
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			r, g, b, _ := ge.image.At(minX+x, minY+y).RGBA()
+// storePixel writes an alpha-premultiplied 16-bit color as the RGB bytes at
+// offset k of ge.pixels, marking it in the transparency mask when its alpha
+// is below the threshold
+func (ge *GIFEncoder) storePixel(k int, r, g, b, a uint32, enhance bool) {
+	if ge.transMask != nil && int(a>>8) < ge.alphaThreshold {
+		ge.transMask[k/3] = true
+	}
+	r8, g8, b8 := ge.flatten(r, g, b, a)
 
-			// 转换为0-255
-			r8 := byte(r >> 8)
-			g8 := byte(g >> 8)
-			b8 := byte(b >> 8)
+	if ge.gammaTable != nil {
+		r8, g8, b8 = ge.gammaTable[r8], ge.gammaTable[g8], ge.gammaTable[b8]
+	}
+	if enhance {
+		r8, g8, b8 = enhanceColor(r8, g8, b8, ge.saturationBoost, ge.contrastBoost, ge.hueShift, ge.brightness)
+	}
+	if ge.posterize != nil {
+		r8, g8, b8 = ge.posterize[r8], ge.posterize[g8], ge.posterize[b8]
+	}
 
-			if enhanceColors {
-				r8, g8, b8 = enhanceColor(r8, g8, b8, ge.saturationBoost, ge.contrastBoost)
-			}
+	ge.pixels[k] = r8
+	ge.pixels[k+1] = g8
+	ge.pixels[k+2] = b8
+}
 
-			ge.pixels[count] = r8
-			count++
-			ge.pixels[count] = g8
-			count++
-			ge.pixels[count] = b8
-			count++
-		}
-	}
+// SetMatteColor sets the color translucent pixels are composited over, the
+// default is black. The alpha of c is ignored.
+func (ge *GIFEncoder) SetMatteColor(c color.RGBA) {
+	ge.matte = c
+}
 
-	// 如果实际读取的像素少于预期，用黑色填充剩余部分
-	expectedSize := ge.width * ge.height * 3
-	for count < expectedSize {
-		ge.pixels[count] = 255
-		count++
+// flatten composites an alpha-premultiplied color over the matte color and
+// returns 8-bit RGB
+func (ge *GIFEncoder) flatten(r, g, b, a uint32) (byte, byte, byte) {
+	if a < 0xffff {
+		// premultiplied: color + matte * (1 - alpha)
+		rest := 0xffff - a
+		r += uint32(ge.matte.R) * 0x101 * rest / 0xffff
+		g += uint32(ge.matte.G) * 0x101 * rest / 0xffff
+		b += uint32(ge.matte.B) * 0x101 * rest / 0xffff
 	}
+	return byte(r >> 8), byte(g >> 8), byte(b >> 8)
 }
 
-func enhanceColor(r, g, b byte, satBoost, contrastBoost float64) (byte, byte, byte) {
+func enhanceColor(r, g, b byte, satBoost, contrastBoost, hueShift, brightness float64) (byte, byte, byte) {
 	rf := float64(r) / 255.0
 	gf := float64(g) / 255.0
 	bf := float64(b) / 255.0
@@ -390,46 +1575,28 @@ func enhanceColor(r, g, b byte, satBoost, contrastBoost float64) (byte, byte, by
 		bf = (bf-0.5)*contrastBoost + 0.5
 	}
 
-	// 应用饱和度
-	if satBoost != 1.0 {
-		// 转换到HSL
-		max := maxFloat(rf, gf, bf)
-		min := minFloat(rf, gf, bf)
-		l := (max + min) / 2.0
+	// 饱和度、色相和亮度在HSL空间中调整
+	if satBoost != 1.0 || hueShift != 0 || brightness != 1.0 {
+		h, s, l := rgbToHSL(minFloat(1, maxFloat(0, rf)), minFloat(1, maxFloat(0, gf)), minFloat(1, maxFloat(0, bf)))
 
-		if max != min {
-			var h, s float64
-			d := max - min
-
-			if l > 0.5 {
-				s = d / (2.0 - max - min)
-			} else {
-				s = d / (max + min)
-			}
-
-			// 计算色调
-			switch max {
-			case rf:
-				h = (gf - bf) / d
-				if gf < bf {
-					h += 6.0
-				}
-			case gf:
-				h = (bf-rf)/d + 2.0
-			case bf:
-				h = (rf-gf)/d + 4.0
-			}
-			h /= 6.0
+		// 提升饱和度
+		s *= satBoost
+		if s > 1.0 {
+			s = 1.0
+		}
 
-			// 提升饱和度
-			s *= satBoost
-			if s > 1.0 {
-				s = 1.0
-			}
+		// 旋转色相
+		h += hueShift / 360.0
+		h -= math.Floor(h)
 
-			// 转换回RGB
-			rf, gf, bf = hslToRGB(h, s, l)
+		// 调整亮度
+		l *= brightness
+		if l > 1.0 {
+			l = 1.0
 		}
+
+		// 转换回RGB
+		rf, gf, bf = hslToRGB(h, s, l)
 	}
 
 	// 限制在0-255范围
@@ -438,26 +1605,58 @@ func enhanceColor(r, g, b byte, satBoost, contrastBoost float64) (byte, byte, by
 		clampFloat(bf * 255.0)
 }
 
+// frameDisposal returns the disposal code of the current frame. Frame
+// optimization needs the previous frame to stay visible, otherwise an
+// explicit SetDispose wins, and transparent frames default to clearing
+// their area so earlier frames don't show through.
+func (ge *GIFEncoder) frameDisposal() int {
+	switch {
+	case ge.optimize && !ge.hasTransparency():
+		return DisposalKeep
+	case ge.dispose >= 0:
+		return ge.dispose
+	case ge.hasTransparency():
+		return DisposalRestoreBackground
+	default:
+		return DisposalNone
+	}
+}
+
 // writeGraphicCtrlExt writes Graphic Control Extension
 func (ge *GIFEncoder) writeGraphicCtrlExt() {
-	ge.out.WriteByte(0x21) // extension introducer
-	ge.out.WriteByte(0xf9) // GCE label
-	ge.out.WriteByte(4)    // data block size
-
 	transp := 0
-	disp := 0
-	if ge.transparent == nil {
-		transp = 0
-		disp = 0 // dispose = no action
-	} else {
+	if ge.hasTransparency() || (ge.optimize && ge.unchanged != nil) {
 		transp = 1
-		disp = 2 // force clear if using transparent color
 	}
+	disp := ge.frameDisposal() << 2
 
-	if ge.dispose >= 0 {
-		disp = ge.dispose & 7 // user override
+	transIndex := ge.transIndex
+	if ge.frameTransIndex != nil {
+		transp = 1
+		transIndex = *ge.frameTransIndex
+	}
+
+	ge.lastTransIndex = -1
+	if ge.version87a {
+		// GIF87a 没有扩展块
+		return
+	}
+	if transp != 0 {
+		ge.lastTransIndex = transIndex
+	}
+
+	delay := ge.delay
+	if delay < ge.minDelay {
+		delay = ge.minDelay
+	}
+	if ge.minimalExt && transp == 0 && disp == 0 && delay == 0 {
+		// an all-default GCE changes nothing, viewers assume the same without it
+		return
 	}
-	disp <<= 2
+
+	ge.out.WriteByte(0x21) // extension introducer
+	ge.out.WriteByte(0xf9) // GCE label
+	ge.out.WriteByte(4)    // data block size
 
 	// packed fields
 	ge.out.WriteByte(byte(
@@ -467,21 +1666,21 @@ func (ge *GIFEncoder) writeGraphicCtrlExt() {
 			transp, // 8 transparency flag
 	))
 
-	ge.writeShort(ge.delay)               // delay x 1/100 sec
-	ge.out.WriteByte(byte(ge.transIndex)) // transparent color index
-	ge.out.WriteByte(0)                   // block terminator
+	ge.writeShort(delay)               // delay x 1/100 sec
+	ge.out.WriteByte(byte(transIndex)) // transparent color index
+	ge.out.WriteByte(0)                // block terminator
 }
 
 // writeImageDesc writes Image Descriptor
 func (ge *GIFEncoder) writeImageDesc() {
-	ge.out.WriteByte(0x2c) // image separator
-	ge.writeShort(0)       // image position x,y = 0,0
-	ge.writeShort(0)
-	ge.writeShort(ge.width) // image size
-	ge.writeShort(ge.height)
+	ge.out.WriteByte(0x2c)                               // image separator
+	ge.writeShort(ge.frameOffset.X + ge.frameRect.Min.X) // image position x,y
+	ge.writeShort(ge.frameOffset.Y + ge.frameRect.Min.Y)
+	ge.writeShort(ge.frameRect.Dx()) // image size
+	ge.writeShort(ge.frameRect.Dy())
 
 	// packed fields
-	if ge.firstFrame || ge.globalPalette != nil {
+	if !ge.hasLocalTable() {
 		// no LCT - GCT is used for first (or only) frame
 		ge.out.WriteByte(0)
 	} else {
@@ -489,29 +1688,59 @@ func (ge *GIFEncoder) writeImageDesc() {
 		ge.out.WriteByte(byte(
 			0x80 | // 1 local color table 1=yes
 				0 | // 2 interlace - 0=no
-				0 | // 3 sorted - 0=no
+				ge.sortFlag(0x20) | // 3 sorted
 				0 | // 4-5 reserved
 				ge.palSize, // 6-8 size of color table
 		))
 	}
 }
 
+// hasLocalTable reports whether the current frame needs a local color
+// table, that is when its palette differs from the global color table
+func (ge *GIFEncoder) hasLocalTable() bool {
+	if ge.firstFrame || ge.globalPalette != nil {
+		return false
+	}
+	return !ge.dedupPalettes || !bytes.Equal(ge.colorTab, ge.gctTab)
+}
+
+// sortFlag returns bit when the current color table is sorted, else 0
+func (ge *GIFEncoder) sortFlag(bit int) int {
+	if ge.tableSorted && !ge.version87a {
+		return bit
+	}
+	return 0
+}
+
 // writeLSD writes Logical Screen Descriptor
 func (ge *GIFEncoder) writeLSD() {
 	// logical screen size
-	ge.writeShort(ge.width)
-	ge.writeShort(ge.height)
+	screen := image.Pt(ge.width, ge.height)
+	if ge.screen != (image.Point{}) {
+		screen = ge.screen
+	}
+	ge.writeShort(screen.X)
+	ge.writeShort(screen.Y)
 
 	// packed fields
 	ge.out.WriteByte(byte(
 		0x80 | // 1 : global color table flag = 1 (gct used)
 			0x70 | // 2-4 : color resolution = 7
-			0x00 | // 5 : gct sort flag = 0
+			ge.sortFlag(0x08) | // 5 : gct sort flag
 			ge.palSize, // 6-8 : gct size
 	))
 
-	ge.out.WriteByte(0) // background color index
-	ge.out.WriteByte(0) // pixel aspect ratio - assume 1:1
+	// the index must point inside the global color table
+	background := ge.backgroundIndex
+	if background >= 1<<(ge.palSize+1) {
+		background = 0
+	}
+	ge.out.WriteByte(byte(background)) // background color index
+	if ge.version87a {
+		ge.out.WriteByte(0) // reserved in GIF87a
+	} else {
+		ge.out.WriteByte(ge.aspectRatio) // pixel aspect ratio, 0 = none
+	}
 }
 
 // writeNetscapeExt writes Netscape application extension to define repeat count
@@ -529,7 +1758,7 @@ func (ge *GIFEncoder) writeNetscapeExt() {
 // writePalette writes color table
 func (ge *GIFEncoder) writePalette() {
 	ge.out.WriteBytes(ge.colorTab)
-	n := (3 * 256) - len(ge.colorTab)
+	n := (3 * (1 << (ge.palSize + 1))) - len(ge.colorTab)
 	for i := 0; i < n; i++ {
 		ge.out.WriteByte(0)
 	}
@@ -543,26 +1772,53 @@ func (ge *GIFEncoder) writeShort(value int) {
 
 // writePixels encodes and writes pixel data
 func (ge *GIFEncoder) writePixels() {
-	enc := NewLZWEncoder(ge.width, ge.height, ge.indexedPixels, ge.colorDepth)
+	start := ge.out.Len()
+	enc := NewLZWEncoder(ge.frameRect.Dx(), ge.frameRect.Dy(), ge.indexedPixels, ge.colorDepth)
+	enc.SetDeferredClear(ge.deferClear)
 	enc.Encode(ge.out)
+
+	ge.lastStats = FrameStats{
+		UncompressedBytes: ge.frameRect.Dx() * ge.frameRect.Dy(),
+		CompressedBytes:   ge.out.Len() - start,
+		ClearCodeCount:    enc.ClearCount(),
+	}
 }
 
+// Cleanup releases all buffers, including the global palette
 func (ge *GIFEncoder) Cleanup() {
+	ge.releaseFrameState()
+	ge.globalPalette = nil
+	ge.globalQuantizer = nil
+	ge.tree = nil
+	ge.treePalette = nil
+	ge.labColors = nil
+	ge.labTab = nil
+}
+
+// releaseFrameState drops the per-frame buffers while keeping the settings
+func (ge *GIFEncoder) releaseFrameState() {
 	ge.pixels = nil
 	ge.indexedPixels = nil
 	ge.colorTab = nil
 	ge.image = nil
-	ge.neuQuant = nil
-	ge.globalPalette = nil
+	ge.quantizer = nil
+	ge.prevPixels = nil
+	ge.unchanged = nil
 	ge.usedEntry = nil
+	ge.pending = nil
+	ge.heldFirst = nil
+	ge.lookupCache = nil
+	ge.pixelBuf = nil
+	ge.transMask = nil
 }
 
 // CleanupAll 完全清理包括输出缓冲区
 // 只在确定不再需要GetData()时调用
+// 输出缓冲区会归还到缓冲池供下一个编码器复用，此后 Stream() 返回的 ByteArray 不再有效
 func (ge *GIFEncoder) CleanupAll() {
 	ge.Cleanup()
 	if ge.out != nil {
-		ge.out.pages = nil
+		putByteArray(ge.out)
 		ge.out = nil
 	}
 }
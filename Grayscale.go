@@ -0,0 +1,60 @@
+package gifencoder
+
+// GrayscalePalette returns an evenly spaced gray ramp of 2..256 levels as
+// byte array [r,g,b,r,g,b,...], from black to white
+func GrayscalePalette(levels int) []byte {
+	levels = clampGrayLevels(levels)
+	palette := make([]byte, 0, levels*3)
+	for i := 0; i < levels; i++ {
+		v := byte((i*255 + (levels-1)/2) / (levels - 1))
+		palette = append(palette, v, v, v)
+	}
+	return palette
+}
+
+// clampGrayLevels limits the number of gray levels to 2..256
+func clampGrayLevels(levels int) int {
+	if levels < 2 {
+		return 2
+	}
+	if levels > 256 {
+		return 256
+	}
+	return levels
+}
+
+// grayscaleQuantizer maps colors to a gray ramp by their Rec. 601 luma
+type grayscaleQuantizer struct {
+	levels int
+}
+
+// BuildColormap does nothing, the palette is fixed
+func (q grayscaleQuantizer) BuildColormap() {}
+
+// GetColormap returns the gray ramp
+func (q grayscaleQuantizer) GetColormap() []byte {
+	return GrayscalePalette(q.levels)
+}
+
+// LookupRGB returns the index of the gray level closest to the luma of r, g, b
+func (q grayscaleQuantizer) LookupRGB(r, g, b byte) int {
+	return int(luma(r, g, b)*float64(q.levels-1)/255.0 + 0.5)
+}
+
+// luma returns the Rec. 601 luma of r, g, b in 0..255
+func luma(r, g, b byte) float64 {
+	return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+}
+
+// SetGrayscale quantizes every frame to a global ramp of the given number
+// of gray levels (2-256). Pixels are converted to luma with Rec. 601
+// weights and indexed directly, dithering still applies. 0 disables it.
+func (ge *GIFEncoder) SetGrayscale(levels int) {
+	ge.clearFixedPalette()
+	if levels <= 0 {
+		return
+	}
+
+	ge.grayscale = clampGrayLevels(levels)
+	ge.setFixedPalette(grayscaleQuantizer{levels: ge.grayscale})
+}
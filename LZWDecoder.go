@@ -0,0 +1,120 @@
+package gifencoder
+
+import "errors"
+
+var (
+	errLZWInvalidCode = errors.New("lzw: invalid code")
+	errLZWTooMuchData = errors.New("lzw: too much image data")
+	errLZWNotEnough   = errors.New("lzw: not enough image data")
+)
+
+// LZWDecoder decompresses GIF image data back into color indices
+type LZWDecoder struct {
+	minCodeSize int
+}
+
+// NewLZWDecoder creates a new LZW decoder
+// minCodeSize: the LZW minimum code size stored before the image data (2-8)
+func NewLZWDecoder(minCodeSize int) *LZWDecoder {
+	return &LZWDecoder{minCodeSize: minCodeSize}
+}
+
+// Decode decompresses data, the image data sub-blocks joined without their
+// length bytes, into nPixels color indices. Codes after the table is full
+// are accepted until the encoder sends a clear code (deferred clear).
+func (dec *LZWDecoder) Decode(data []byte, nPixels int) ([]byte, error) {
+	minCodeSize := dec.minCodeSize
+	if minCodeSize < 2 || minCodeSize > 8 {
+		return nil, errors.New("lzw: invalid minimum code size")
+	}
+
+	clearCode := 1 << minCodeSize
+	eofCode := clearCode + 1
+
+	// prefix/suffix tables, each code is a previous code plus one byte
+	prefix := make([]int, 1<<BITS)
+	suffix := make([]byte, 1<<BITS)
+	stack := make([]byte, 0, 1<<BITS)
+	for i := 0; i < clearCode; i++ {
+		suffix[i] = byte(i)
+	}
+
+	out := make([]byte, 0, nPixels)
+	nBits := minCodeSize + 1
+	freeEnt := clearCode + 2
+	prev := -1
+	var first byte
+
+	accum, accBits, pos := 0, 0, 0
+	for {
+		for accBits < nBits {
+			if pos >= len(data) {
+				if len(out) < nPixels {
+					return out, errLZWNotEnough
+				}
+				return out, nil
+			}
+			accum |= int(data[pos]) << accBits
+			pos++
+			accBits += 8
+		}
+		code := accum & masks[nBits]
+		accum >>= nBits
+		accBits -= nBits
+
+		switch {
+		case code == clearCode:
+			nBits = minCodeSize + 1
+			freeEnt = clearCode + 2
+			prev = -1
+			continue
+		case code == eofCode:
+			if len(out) < nPixels {
+				return out, errLZWNotEnough
+			}
+			return out, nil
+		case prev < 0:
+			if code >= clearCode {
+				return out, errLZWInvalidCode
+			}
+			first = byte(code)
+			out = append(out, first)
+			prev = code
+			continue
+		case code > freeEnt:
+			return out, errLZWInvalidCode
+		}
+
+		// code == freeEnt is the KwKwK case: previous string plus its first byte
+		c := code
+		stack = stack[:0]
+		if code == freeEnt {
+			stack = append(stack, first)
+			c = prev
+		}
+		for c >= clearCode {
+			stack = append(stack, suffix[c])
+			c = prefix[c]
+		}
+		first = byte(c)
+		stack = append(stack, first)
+		for i := len(stack) - 1; i >= 0; i-- {
+			out = append(out, stack[i])
+		}
+		if len(out) > nPixels {
+			return out[:nPixels], errLZWTooMuchData
+		}
+
+		// once the table is full the encoder may keep sending codes without a
+		// clear (deferred clear), so stop adding entries
+		if freeEnt < 1<<BITS {
+			prefix[freeEnt] = prev
+			suffix[freeEnt] = first
+			freeEnt++
+			if freeEnt == 1<<nBits && nBits < BITS {
+				nBits++
+			}
+		}
+		prev = code
+	}
+}
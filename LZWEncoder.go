@@ -24,10 +24,25 @@ Joe Orost (decvax!vax135!petsd!joe)
 (Go port 2024)
 */
 
+import (
+	"fmt"
+	"math/bits"
+)
+
 const (
 	EOF   = -1
 	BITS  = 12
 	HSIZE = 5003 // 80% occupancy
+
+	// minHashSize and maxHashSize bound the hash table sizes accepted by
+	// NewLZWEncoderWithOptions: the table must hold all 4096 codes, and
+	// the hash function uses at most 20 bits
+	minHashSize = 4099
+	maxHashSize = 1 << 20
+
+	// checkGap is the number of pixels between compression ratio checks
+	// once the code table is full and the clear code is deferred
+	checkGap = 10000
 )
 
 var masks = []int{
@@ -44,9 +59,14 @@ type LZWEncoder struct {
 	initCodeSize int
 	remaining    int
 	curPixel     int
+	deferClear   bool // keep a full code table until compression degrades
+	clearCount   int  // clear codes written by the last Encode
+	hsize        int  // hash table size, a prime
 }
 
 // NewLZWEncoder creates a new LZW encoder
+// colorDepth: bits per pixel of the color table, the minimum code size
+// written to the stream is colorDepth but at least 2 as GIF requires
 func NewLZWEncoder(width, height int, pixels []byte, colorDepth int) *LZWEncoder {
 	initCodeSize := colorDepth
 	if initCodeSize < 2 {
@@ -60,7 +80,54 @@ func NewLZWEncoder(width, height int, pixels []byte, colorDepth int) *LZWEncoder
 		initCodeSize: initCodeSize,
 		remaining:    width * height,
 		curPixel:     0,
+		hsize:        HSIZE,
+	}
+}
+
+// NewLZWEncoderWithOptions creates a new LZW encoder like NewLZWEncoder
+// with a hash table of hsize entries, 0 for the default HSIZE. A larger
+// table has fewer collisions, which speeds up compressing large frames,
+// a smaller one saves memory; the output is the same either way. hsize
+// must be a prime between 4099 and 1048576 so the table holds every
+// code and probing visits every slot.
+func NewLZWEncoderWithOptions(width, height int, pixels []byte, colorDepth int, hsize int) (*LZWEncoder, error) {
+	if hsize == 0 {
+		hsize = HSIZE
+	}
+	if hsize < minHashSize || hsize > maxHashSize || !isPrime(hsize) {
+		return nil, fmt.Errorf("invalid hash table size %d, expected a prime between %d and %d", hsize, minHashSize, maxHashSize)
+	}
+	enc := NewLZWEncoder(width, height, pixels, colorDepth)
+	enc.hsize = hsize
+	return enc, nil
+}
+
+// isPrime reports whether n is a prime number
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
 	}
+	return true
+}
+
+// SetDeferredClear controls what happens when the code table is full. By
+// default the table is cleared right away. With deferClear the encoder
+// keeps emitting 12-bit codes from the full table and only clears it once
+// the compression ratio stops improving, which usually gives smaller
+// output for repetitive images.
+func (enc *LZWEncoder) SetDeferredClear(deferClear bool) {
+	enc.deferClear = deferClear
+}
+
+// ClearCount returns the number of clear codes the last Encode wrote,
+// including the one starting the stream
+func (enc *LZWEncoder) ClearCount() int {
+	return enc.clearCount
 }
 
 // Encode encodes and writes pixel data to the output stream
@@ -68,6 +135,7 @@ func (enc *LZWEncoder) Encode(out *ByteArray) {
 	out.WriteByte(byte(enc.initCodeSize))  // write "initial code size" byte
 	enc.remaining = enc.width * enc.height // reset navigation variables
 	enc.curPixel = 0
+	enc.clearCount = 0
 	enc.compress(enc.initCodeSize+1, out) // compress and write the pixel data
 	out.WriteByte(0)                      // write block terminator
 }
@@ -114,15 +182,26 @@ func (enc *LZWEncoder) compress(initBits int, out *ByteArray) {
 	curAccum := 0
 	curBits := 0
 
+	// 延迟清除时用于计算压缩率
+	inCount := 0
+	outCount := 0
+	checkpoint := checkGap
+	ratio := 0
+
 	accum := make([]byte, 256)
-	htab := make([]int, HSIZE)
-	codetab := make([]int, HSIZE)
+	hsize := enc.hsize
+	if hsize == 0 {
+		hsize = HSIZE
+	}
+	htab := make([]int, hsize)
+	codetab := make([]int, hsize)
 
 	// Flush the packet to disk, and reset the accumulator
 	flushChar := func() {
 		if aCount > 0 {
 			out.WriteByte(byte(aCount))
 			out.WriteBytes(accum[:aCount])
+			outCount += aCount + 1
 			aCount = 0
 		}
 	}
@@ -192,25 +271,30 @@ func (enc *LZWEncoder) compress(initBits int, out *ByteArray) {
 
 	// table clear for block compress
 	clBlock := func() {
-		clHash(HSIZE)
+		clHash(hsize)
 		freeEnt = clearCode + 2
 		clearFlg = true
 		output(clearCode)
+		enc.clearCount++
 	}
 
 	// Set up the necessary values
 	ent = enc.nextPixel()
 
-	hshift = 0
-	for fcode = HSIZE; fcode < 65536; fcode *= 2 {
-		hshift++
-	}
-	hshift = 8 - hshift // set hash code range bound
+	// set hash code range bound: c << hshift ^ ent must stay below hsize,
+	// for HSIZE this is the original 8 - (doublings of HSIZE to 65536) = 4
+	hshift = bits.Len(uint(hsize)) - 1 - 8
 
-	hsizeReg = HSIZE
+	hsizeReg = hsize
 	clHash(hsizeReg) // clear hash table
 
 	output(clearCode)
+	enc.clearCount++
+	if ent == EOF {
+		// no pixels, the stream is just a clear and an end code
+		output(eofCode)
+		return
+	}
 
 outerLoop:
 	for {
@@ -218,6 +302,7 @@ outerLoop:
 		if c == EOF {
 			break
 		}
+		inCount++
 
 		fcode = (c << BITS) + ent
 		i = (c << hshift) ^ ent // xor hashing
@@ -255,8 +340,18 @@ outerLoop:
 			codetab[i] = freeEnt // code -> hashtable
 			freeEnt++
 			htab[i] = fcode
-		} else {
+		} else if !enc.deferClear {
 			clBlock()
+		} else if inCount >= checkpoint {
+			// clear only once the ratio of pixels to output bytes drops
+			checkpoint = inCount + checkGap
+			rat := (inCount << 8) / (outCount + aCount + 1)
+			if rat > ratio {
+				ratio = rat
+			} else {
+				ratio = 0
+				clBlock()
+			}
 		}
 	}
 
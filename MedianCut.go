@@ -0,0 +1,258 @@
+package gifencoder
+
+import "slices"
+
+// colorCount is a distinct color together with its number of occurrences
+type colorCount struct {
+	r, g, b byte
+	count   int
+	pos     int // position in the sorted distinct colors
+}
+
+// colorBox is a set of distinct colors covered by a single palette entry,
+// with its widest channel cached when the box is created
+type colorBox struct {
+	colors []colorCount
+	axis   int // channel with the widest range, 0=r, 1=g, 2=b
+	rng    int // range of that channel
+}
+
+// MedianCutQuantizer reduces colors by recursively splitting the color
+// space at the weighted median of its longest axis. Images with no more
+// distinct colors than the target are reproduced exactly.
+type MedianCutQuantizer struct {
+	pixels    []byte   // the input image in RGB format
+	maxColors int      // palette size target 1..256
+	colormap  []byte   // resulting palette [r,g,b,r,g,b,...]
+	keys      []uint32 // sorted distinct input colors, packed by packRGB
+	keyIndex  []byte   // palette index of each entry of keys
+}
+
+// NewMedianCutQuantizer creates a new median-cut quantizer
+// pixels: array of pixels in RGB format [r,g,b,r,g,b,...]
+// maxColors: maximum number of palette entries (1-256)
+func NewMedianCutQuantizer(pixels []byte, maxColors int) *MedianCutQuantizer {
+	if maxColors < 1 || maxColors > 256 {
+		maxColors = 256
+	}
+	return &MedianCutQuantizer{
+		pixels:    pixels,
+		maxColors: maxColors,
+	}
+}
+
+// BuildColormap builds the color map
+func (mc *MedianCutQuantizer) BuildColormap() {
+	// distinct colors in packed order, which keeps the palette reproducible
+	keys := make([]uint32, 0, len(mc.pixels)/3)
+	for i := 0; i+2 < len(mc.pixels); i += 3 {
+		keys = append(keys, packRGB(mc.pixels[i], mc.pixels[i+1], mc.pixels[i+2]))
+	}
+	radixSortRGB(keys)
+
+	var colors []colorCount
+	mc.keys = nil
+	for i := 0; i < len(keys); {
+		j := i + 1
+		for j < len(keys) && keys[j] == keys[i] {
+			j++
+		}
+		colors = append(colors, colorCount{
+			r:     byte(keys[i] >> 16),
+			g:     byte(keys[i] >> 8),
+			b:     byte(keys[i]),
+			count: j - i,
+			pos:   len(mc.keys),
+		})
+		mc.keys = append(mc.keys, keys[i])
+		i = j
+	}
+
+	var boxes []colorBox
+	if len(colors) > 0 {
+		boxes = mc.split(newColorBox(colors))
+	}
+
+	mc.colormap = make([]byte, 0, len(boxes)*3)
+	mc.keyIndex = make([]byte, len(mc.keys))
+	for i, box := range boxes {
+		r, g, b := box.average()
+		mc.colormap = append(mc.colormap, r, g, b)
+		for _, c := range box.colors {
+			mc.keyIndex[c.pos] = byte(i)
+		}
+	}
+
+	// gc
+	mc.pixels = nil
+}
+
+// split cuts the color set into at most maxColors boxes
+func (mc *MedianCutQuantizer) split(box colorBox) []colorBox {
+	boxes := []colorBox{box}
+	buf := make([]colorCount, len(box.colors))
+
+	for len(boxes) < mc.maxColors {
+		// pick the splittable box with the widest channel range
+		best := -1
+		bestRange := -1
+		for i, box := range boxes {
+			if len(box.colors) >= 2 && box.rng > bestRange {
+				best = i
+				bestRange = box.rng
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		lo, hi := boxes[best].cut(buf)
+		boxes[best] = lo
+		boxes = append(boxes, hi)
+	}
+	return boxes
+}
+
+// newColorBox creates a box over colors and finds its widest channel
+func newColorBox(colors []colorCount) colorBox {
+	var lo, hi [3]int
+	lo = [3]int{255, 255, 255}
+	for _, c := range colors {
+		v := [3]int{int(c.r), int(c.g), int(c.b)}
+		for a := 0; a < 3; a++ {
+			if v[a] < lo[a] {
+				lo[a] = v[a]
+			}
+			if v[a] > hi[a] {
+				hi[a] = v[a]
+			}
+		}
+	}
+
+	axis := 0
+	for a := 1; a < 3; a++ {
+		if hi[a]-lo[a] > hi[axis]-lo[axis] {
+			axis = a
+		}
+	}
+	return colorBox{colors: colors, axis: axis, rng: hi[axis] - lo[axis]}
+}
+
+// channel returns the value of c on the box's widest channel
+func (box colorBox) channel(c colorCount) byte {
+	switch box.axis {
+	case 0:
+		return c.r
+	case 1:
+		return c.g
+	}
+	return c.b
+}
+
+// cut splits the box at the weighted median along its widest channel. The
+// colors are ordered by a counting sort on that channel, which is stable,
+// so equal values keep their order and the palette stays reproducible.
+// buf must hold at least len(box.colors) entries.
+func (box colorBox) cut(buf []colorCount) (colorBox, colorBox) {
+	var start [257]int
+	total := 0
+	for _, c := range box.colors {
+		start[int(box.channel(c))+1]++
+		total += c.count
+	}
+	for v := 1; v < 257; v++ {
+		start[v] += start[v-1]
+	}
+	sorted := buf[:len(box.colors)]
+	for _, c := range box.colors {
+		v := box.channel(c)
+		sorted[start[v]] = c
+		start[v]++
+	}
+	copy(box.colors, sorted)
+
+	// first index where the cumulative count passes half, never empty on either side
+	acc := 0
+	at := 1
+	for i, c := range box.colors[:len(box.colors)-1] {
+		acc += c.count
+		at = i + 1
+		if acc*2 >= total {
+			break
+		}
+	}
+
+	return newColorBox(box.colors[:at]), newColorBox(box.colors[at:])
+}
+
+// average returns the count-weighted mean color of the box
+func (box colorBox) average() (byte, byte, byte) {
+	var r, g, b, n int
+	for _, c := range box.colors {
+		r += int(c.r) * c.count
+		g += int(c.g) * c.count
+		b += int(c.b) * c.count
+		n += c.count
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	return byte((r + n/2) / n), byte((g + n/2) / n), byte((b + n/2) / n)
+}
+
+// GetColormap returns the color map as byte array [r,g,b,r,g,b,...]
+func (mc *MedianCutQuantizer) GetColormap() []byte {
+	result := make([]byte, len(mc.colormap))
+	copy(result, mc.colormap)
+	return result
+}
+
+// LookupRGB looks for the closest r, g, b color in the map and returns its index
+func (mc *MedianCutQuantizer) LookupRGB(r, g, b byte) int {
+	if pos, ok := slices.BinarySearch(mc.keys, packRGB(r, g, b)); ok {
+		return int(mc.keyIndex[pos])
+	}
+
+	minpos := 0
+	dmin := 256 * 256 * 256
+	for i, index := 0, 0; i+2 < len(mc.colormap); i, index = i+3, index+1 {
+		dr := int(r) - int(mc.colormap[i])
+		dg := int(g) - int(mc.colormap[i+1])
+		db := int(b) - int(mc.colormap[i+2])
+		d := dr*dr + dg*dg + db*db
+		if d < dmin {
+			dmin = d
+			minpos = index
+		}
+	}
+	return minpos
+}
+
+// radixSortRGB sorts colors packed by packRGB with one counting pass per
+// channel, much faster than a comparison sort for whole frames
+func radixSortRGB(keys []uint32) {
+	buf := make([]uint32, len(keys))
+	src, dst := keys, buf
+	for shift := 0; shift < 24; shift += 8 {
+		var start [257]int
+		for _, k := range src {
+			start[int(k>>shift&0xff)+1]++
+		}
+		for v := 1; v < 257; v++ {
+			start[v] += start[v-1]
+		}
+		for _, k := range src {
+			v := k >> shift & 0xff
+			dst[start[v]] = k
+			start[v]++
+		}
+		src, dst = dst, src
+	}
+	// three passes leave the result in buf
+	copy(keys, src)
+}
+
+// packRGB packs a color into a single map key
+func packRGB(r, g, b byte) uint32 {
+	return uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+}
@@ -0,0 +1,58 @@
+package gifencoder
+
+// defaultMonoThreshold is the luma threshold used when none is given
+const defaultMonoThreshold = 128
+
+// MonoOptions configures 1-bit black and white output
+type MonoOptions struct {
+	Threshold int  // luma (1-255) at or above which a pixel turns white, 0 = 128
+	Dither    bool // use Floyd-Steinberg dithering for a halftone effect
+}
+
+// monoQuantizer maps colors to black or white by comparing their luma
+// against a threshold
+type monoQuantizer struct {
+	threshold int
+}
+
+// BuildColormap does nothing, the palette is fixed
+func (q monoQuantizer) BuildColormap() {}
+
+// GetColormap returns the black and white palette
+func (q monoQuantizer) GetColormap() []byte {
+	return []byte{0, 0, 0, 255, 255, 255}
+}
+
+// LookupRGB returns 1 (white) when the luma of r, g, b reaches the threshold
+func (q monoQuantizer) LookupRGB(r, g, b byte) int {
+	if luma(r, g, b) >= float64(q.threshold) {
+		return 1
+	}
+	return 0
+}
+
+// SetMonochrome quantizes every frame to a 2-entry black and white global
+// palette, producing 1-bit color tables and the minimum LZW code size.
+// Pass nil to go back to color output.
+func (ge *GIFEncoder) SetMonochrome(opts *MonoOptions) {
+	ge.clearFixedPalette()
+	if opts == nil {
+		return
+	}
+
+	mono := *opts
+	if mono.Threshold <= 0 {
+		mono.Threshold = defaultMonoThreshold
+	}
+	if mono.Threshold > 255 {
+		mono.Threshold = 255
+	}
+	ge.monochrome = &mono
+	ge.setFixedPalette(monoQuantizer{threshold: mono.Threshold})
+
+	if mono.Dither {
+		ge.SetDither(DitherFloydSteinberg)
+	} else {
+		ge.SetDither(DitherNone)
+	}
+}
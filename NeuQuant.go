@@ -24,6 +24,13 @@ that this copyright notice remain intact.
 (Go port 2024)
 */
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+)
+
 const (
 	ncycles         = 100 // number of learning cycles
 	netsize         = 256 // number of colors used
@@ -52,6 +59,8 @@ const (
 	prime3          = 487
 	prime4          = 503
 	minpicturebytes = 3 * prime4
+
+	ctxcheckinterval = 4096 // samples between context checks in learn
 )
 
 // NeuQuant is a neural network color quantizer
@@ -96,14 +105,23 @@ func (nq *NeuQuant) init() {
 // 3. removes misconceptions
 // 4. builds colorindex
 func (nq *NeuQuant) BuildColormap() {
+	nq.BuildColormapContext(context.Background())
+}
+
+// BuildColormapContext is like BuildColormap but aborts the learning loop
+// and returns ctx.Err() once ctx is done
+func (nq *NeuQuant) BuildColormapContext(ctx context.Context) error {
 	nq.init()
-	nq.learn()
+	if err := nq.learn(ctx); err != nil {
+		return err
+	}
 
 	// gc
 	nq.pixels = nil
 
 	nq.unbiasnet()
 	nq.inxbuild()
+	return nil
 }
 
 // GetColormap returns the color map as byte array [r,g,b,r,g,b,...]
@@ -128,6 +146,11 @@ func (nq *NeuQuant) GetColormap() []byte {
 	return colormap
 }
 
+// GetPalette returns the color map as a color.Palette
+func (nq *NeuQuant) GetPalette() color.Palette {
+	return colormapToPalette(nq.GetColormap(), -1)
+}
+
 // LookupRGB looks for the closest r, g, b color in the map and returns its index
 func (nq *NeuQuant) LookupRGB(r, g, b byte) int {
 	// 注意：虽然 inxsearch 的参数名是 (b, g, r)，但实际期望的是 RGB 顺序
@@ -135,6 +158,29 @@ func (nq *NeuQuant) LookupRGB(r, g, b byte) int {
 	return nq.inxsearch(int32(r), int32(g), int32(b))
 }
 
+// OverrideColor replaces palette entry index with r, g, b after
+// BuildColormap, e.g. to snap a near gray to neutral or to put in an exact
+// brand color, and rebuilds the lookup so LookupRGB returns index for the
+// colors now closest to it
+func (nq *NeuQuant) OverrideColor(index int, r, g, b byte) error {
+	if nq.network[0] == nil {
+		return errors.New("colormap not built")
+	}
+	if index < 0 || index >= netsize {
+		return fmt.Errorf("palette index %d out of range 0-%d", index, maxnetpos)
+	}
+
+	for _, p := range nq.network {
+		if int(p[3]) == index {
+			p[0], p[1], p[2] = int32(r), int32(g), int32(b)
+			break
+		}
+	}
+	// 网络按 g 排序, 修改后需要重建索引
+	nq.inxbuild()
+	return nil
+}
+
 // unbiasnet unbiases network to give byte values 0..255 and record position i to prepare for sort
 func (nq *NeuQuant) unbiasnet() {
 	for i := 0; i < netsize; i++ {
@@ -219,8 +265,12 @@ func (nq *NeuQuant) contest(b, g, r int32) int {
 }
 
 // learn is the main learning loop
-func (nq *NeuQuant) learn() {
+func (nq *NeuQuant) learn(ctx context.Context) error {
 	lengthcount := len(nq.pixels)
+	if lengthcount < minpicturebytes {
+		// small inputs are learned from every pixel
+		nq.samplefac = 1
+	}
 	alphadec := int32(30 + ((nq.samplefac - 1) / 3))
 	samplepixels := lengthcount / (3 * nq.samplefac)
 	delta := samplepixels / ncycles
@@ -242,7 +292,6 @@ func (nq *NeuQuant) learn() {
 
 	var step int
 	if lengthcount < minpicturebytes {
-		nq.samplefac = 1
 		step = 3
 	} else if lengthcount%prime1 != 0 {
 		step = 3 * prime1
@@ -276,6 +325,12 @@ func (nq *NeuQuant) learn() {
 
 		i++
 
+		if i%ctxcheckinterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
 		if i%delta == 0 {
 			alpha -= alpha / alphadec
 			radius -= radius / radiusdec
@@ -289,6 +344,7 @@ func (nq *NeuQuant) learn() {
 			}
 		}
 	}
+	return nil
 }
 
 // inxbuild sorts network and builds netindex[0..255]
@@ -0,0 +1,187 @@
+package gifencoder
+
+// octreeDepth is the number of levels below the root, one per bit of a channel
+const octreeDepth = 8
+
+// octreeMaxLeaves bounds the number of leaves kept while the tree is built,
+// nodes are merged early once it is exceeded
+const octreeMaxLeaves = 4096
+
+// octreeNode is a cube of the RGB space. Leaves accumulate the colors that
+// fall inside them.
+type octreeNode struct {
+	r, g, b  int // channel sums of the pixels in a leaf
+	count    int // number of pixels below the node
+	leaf     bool
+	index    int // palette index of a leaf
+	children [8]*octreeNode
+}
+
+// OctreeQuantizer reduces colors by building an octree of the frame's
+// colors and merging the least used nodes until at most maxColors leaves
+// remain. The palette only depends on the pixels, and images with no more
+// distinct colors than the target are reproduced exactly.
+type OctreeQuantizer struct {
+	pixels    []byte                     // the input image in RGB format
+	maxColors int                        // palette size target 1..256
+	colormap  []byte                     // resulting palette [r,g,b,r,g,b,...]
+	root      *octreeNode                // tree over all colors of the frame
+	levels    [octreeDepth][]*octreeNode // inner nodes per level, merge candidates
+	leaves    int                        // number of leaves in the tree
+}
+
+// NewOctreeQuantizer creates a new octree quantizer
+// pixels: array of pixels in RGB format [r,g,b,r,g,b,...]
+// maxColors: maximum number of palette entries (1-256)
+func NewOctreeQuantizer(pixels []byte, maxColors int) *OctreeQuantizer {
+	if maxColors < 1 || maxColors > 256 {
+		maxColors = 256
+	}
+	return &OctreeQuantizer{
+		pixels:    pixels,
+		maxColors: maxColors,
+	}
+}
+
+// BuildColormap builds the color map
+func (oq *OctreeQuantizer) BuildColormap() {
+	oq.root = &octreeNode{}
+	oq.levels = [octreeDepth][]*octreeNode{{oq.root}}
+	oq.leaves = 0
+
+	for i := 0; i+2 < len(oq.pixels); i += 3 {
+		oq.insert(oq.pixels[i], oq.pixels[i+1], oq.pixels[i+2])
+		for oq.leaves > octreeMaxLeaves {
+			oq.reduce()
+		}
+	}
+	for oq.leaves > oq.maxColors {
+		oq.reduce()
+	}
+
+	oq.colormap = make([]byte, 0, oq.leaves*3)
+	oq.collect(oq.root)
+
+	// gc
+	oq.pixels = nil
+	oq.levels = [octreeDepth][]*octreeNode{}
+}
+
+// insert adds one pixel to the tree
+func (oq *OctreeQuantizer) insert(r, g, b byte) {
+	node := oq.root
+	for level := 0; ; level++ {
+		node.count++
+		if node.leaf {
+			node.r += int(r)
+			node.g += int(g)
+			node.b += int(b)
+			return
+		}
+
+		i := octreeChild(r, g, b, level)
+		if node.children[i] == nil {
+			child := &octreeNode{}
+			if level+1 == octreeDepth {
+				child.leaf = true
+				oq.leaves++
+			} else {
+				oq.levels[level+1] = append(oq.levels[level+1], child)
+			}
+			node.children[i] = child
+		}
+		node = node.children[i]
+	}
+}
+
+// reduce merges the children of the least used node on the deepest level
+// that has inner nodes into a single leaf
+func (oq *OctreeQuantizer) reduce() {
+	level := octreeDepth - 1
+	for level > 0 && len(oq.levels[level]) == 0 {
+		level--
+	}
+	nodes := oq.levels[level]
+	if len(nodes) == 0 {
+		return
+	}
+
+	// 选择像素最少的节点, 相同时取最早插入的
+	pick := 0
+	for i, node := range nodes {
+		if node.count < nodes[pick].count {
+			pick = i
+		}
+	}
+	node := nodes[pick]
+	oq.levels[level] = append(nodes[:pick], nodes[pick+1:]...)
+
+	merged := 0
+	for i, child := range node.children {
+		if child == nil {
+			continue
+		}
+		node.r += child.r
+		node.g += child.g
+		node.b += child.b
+		node.children[i] = nil
+		merged++
+	}
+	node.leaf = true
+	oq.leaves -= merged - 1
+}
+
+// collect assigns palette indices to the leaves below node in tree order
+func (oq *OctreeQuantizer) collect(node *octreeNode) {
+	if node.leaf {
+		node.index = len(oq.colormap) / 3
+		n := node.count
+		oq.colormap = append(oq.colormap,
+			byte((node.r+n/2)/n), byte((node.g+n/2)/n), byte((node.b+n/2)/n))
+		return
+	}
+	for _, child := range node.children {
+		if child != nil {
+			oq.collect(child)
+		}
+	}
+}
+
+// octreeChild returns the child slot of a color on the given level
+func octreeChild(r, g, b byte, level int) int {
+	shift := uint(octreeDepth - 1 - level)
+	return int((r>>shift)&1)<<2 | int((g>>shift)&1)<<1 | int((b>>shift)&1)
+}
+
+// GetColormap returns the color map as byte array [r,g,b,r,g,b,...]
+func (oq *OctreeQuantizer) GetColormap() []byte {
+	result := make([]byte, len(oq.colormap))
+	copy(result, oq.colormap)
+	return result
+}
+
+// LookupRGB looks for the closest r, g, b color in the map and returns its index
+func (oq *OctreeQuantizer) LookupRGB(r, g, b byte) int {
+	node := oq.root
+	for level := 0; node != nil; level++ {
+		if node.leaf {
+			return node.index
+		}
+		node = node.children[octreeChild(r, g, b, level)]
+	}
+
+	// the color's cube holds no pixels of the frame, fall back to a search
+	minpos := 0
+	dmin := 256 * 256 * 256
+	for i, index := 0, 0; i+2 < len(oq.colormap); i, index = i+3, index+1 {
+		dr := int(r) - int(oq.colormap[i])
+		dg := int(g) - int(oq.colormap[i+1])
+		db := int(b) - int(oq.colormap[i+2])
+		d := dr*dr + dg*dg + db*db
+		if d < dmin {
+			dmin = d
+			minpos = index
+		}
+	}
+	return minpos
+}
@@ -0,0 +1,89 @@
+package gifencoder
+
+import "sort"
+
+// popularityBits is the number of bits per channel of a histogram cell
+const popularityBits = 5
+
+// PopularityQuantizer is the fastest built-in quantizer, meant for
+// previews: it counts the pixels in a 32x32x32 RGB histogram and uses the
+// average color of the most populated cells as the palette. Small areas of
+// a distinct color lose out to large ones, so prefer NeuQuant or median
+// cut for final output.
+type PopularityQuantizer struct {
+	pixels    []byte  // the input image in RGB format
+	maxColors int     // palette size target 1..256
+	colormap  []byte  // resulting palette [r,g,b,r,g,b,...]
+	tree      *kdTree // nearest color search over colormap
+}
+
+// NewPopularityQuantizer creates a new popularity quantizer
+// pixels: array of pixels in RGB format [r,g,b,r,g,b,...]
+// maxColors: maximum number of palette entries (1-256)
+func NewPopularityQuantizer(pixels []byte, maxColors int) *PopularityQuantizer {
+	if maxColors < 1 || maxColors > 256 {
+		maxColors = 256
+	}
+	return &PopularityQuantizer{
+		pixels:    pixels,
+		maxColors: maxColors,
+	}
+}
+
+// BuildColormap builds the color map
+func (pq *PopularityQuantizer) BuildColormap() {
+	const cells = 1 << (3 * popularityBits)
+	const shift = 8 - popularityBits
+
+	counts := make([]int, cells)
+	sums := make([][3]int, cells)
+	for i := 0; i+2 < len(pq.pixels); i += 3 {
+		r, g, b := pq.pixels[i], pq.pixels[i+1], pq.pixels[i+2]
+		cell := int(r>>shift)<<(2*popularityBits) | int(g>>shift)<<popularityBits | int(b>>shift)
+		counts[cell]++
+		sums[cell][0] += int(r)
+		sums[cell][1] += int(g)
+		sums[cell][2] += int(b)
+	}
+
+	used := make([]int, 0, 256)
+	for cell, n := range counts {
+		if n > 0 {
+			used = append(used, cell)
+		}
+	}
+	// 按像素数降序, 相同时按单元格顺序
+	sort.SliceStable(used, func(a, b int) bool {
+		return counts[used[a]] > counts[used[b]]
+	})
+	if len(used) > pq.maxColors {
+		used = used[:pq.maxColors]
+	}
+
+	pq.colormap = make([]byte, 0, len(used)*3)
+	for _, cell := range used {
+		n := counts[cell]
+		s := sums[cell]
+		pq.colormap = append(pq.colormap, byte((s[0]+n/2)/n), byte((s[1]+n/2)/n), byte((s[2]+n/2)/n))
+	}
+	if len(pq.colormap) == 0 {
+		// no pixels, keep a single black entry
+		pq.colormap = append(pq.colormap, 0, 0, 0)
+	}
+	pq.tree = newKDTree(pq.colormap)
+
+	// gc
+	pq.pixels = nil
+}
+
+// GetColormap returns the color map as byte array [r,g,b,r,g,b,...]
+func (pq *PopularityQuantizer) GetColormap() []byte {
+	result := make([]byte, len(pq.colormap))
+	copy(result, pq.colormap)
+	return result
+}
+
+// LookupRGB looks for the closest r, g, b color in the map and returns its index
+func (pq *PopularityQuantizer) LookupRGB(r, g, b byte) int {
+	return pq.tree.nearest(r, g, b)
+}
@@ -0,0 +1,142 @@
+package gifencoder
+
+import (
+	"context"
+	"image/color"
+)
+
+// Quantizer reduces the colors of a frame to a palette of at most 256 entries
+type Quantizer interface {
+	// BuildColormap computes the palette
+	BuildColormap()
+	// GetColormap returns the palette as byte array [r,g,b,r,g,b,...]
+	GetColormap() []byte
+	// LookupRGB returns the palette index closest to r, g, b
+	LookupRGB(r, g, b byte) int
+}
+
+// contextQuantizer is implemented by quantizers whose BuildColormap can be
+// cancelled
+type contextQuantizer interface {
+	BuildColormapContext(ctx context.Context) error
+}
+
+// QuantizerFactory creates a Quantizer for a single frame
+// pixels: array of pixels in RGB format [r,g,b,r,g,b,...], the buffer is
+// reused for the next frame so it must not be kept after BuildColormap
+// sample: sampling factor set with SetQuality
+type QuantizerFactory func(pixels []byte, sample int) Quantizer
+
+// QuantizerMethod selects a built-in color quantization algorithm
+type QuantizerMethod string
+
+const (
+	QuantizerNeuQuant   QuantizerMethod = "NeuQuant"
+	QuantizerMedianCut  QuantizerMethod = "MedianCut"
+	QuantizerOctree     QuantizerMethod = "Octree"
+	QuantizerPopularity QuantizerMethod = "Popularity"
+	QuantizerWebSafe    QuantizerMethod = "WebSafe"
+)
+
+// buildColormap builds q's palette, honoring ctx when q supports it
+func buildColormap(ctx context.Context, q Quantizer) error {
+	if cq, ok := q.(contextQuantizer); ok {
+		return cq.BuildColormapContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	q.BuildColormap()
+	return nil
+}
+
+// adjustedQuantizer post-processes the palette of another quantizer: it
+// reduces a palette larger than maxColors by a median cut over it, for
+// quantizers that can't be given a size such as NeuQuant, and then puts in
+// the forced colors
+type adjustedQuantizer struct {
+	Quantizer
+	maxColors   int          // palette size target 1..256
+	forceColors []color.RGBA // exact colors the palette must contain
+	colormap    []byte       // adjusted palette [r,g,b,r,g,b,...]
+	tree        *kdTree      // nearest color search over colormap
+}
+
+// BuildColormap builds the palette of the wrapped quantizer and adjusts it
+func (aq *adjustedQuantizer) BuildColormap() {
+	aq.Quantizer.BuildColormap()
+	aq.adjust()
+}
+
+// BuildColormapContext is BuildColormap honoring ctx when the wrapped
+// quantizer supports it
+func (aq *adjustedQuantizer) BuildColormapContext(ctx context.Context) error {
+	if err := buildColormap(ctx, aq.Quantizer); err != nil {
+		return err
+	}
+	aq.adjust()
+	return nil
+}
+
+func (aq *adjustedQuantizer) adjust() {
+	colormap := aq.Quantizer.GetColormap()
+	if len(colormap)/3 > aq.maxColors {
+		mc := NewMedianCutQuantizer(colormap, aq.maxColors)
+		mc.BuildColormap()
+		colormap = mc.GetColormap()
+	}
+	aq.colormap = forcePaletteColors(colormap, aq.forceColors, aq.maxColors)
+	aq.tree = newKDTree(aq.colormap)
+}
+
+// GetColormap returns the adjusted palette
+func (aq *adjustedQuantizer) GetColormap() []byte {
+	return aq.colormap
+}
+
+// LookupRGB returns the index of the adjusted palette entry closest to r, g, b
+func (aq *adjustedQuantizer) LookupRGB(r, g, b byte) int {
+	return aq.tree.nearest(r, g, b)
+}
+
+// forcePaletteColors returns a copy of colormap containing every color of
+// force that fits. Colors already present are kept, the others are added
+// while the palette has fewer than maxColors entries and then replace the
+// closest entry that isn't itself forced.
+func forcePaletteColors(colormap []byte, force []color.RGBA, maxColors int) []byte {
+	if len(force) == 0 {
+		return colormap
+	}
+	out := append(make([]byte, 0, maxColors*3), colormap...)
+	forced := make([]bool, maxColors)
+
+	for _, c := range force {
+		best, bestDist := -1, -1
+		for i := 0; i+2 < len(out); i += 3 {
+			dr := int(out[i]) - int(c.R)
+			dg := int(out[i+1]) - int(c.G)
+			db := int(out[i+2]) - int(c.B)
+			d := dr*dr + dg*dg + db*db
+			if d == 0 {
+				best, bestDist = i/3, 0
+				break
+			}
+			if !forced[i/3] && (bestDist < 0 || d < bestDist) {
+				best, bestDist = i/3, d
+			}
+		}
+
+		switch {
+		case bestDist == 0:
+			forced[best] = true
+		case len(out)/3 < maxColors:
+			// 还有空位, 直接追加
+			forced[len(out)/3] = true
+			out = append(out, c.R, c.G, c.B)
+		case best >= 0:
+			forced[best] = true
+			out[best*3], out[best*3+1], out[best*3+2] = c.R, c.G, c.B
+		}
+	}
+	return out
+}
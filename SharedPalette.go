@@ -0,0 +1,94 @@
+package gifencoder
+
+import (
+	"context"
+	"image"
+)
+
+// defaultSharedPaletteFrames is the number of frames sampled by
+// EncodeOptions.SharedPalette when SharedPaletteFrames is not set
+const defaultSharedPaletteFrames = 8
+
+// pendingFrame is a frame held back until the shared palette is trained,
+// together with the per-frame settings in effect when it was added
+type pendingFrame struct {
+	img             image.Image
+	delay           int
+	dispose         int
+	frameTransIndex *int
+	at              *image.Point // position passed to AddFrameAt, nil for AddFrame
+}
+
+// SetSharedPalette makes the encoder hold back the first frames, train a
+// single palette over a subsampled pool of their pixels and use it as the
+// global palette for the whole animation. This avoids the palette drift
+// and flicker of a new palette per frame at the cost of keeping up to
+// frames images in memory. Held frames are written once the palette is
+// trained or on Finish. 0 disables it; it has no effect while a global
+// palette is set.
+func (ge *GIFEncoder) SetSharedPalette(frames int) {
+	if frames < 0 {
+		frames = 0
+	}
+	ge.sharedFrames = frames
+}
+
+// holdOrFlush queues img while the shared palette is still being
+// collected, writing the queue once it is full, and reports whether img
+// was taken care of
+func (ge *GIFEncoder) holdOrFlush(ctx context.Context, img image.Image, at *image.Point) (bool, error) {
+	if ge.sharedFrames == 0 || ge.globalPalette != nil {
+		return false, nil
+	}
+	ge.pending = append(ge.pending, pendingFrame{
+		img:             img,
+		delay:           ge.delay,
+		dispose:         ge.dispose,
+		frameTransIndex: ge.frameTransIndex,
+		at:              at,
+	})
+	if len(ge.pending) < ge.sharedFrames {
+		return true, nil
+	}
+	return true, ge.flushPending(ctx)
+}
+
+// flushPending trains the shared palette over the held frames and writes
+// them with the settings they were added with
+func (ge *GIFEncoder) flushPending(ctx context.Context) error {
+	if len(ge.pending) == 0 {
+		return nil
+	}
+
+	images := make([]image.Image, len(ge.pending))
+	for i, p := range ge.pending {
+		images[i] = p.img
+	}
+	pending := ge.pending
+	ge.pending = nil
+	if err := ge.buildGlobalPalette(ctx, images); err != nil {
+		return err
+	}
+	ge.sharedTrained = true
+
+	// the held delays were resolved when the frames were added, keep
+	// applyDelays from replacing them while they are written
+	delay, delays, dispose, frameTransIndex := ge.delay, ge.delays, ge.dispose, ge.frameTransIndex
+	ge.delays = nil
+	defer func() {
+		ge.delay, ge.delays, ge.dispose, ge.frameTransIndex = delay, delays, dispose, frameTransIndex
+	}()
+	for _, p := range pending {
+		ge.delay, ge.dispose, ge.frameTransIndex = p.delay, p.dispose, p.frameTransIndex
+		var err error
+		if p.at != nil {
+			err = ge.addFrameAt(ctx, p.img, *p.at)
+		} else {
+			err = ge.AddFrameContext(ctx, p.img)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
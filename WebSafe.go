@@ -0,0 +1,39 @@
+package gifencoder
+
+// webSafeLevels is the number of levels per channel in the web-safe palette
+const webSafeLevels = 6
+
+// WebSafePalette returns the classic 216-color web-safe palette as byte
+// array [r,g,b,r,g,b,...]. Entry r*36 + g*6 + b holds the color with
+// channel levels r, g, b in 0..5, each level being a multiple of 51.
+func WebSafePalette() []byte {
+	palette := make([]byte, 0, webSafeLevels*webSafeLevels*webSafeLevels*3)
+	for r := 0; r < webSafeLevels; r++ {
+		for g := 0; g < webSafeLevels; g++ {
+			for b := 0; b < webSafeLevels; b++ {
+				palette = append(palette, byte(r*51), byte(g*51), byte(b*51))
+			}
+		}
+	}
+	return palette
+}
+
+// webSafeQuantizer maps colors to the fixed web-safe palette. The palette
+// is a regular grid, so the nearest color is found per channel.
+type webSafeQuantizer struct{}
+
+// BuildColormap does nothing, the palette is fixed
+func (webSafeQuantizer) BuildColormap() {}
+
+// GetColormap returns the web-safe palette
+func (webSafeQuantizer) GetColormap() []byte {
+	return WebSafePalette()
+}
+
+// LookupRGB returns the index of the closest web-safe color
+func (webSafeQuantizer) LookupRGB(r, g, b byte) int {
+	level := func(v byte) int {
+		return (int(v) + 25) / 51
+	}
+	return level(r)*webSafeLevels*webSafeLevels + level(g)*webSafeLevels + level(b)
+}
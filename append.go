@@ -0,0 +1,109 @@
+package gifencoder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// AppendFrames adds frames to the end of an encoded GIF without decoding or
+// re-encoding the frames it already has. The header, global color table and
+// loop settings of existing are kept. The new frames are quantized on their
+// own and written with local color tables, delays are in milliseconds as in
+// EncodeOptions, missing or non-positive ones default to 100ms. Frames of a
+// different size than the logical screen are placed at its top left corner
+// and cropped or filled as by AddFrame. A GIF87a stream is upgraded to
+// GIF89a since the new frames carry graphic control extensions.
+func AppendFrames(existing []byte, newFrames []image.Image, delays []int) ([]byte, error) {
+	width, height, end, err := scanGIF(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	ge := NewGIFEncoder(width, height)
+	defer ge.CleanupAll()
+	// 头部、逻辑屏幕和全局颜色表沿用原文件
+	ge.firstFrame = false
+	for i, img := range newFrames {
+		delay := 100 // default 100ms
+		if i < len(delays) && delays[i] > 0 {
+			delay = delays[i]
+		}
+		ge.SetDelay(delay)
+		if err := ge.AddFrame(img); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+	}
+
+	out := make([]byte, 0, end+ge.out.Len()+1)
+	out = append(out, existing[:end]...)
+	if string(out[:6]) == "GIF87a" {
+		copy(out[3:6], "89a")
+	}
+	out = append(out, ge.out.GetData()...)
+	out = append(out, gifTrailer)
+	return out, nil
+}
+
+// scanGIF walks the blocks of a GIF stream without decoding its images and
+// returns the logical screen size and the offset of the trailer
+func scanGIF(data []byte) (width, height, trailer int, err error) {
+	if len(data) < 13 {
+		return 0, 0, 0, errors.New("gif: reading header: unexpected EOF")
+	}
+	if sig := string(data[:6]); sig != "GIF87a" && sig != "GIF89a" {
+		return 0, 0, 0, fmt.Errorf("gif: invalid signature %q", sig)
+	}
+	width = int(data[6]) | int(data[7])<<8
+	height = int(data[8]) | int(data[9])<<8
+
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks 跳过数据子块直到块终止符
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			n := int(data[pos])
+			pos += n + 1
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	images := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case gifExtension:
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, 0, 0, errors.New("gif: reading extension: unexpected EOF")
+			}
+		case gifImageSeparator:
+			if pos+10 > len(data) {
+				return 0, 0, 0, errors.New("gif: reading image descriptor: unexpected EOF")
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++ // LZW minimum code size
+			if !skipSubBlocks() {
+				return 0, 0, 0, errors.New("gif: reading image data: unexpected EOF")
+			}
+			images++
+		case gifTrailer:
+			if images == 0 {
+				return 0, 0, 0, errors.New("gif: no image found")
+			}
+			return width, height, pos, nil
+		default:
+			return 0, 0, 0, fmt.Errorf("gif: unknown block type 0x%02x", data[pos])
+		}
+	}
+	return 0, 0, 0, errors.New("gif: missing trailer")
+}
@@ -0,0 +1,64 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestAppendFrames(t *testing.T) {
+	red := createStripeImage(20, 10, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})
+	green := createStripeImage(20, 10, []color.RGBA{{0, 255, 0, 255}, {255, 255, 255, 255}})
+	yellow := createStripeImage(20, 10, []color.RGBA{{255, 255, 0, 255}, {0, 0, 0, 255}})
+
+	existing, err := EncodeGIFWithOptions([]image.Image{red, green}, EncodeOptions{Repeat: 3, Delays: []int{100, 200}})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	data, err := AppendFrames(existing, []image.Image{yellow}, []int{300})
+	if err != nil {
+		t.Fatalf("AppendFrames failed: %v", err)
+	}
+	if !bytes.Equal(data[:len(existing)-1], existing[:len(existing)-1]) {
+		t.Error("expected the existing frames to be kept byte for byte")
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	if len(g.Image) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(g.Image))
+	}
+	if g.LoopCount != 3 || g.Delay[2] != 30 {
+		t.Errorf("expected loop count 3 and last delay 30, got %d and %v", g.LoopCount, g.Delay)
+	}
+	if s := parseGIFStructure(t, data); s.Frames[2].LCTSize == 0 {
+		t.Error("expected the appended frame to have a local color table")
+	}
+	r, gr, b, _ := g.Image[2].At(0, 0).RGBA()
+	if r>>8 < 240 || gr>>8 < 240 || b>>8 > 15 {
+		t.Errorf("expected the appended frame to start yellow, got %d,%d,%d", r>>8, gr>>8, b>>8)
+	}
+}
+
+func TestAppendFramesInvalid(t *testing.T) {
+	frame := []image.Image{createStripeImage(4, 4, []color.RGBA{{255, 0, 0, 255}})}
+	valid, err := EncodeGIFWithOptions(frame, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":      nil,
+		"signature":  append([]byte("PNG89a"), valid[6:]...),
+		"no trailer": valid[:len(valid)-1],
+		"truncated":  valid[:len(valid)-8],
+	} {
+		if _, err := AppendFrames(data, frame, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
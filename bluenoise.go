@@ -0,0 +1,32 @@
+package gifencoder
+
+import "sync"
+
+//go:generate go run gen_bluenoise.go
+
+// blueNoiseSize is the side of the tiled blue-noise threshold mask
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoiseMask [][]int
+)
+
+// blueNoiseMatrix returns a 64x64 blue-noise threshold mask with the ranks
+// 0..4095. The mask is generated ahead of time with the void-and-cluster
+// method (see gen_bluenoise.go) and is always the same, so like the Bayer
+// matrices it keeps static areas of an animation stable, without their
+// repeating cross-hatch pattern.
+func blueNoiseMatrix() [][]int {
+	blueNoiseOnce.Do(func() {
+		blueNoiseMask = make([][]int, blueNoiseSize)
+		for y := range blueNoiseMask {
+			row := make([]int, blueNoiseSize)
+			for x := range row {
+				row[x] = int(blueNoiseTable[y*blueNoiseSize+x])
+			}
+			blueNoiseMask[y] = row
+		}
+	})
+	return blueNoiseMask
+}
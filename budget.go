@@ -0,0 +1,70 @@
+package gifencoder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// budgetSteps are the settings EncodeGIFWithinBudget falls back to, each
+// coarser than the one before. Options that are already coarser are kept.
+var budgetSteps = []struct {
+	quality int  // minimum sample factor
+	colors  int  // maximum palette size
+	dither  bool // keep the requested dithering
+}{
+	{0, 256, true}, // the options as given
+	{20, 128, true},
+	{30, 64, true},
+	{30, 32, false}, // 抖动噪声不利于 LZW 压缩
+	{30, 16, false},
+	{30, 8, false},
+	{30, 4, false},
+}
+
+// EncodeGIFWithinBudget encodes images like EncodeGIFWithOptions and, while
+// the result is larger than maxBytes, encodes them again with a coarser
+// sample factor, fewer colors and finally without dithering. It returns
+// the first result that fits. If none does, it returns the smallest one
+// together with an error.
+func EncodeGIFWithinBudget(images []image.Image, maxBytes int, opts EncodeOptions) ([]byte, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("invalid budget of %d bytes", maxBytes)
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, errors.New("no images provided")
+	}
+
+	var smallest []byte
+	for _, step := range budgetSteps {
+		data, err := EncodeGIFWithOptions(images, budgetOptions(opts, step.quality, step.colors, step.dither))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= maxBytes {
+			return data, nil
+		}
+		if smallest == nil || len(data) < len(smallest) {
+			smallest = data
+		}
+	}
+	return smallest, fmt.Errorf("smallest encoding is %d bytes, over the budget of %d", len(smallest), maxBytes)
+}
+
+// budgetOptions returns opts made at least as coarse as the given sample
+// factor and palette size
+func budgetOptions(opts EncodeOptions, quality, colors int, dither bool) EncodeOptions {
+	if quality > 0 && (opts.Quality == 0 || opts.Quality < quality) {
+		opts.Quality = quality
+	}
+	if opts.MaxColors == 0 || opts.MaxColors > colors {
+		opts.MaxColors = colors
+	}
+	if !dither {
+		opts.Dither = nil
+	}
+	return opts
+}
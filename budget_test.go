@@ -0,0 +1,125 @@
+package gifencoder
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math/rand"
+	"testing"
+)
+
+// noiseImage returns a frame of random colors, which compresses poorly
+func noiseImage(w, h int, seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+func TestEncodeGIFWithinBudget(t *testing.T) {
+	frames := []image.Image{noiseImage(64, 64, 1), createGradientImage(64, 64)}
+	opts := EncodeOptions{Dither: DitherFloydSteinberg}
+
+	full, err := EncodeGIFWithOptions(frames, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+
+	// a generous budget keeps the options as given
+	data, err := EncodeGIFWithinBudget(frames, len(full)*2, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithinBudget failed: %v", err)
+	}
+	if !bytes.Equal(data, full) {
+		t.Error("expected the first attempt within a generous budget")
+	}
+
+	// a tighter budget is met by reducing the settings
+	budget := len(full) * 2 / 3
+	data, err = EncodeGIFWithinBudget(frames, budget, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithinBudget failed: %v", err)
+	}
+	if len(data) > budget {
+		t.Errorf("expected at most %d bytes, got %d", budget, len(data))
+	}
+	if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+		t.Fatalf("reduced GIF doesn't decode: %v", err)
+	}
+
+	// an impossible budget returns the smallest result with an error
+	data, err = EncodeGIFWithinBudget(frames, 100, opts)
+	if err == nil {
+		t.Fatal("expected an error for an impossible budget")
+	}
+	if len(data) == 0 || len(data) >= budget {
+		t.Errorf("expected the smallest encoding, got %d bytes", len(data))
+	}
+
+	if _, err := EncodeGIFWithinBudget(frames, 0, opts); err == nil {
+		t.Error("expected an error for a zero budget")
+	}
+}
+
+func TestMaxColors(t *testing.T) {
+	frame := noiseImage(64, 64, 2)
+	for _, method := range []QuantizerMethod{QuantizerNeuQuant, QuantizerMedianCut, QuantizerOctree, QuantizerPopularity} {
+		data, err := EncodeGIFWithOptions([]image.Image{frame}, EncodeOptions{Quantizer: method, MaxColors: 16})
+		if err != nil {
+			t.Fatalf("%s: EncodeGIFWithOptions failed: %v", method, err)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", method, err)
+		}
+		if n := len(g.Image[0].Palette); n > 16 {
+			t.Errorf("%s: expected at most 16 colors, got %d", method, n)
+		}
+	}
+
+	// paletted frames with a larger palette are quantized again
+	paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+	draw.Draw(paletted, paletted.Bounds(), frame, image.Point{}, draw.Src)
+	data, err := EncodeGIFWithOptions([]image.Image{paletted}, EncodeOptions{MaxColors: 16})
+	if err != nil {
+		t.Fatalf("paletted: EncodeGIFWithOptions failed: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("paletted: decode failed: %v", err)
+	}
+	if n := len(g.Image[0].Palette); n > 16 {
+		t.Errorf("paletted: expected at most 16 colors, got %d", n)
+	}
+
+	if err := (EncodeOptions{MaxColors: 1}).Validate(); err == nil {
+		t.Error("expected an error for MaxColors 1")
+	}
+}
+
+func TestMaxColorsSharedPaletteTransparentIndex(t *testing.T) {
+	// the frame is held for the shared palette, the index is checked
+	// against the 2-color palette only when FinishContext writes it
+	encoder := NewGIFEncoder(16, 16)
+	encoder.SetSharedPalette(5)
+	encoder.SetMaxColors(2)
+	transIndex := 200
+	for i := 0; i < 3; i++ {
+		var opts FrameOptions
+		if i == 1 {
+			opts.TransparentIndex = &transIndex
+		}
+		if err := encoder.AddFrameWithOptions(noiseImage(16, 16, int64(i)), opts); err != nil {
+			t.Fatalf("AddFrameWithOptions failed: %v", err)
+		}
+	}
+	if err := encoder.FinishContext(context.Background()); err == nil {
+		t.Error("Expected an error for a transparent index outside the shared palette")
+	}
+}
@@ -0,0 +1,150 @@
+package gifencoder
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// EncodeBuilder assembles EncodeOptions step by step and checks them for
+// contradictory settings in Build:
+//
+//	opts, err := NewEncodeBuilder().Size(320, 240).Quality(5).
+//		Dither(DitherFloydSteinberg).Loop(0).Build()
+type EncodeBuilder struct {
+	opts   EncodeOptions
+	dither DitherMethod
+}
+
+// NewEncodeBuilder returns a builder for the default options: loop forever,
+// quality 10, no dithering, NeuQuant quantization
+func NewEncodeBuilder() *EncodeBuilder {
+	return &EncodeBuilder{}
+}
+
+// Size sets the output size, by default the size of the first frame
+func (b *EncodeBuilder) Size(width, height int) *EncodeBuilder {
+	b.opts.Width, b.opts.Height = width, height
+	return b
+}
+
+// Quality sets the quantizer sample interval, 1-30, lower is better
+func (b *EncodeBuilder) Quality(quality int) *EncodeBuilder {
+	b.opts.Quality = quality
+	return b
+}
+
+// AutoQuality picks the quality from each frame's size
+func (b *EncodeBuilder) AutoQuality() *EncodeBuilder {
+	b.opts.AutoQuality = true
+	return b
+}
+
+// Dither sets the dithering method, a "-serpentine" suffix is accepted as
+// in SetDither
+func (b *EncodeBuilder) Dither(method DitherMethod) *EncodeBuilder {
+	b.dither = method
+	return b
+}
+
+// DitherStrength sets the error diffusion factor in [0,1]
+func (b *EncodeBuilder) DitherStrength(strength float64) *EncodeBuilder {
+	b.opts.DitherStrength = &strength
+	return b
+}
+
+// Loop sets the loop count: 0 loops forever, -1 plays once
+func (b *EncodeBuilder) Loop(count int) *EncodeBuilder {
+	b.opts.Repeat = count
+	return b
+}
+
+// Delays sets the frame delays in milliseconds
+func (b *EncodeBuilder) Delays(delays ...int) *EncodeBuilder {
+	b.opts.Delays = delays
+	return b
+}
+
+// Quantizer sets the color quantization algorithm
+func (b *EncodeBuilder) Quantizer(method QuantizerMethod) *EncodeBuilder {
+	b.opts.Quantizer = method
+	return b
+}
+
+// GlobalPalette uses palette for every frame
+func (b *EncodeBuilder) GlobalPalette(palette color.Palette) *EncodeBuilder {
+	b.opts.GlobalPaletteColors = palette
+	return b
+}
+
+// AutoGlobalPalette builds one global palette from all frames
+func (b *EncodeBuilder) AutoGlobalPalette() *EncodeBuilder {
+	b.opts.AutoGlobalPalette = true
+	return b
+}
+
+// SharedPalette trains one palette over the first frames and reuses it
+func (b *EncodeBuilder) SharedPalette(frames int) *EncodeBuilder {
+	b.opts.SharedPalette = true
+	b.opts.SharedPaletteFrames = frames
+	return b
+}
+
+// Grayscale quantizes to a 256-level gray ramp
+func (b *EncodeBuilder) Grayscale() *EncodeBuilder {
+	b.opts.Grayscale = true
+	return b
+}
+
+// Monochrome produces 1-bit black and white output
+func (b *EncodeBuilder) Monochrome(mono MonoOptions) *EncodeBuilder {
+	b.opts.Monochrome = &mono
+	return b
+}
+
+// OptimizeFrames makes pixels unchanged since the previous frame transparent
+func (b *EncodeBuilder) OptimizeFrames() *EncodeBuilder {
+	b.opts.OptimizeFrames = true
+	return b
+}
+
+// Parallelism sets the number of frames encoded concurrently
+func (b *EncodeBuilder) Parallelism(workers int) *EncodeBuilder {
+	b.opts.Parallelism = workers
+	return b
+}
+
+// Resize scales frames of a different size to the output size
+func (b *EncodeBuilder) Resize(mode ResizeMode, letterbox bool) *EncodeBuilder {
+	b.opts.ResizeMode = mode
+	b.opts.Letterbox = letterbox
+	return b
+}
+
+// OnProgress sets a function called after each frame is written
+func (b *EncodeBuilder) OnProgress(fn ProgressFunc) *EncodeBuilder {
+	b.opts.OnProgress = fn
+	return b
+}
+
+// Build returns the options, or an error naming the first invalid or
+// contradictory setting. On top of Validate it requires both or neither
+// of the sizes and rejects a quantizer that a fixed palette would ignore.
+func (b *EncodeBuilder) Build() (EncodeOptions, error) {
+	opts := b.opts
+	if b.dither != "" {
+		// 以字符串传入, SetDither 才会识别 -serpentine 后缀
+		opts.Dither = string(b.dither)
+	}
+
+	if (opts.Width == 0) != (opts.Height == 0) {
+		return EncodeOptions{}, fmt.Errorf("invalid size %dx%d, set both or neither", opts.Width, opts.Height)
+	}
+	if err := opts.Validate(); err != nil {
+		return EncodeOptions{}, err
+	}
+	fixed := opts.GlobalPalette != nil || opts.GlobalPaletteColors != nil || opts.Grayscale || opts.Monochrome != nil
+	if opts.Quantizer != "" && fixed {
+		return EncodeOptions{}, fmt.Errorf("quantizer %s has no effect with a fixed palette", opts.Quantizer)
+	}
+	return opts, nil
+}
@@ -0,0 +1,85 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestEncodeBuilder(t *testing.T) {
+	opts, err := NewEncodeBuilder().Size(16, 8).Quality(5).
+		Dither(DitherFloydSteinberg+"-serpentine").Loop(3).Delays(100, 200).Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if opts.Width != 16 || opts.Height != 8 || opts.Quality != 5 || opts.Repeat != 3 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	if opts.Dither != "FloydSteinberg-serpentine" {
+		t.Errorf("Dither = %v", opts.Dither)
+	}
+
+	images := []image.Image{
+		createStripeImage(16, 8, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}),
+		createStripeImage(16, 8, []color.RGBA{{0, 255, 0, 255}, {255, 255, 0, 255}}),
+	}
+	data, err := EncodeGIFWithOptions(images, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(g.Image) != 2 || g.LoopCount != 3 || g.Delay[1] != 20 {
+		t.Errorf("frames %d, loop %d, delays %v", len(g.Image), g.LoopCount, g.Delay)
+	}
+}
+
+func TestEncodeBuilderDefaults(t *testing.T) {
+	opts, err := NewEncodeBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if opts.Dither != nil {
+		t.Errorf("Dither = %v, want unset", opts.Dither)
+	}
+}
+
+func TestEncodeBuilderInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *EncodeBuilder
+	}{
+		{"negative size", NewEncodeBuilder().Size(-1, 10)},
+		{"width only", NewEncodeBuilder().Size(10, 0)},
+		{"quality", NewEncodeBuilder().Quality(31)},
+		{"dither strength", NewEncodeBuilder().DitherStrength(1.5)},
+		{"unknown dither", NewEncodeBuilder().Dither("Sparkle")},
+		{"negative delay", NewEncodeBuilder().Delays(100, -1)},
+		{"large palette", NewEncodeBuilder().GlobalPalette(make(color.Palette, 257))},
+		{"palette and auto palette", NewEncodeBuilder().GlobalPalette(color.Palette{color.Black}).AutoGlobalPalette()},
+		{"grayscale and monochrome", NewEncodeBuilder().Grayscale().Monochrome(MonoOptions{})},
+		{"shared and auto palette", NewEncodeBuilder().SharedPalette(4).AutoGlobalPalette()},
+		{"quantizer and grayscale", NewEncodeBuilder().Quantizer(QuantizerMedianCut).Grayscale()},
+	}
+	for _, tt := range tests {
+		if _, err := tt.b.Build(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestEncodeBuilderQuantizer(t *testing.T) {
+	// the quantizer builds the automatic and shared palettes
+	for _, b := range []*EncodeBuilder{
+		NewEncodeBuilder().Quantizer(QuantizerOctree).AutoGlobalPalette(),
+		NewEncodeBuilder().Quantizer(QuantizerMedianCut).SharedPalette(4),
+	} {
+		if _, err := b.Build(); err != nil {
+			t.Errorf("Build: %v", err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package gifencoder
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// testPattern returns n bytes that differ at page boundaries
+func testPattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestByteArrayWrite(t *testing.T) {
+	sizes := []int{0, 1, defaultPageSize - 1, defaultPageSize, defaultPageSize + 1, 3*defaultPageSize + 17}
+	for _, size := range sizes {
+		data := testPattern(size)
+
+		ba := NewByteArray()
+		ba.WriteByte(0xAA)
+		n, err := ba.Write(data)
+		if err != nil || n != size {
+			t.Fatalf("size %d: Write returned (%d, %v)", size, n, err)
+		}
+		ba.WriteByte(0xBB)
+
+		want := append(append([]byte{0xAA}, data...), 0xBB)
+		if got := ba.GetData(); !bytes.Equal(got, want) {
+			t.Errorf("size %d: GetData differs from the written bytes", size)
+		}
+		if pages := (len(want) + defaultPageSize - 1) / defaultPageSize; len(ba.GetPages()) != pages {
+			t.Errorf("size %d: expected %d pages, got %d", size, pages, len(ba.GetPages()))
+		}
+	}
+}
+
+func TestByteArrayWriteTo(t *testing.T) {
+	ba := NewByteArray()
+	if _, err := io.Copy(ba, bytes.NewReader(testPattern(2*defaultPageSize+100))); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := ba.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+	}
+	if !bytes.Equal(buf.Bytes(), ba.GetData()) {
+		t.Error("WriteTo output differs from GetData")
+	}
+}
+
+func TestByteArrayReset(t *testing.T) {
+	ba := NewByteArray()
+	ba.Write(testPattern(3 * defaultPageSize))
+	pages := len(ba.pages)
+
+	ba.Reset()
+	if data := ba.GetData(); len(data) != 0 {
+		t.Fatalf("Expected empty data after Reset, got %d bytes", len(data))
+	}
+
+	want := testPattern(defaultPageSize + 5)
+	ba.Write(want)
+	if !bytes.Equal(ba.GetData(), want) {
+		t.Error("GetData after Reset differs from the written bytes")
+	}
+	if len(ba.pages) != pages {
+		t.Errorf("Expected Reset to keep %d pages, got %d", pages, len(ba.pages))
+	}
+}
+
+// benchmarkEncodeFrames is a small clip typical of a request handler
+var benchmarkEncodeFrames = movingSquareFrames(4, 64)
+
+func BenchmarkEncodeFreshBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encoder := NewGIFEncoder(64, 64)
+		encoder.out = NewByteArray()
+		for _, frame := range benchmarkEncodeFrames {
+			encoder.AddFrame(frame)
+		}
+		encoder.Finish()
+		encoder.GetData()
+	}
+}
+
+func BenchmarkEncodePooledBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encoder := NewGIFEncoder(64, 64)
+		for _, frame := range benchmarkEncodeFrames {
+			encoder.AddFrame(frame)
+		}
+		encoder.Finish()
+		encoder.GetData()
+		encoder.CleanupAll()
+	}
+}
+
+func TestByteArrayLen(t *testing.T) {
+	ba := NewByteArray()
+	if ba.Len() != 0 {
+		t.Fatalf("Expected empty buffer, got Len %d", ba.Len())
+	}
+
+	written := 0
+	for _, n := range []int{1, defaultPageSize - 1, 1, defaultPageSize, 2*defaultPageSize + 3} {
+		ba.Write(testPattern(n))
+		written += n
+		if ba.Len() != written {
+			t.Errorf("After %d bytes: Len returned %d", written, ba.Len())
+		}
+		if len(ba.GetData()) != written {
+			t.Errorf("After %d bytes: GetData returned %d bytes", written, len(ba.GetData()))
+		}
+	}
+
+	ba.Reset()
+	if ba.Len() != 0 {
+		t.Errorf("Expected Len 0 after Reset, got %d", ba.Len())
+	}
+}
+
+func TestByteArrayReadFrom(t *testing.T) {
+	want := testPattern(3*defaultPageSize + 9)
+
+	ba := NewByteArray()
+	ba.WriteByte(0xAA)
+	n, err := ba.ReadFrom(iotest.HalfReader(bytes.NewReader(want)))
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("Expected %d bytes read, got %d", len(want), n)
+	}
+	if !bytes.Equal(ba.GetData(), append([]byte{0xAA}, want...)) {
+		t.Error("GetData differs from the bytes read")
+	}
+}
+
+func BenchmarkEncode200Frames(b *testing.B) {
+	frames := movingSquareFrames(200, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeGIFWithOptions(frames, EncodeOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
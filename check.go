@@ -0,0 +1,166 @@
+package gifencoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ValidateGIF walks a GIF stream and returns an error describing the first
+// structural problem: a bad signature, a block cut short, an extension or
+// image descriptor with a wrong block size, LZW data that doesn't decode
+// to the image size or refers to colors outside its table, or a missing
+// trailer. Errors name the byte offset and, for images, the frame index.
+// It doesn't keep any pixels, use DecodeGIF to look at the frames.
+func ValidateGIF(data []byte) error {
+	c := &gifChecker{data: data}
+	return c.check()
+}
+
+// gifChecker holds the read position while ValidateGIF walks a stream
+type gifChecker struct {
+	data []byte
+	pos  int
+}
+
+// need fails when fewer than n bytes are left for what
+func (c *gifChecker) need(n int, what string) error {
+	if c.pos+n > len(c.data) {
+		return fmt.Errorf("gif: offset %d: %s truncated, %d bytes needed and %d left", c.pos, what, n, len(c.data)-c.pos)
+	}
+	return nil
+}
+
+// subBlocks reads data sub-blocks up to the block terminator and returns
+// their joined contents
+func (c *gifChecker) subBlocks(what string) ([]byte, error) {
+	var joined []byte
+	for {
+		if err := c.need(1, what); err != nil {
+			return nil, err
+		}
+		n := int(c.data[c.pos])
+		c.pos++
+		if n == 0 {
+			return joined, nil
+		}
+		if err := c.need(n, what+" sub-block"); err != nil {
+			return nil, err
+		}
+		joined = append(joined, c.data[c.pos:c.pos+n]...)
+		c.pos += n
+	}
+}
+
+// colorTable skips a color table announced by flags and returns its size
+func (c *gifChecker) colorTable(flags byte, what string) (int, error) {
+	if flags&0x80 == 0 {
+		return 0, nil
+	}
+	n := 1 << (flags&0x07 + 1)
+	if err := c.need(n*3, what); err != nil {
+		return 0, err
+	}
+	c.pos += n * 3
+	return n, nil
+}
+
+func (c *gifChecker) check() error {
+	if err := c.need(13, "header and logical screen descriptor"); err != nil {
+		return err
+	}
+	if sig := string(c.data[:6]); sig != "GIF87a" && sig != "GIF89a" {
+		return fmt.Errorf("gif: invalid signature %q", sig)
+	}
+	width := int(c.data[6]) | int(c.data[7])<<8
+	height := int(c.data[8]) | int(c.data[9])<<8
+	if width == 0 || height == 0 {
+		return fmt.Errorf("gif: invalid logical screen size %dx%d", width, height)
+	}
+	c.pos = 13
+	globalSize, err := c.colorTable(c.data[10], "global color table")
+	if err != nil {
+		return err
+	}
+
+	images := 0
+	for {
+		if err := c.need(1, "block"); err != nil {
+			return errors.New("gif: missing trailer")
+		}
+		start := c.pos
+		switch c.data[c.pos] {
+		case gifExtension:
+			if err := c.need(2, "extension"); err != nil {
+				return err
+			}
+			label := c.data[c.pos+1]
+			c.pos += 2
+			if label == gifGraphicControl {
+				if err := c.need(1, "graphic control extension"); err != nil {
+					return err
+				}
+				if n := c.data[c.pos]; n != 4 {
+					return fmt.Errorf("gif: offset %d: graphic control extension block size %d, expected 4", start, n)
+				}
+			}
+			data, err := c.subBlocks("extension")
+			if err != nil {
+				return err
+			}
+			if label == gifGraphicControl && len(data) != 4 {
+				return fmt.Errorf("gif: offset %d: graphic control extension holds %d bytes, expected 4", start, len(data))
+			}
+
+		case gifImageSeparator:
+			if err := c.need(10, "image descriptor"); err != nil {
+				return err
+			}
+			w := int(c.data[c.pos+5]) | int(c.data[c.pos+6])<<8
+			h := int(c.data[c.pos+7]) | int(c.data[c.pos+8])<<8
+			flags := c.data[c.pos+9]
+			c.pos += 10
+			tableSize, err := c.colorTable(flags, "local color table")
+			if err != nil {
+				return err
+			}
+			if tableSize == 0 {
+				tableSize = globalSize
+			}
+			if tableSize == 0 {
+				return fmt.Errorf("gif: frame %d: no color table", images)
+			}
+
+			if err := c.need(1, "LZW minimum code size"); err != nil {
+				return err
+			}
+			minCodeSize := int(c.data[c.pos])
+			c.pos++
+			data, err := c.subBlocks("image data")
+			if err != nil {
+				return err
+			}
+			pixels, err := NewLZWDecoder(minCodeSize).Decode(data, w*h)
+			if err != nil {
+				return fmt.Errorf("gif: frame %d at offset %d: %w", images, start, err)
+			}
+			for _, index := range pixels {
+				if int(index) >= tableSize {
+					return fmt.Errorf("gif: frame %d at offset %d: color index %d outside its table of %d colors", images, start, index, tableSize)
+				}
+			}
+			images++
+
+		case gifTrailer:
+			if images == 0 {
+				return errors.New("gif: no image found")
+			}
+			if extra := len(c.data) - c.pos - 1; extra > 0 {
+				return fmt.Errorf("gif: %d bytes after the trailer", extra)
+			}
+			return nil
+
+		default:
+			return fmt.Errorf("gif: offset %d: unknown block type 0x%02x", start, c.data[c.pos])
+		}
+	}
+}
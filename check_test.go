@@ -0,0 +1,54 @@
+package gifencoder
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestValidateGIF(t *testing.T) {
+	data, err := EncodeGIFWithOptions(movingSquareFrames(3, 32), EncodeOptions{Dither: DitherFloydSteinberg})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	if err := ValidateGIF(data); err != nil {
+		t.Errorf("valid GIF rejected: %v", err)
+	}
+	still, err := EncodeGIFWithOptions([]image.Image{createGradientImage(16, 16)}, EncodeOptions{Version87a: true})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	if err := ValidateGIF(still); err != nil {
+		t.Errorf("valid GIF87a rejected: %v", err)
+	}
+
+	corrupt := func(f func([]byte) []byte) []byte {
+		return f(append([]byte(nil), data...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string // part of the error message
+	}{
+		{"truncated", data[:len(data)/2], "truncated"},
+		{"missing trailer", data[:len(data)-1], "missing trailer"},
+		{"short header", data[:8], "header"},
+		{"bad signature", corrupt(func(b []byte) []byte { b[4] = '8'; return b }), "signature"},
+		{"trailing garbage", append(append([]byte(nil), data...), 0, 0), "after the trailer"},
+		{"bad graphic control size", corrupt(func(b []byte) []byte {
+			i := strings.Index(string(b), "\x21\xf9\x04")
+			b[i+2] = 5
+			return b
+		}), "block size 5"},
+	}
+	for _, tt := range tests {
+		err := ValidateGIF(tt.data)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error about %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package gifencoder
+
+import (
+	"hash/fnv"
+	"image"
+)
+
+// maxCoalescedDelay is the longest delay in milliseconds a coalesced frame
+// gets, the GIF delay field holds at most 65535 centiseconds
+const maxCoalescedDelay = 65535 * 10
+
+// coalesceIdentical merges runs of consecutive pixel-identical images into
+// their first image, shown for the sum of the run's delays. Frames are
+// compared by a hash of their pixels and, when the hashes match, pixel by
+// pixel.
+func coalesceIdentical(images []image.Image, delays []int) ([]image.Image, []int) {
+	outImages := make([]image.Image, 0, len(images))
+	outDelays := make([]int, 0, len(delays))
+
+	var prevHash uint64
+	for i, img := range images {
+		h := frameHash(img)
+		last := len(outImages) - 1
+		if i > 0 && h == prevHash && outDelays[last]+delays[i] <= maxCoalescedDelay &&
+			sameFrame(images[i-1], img) {
+			outDelays[last] += delays[i]
+		} else {
+			outImages = append(outImages, img)
+			outDelays = append(outDelays, delays[i])
+		}
+		prevHash = h
+	}
+	return outImages, outDelays
+}
+
+// frameHash hashes the size and pixels of img
+func frameHash(img image.Image) uint64 {
+	h := fnv.New64a()
+	bounds := img.Bounds()
+	w, ht := bounds.Dx(), bounds.Dy()
+	h.Write([]byte{byte(w), byte(w >> 8), byte(w >> 16), byte(ht), byte(ht >> 8), byte(ht >> 16)})
+
+	// 常见图像类型直接按行读取 Pix
+	switch src := img.(type) {
+	case *image.RGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			off := src.PixOffset(bounds.Min.X, y)
+			h.Write(src.Pix[off : off+w*4])
+		}
+	case *image.NRGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			off := src.PixOffset(bounds.Min.X, y)
+			h.Write(src.Pix[off : off+w*4])
+		}
+	default:
+		var buf [8]byte
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, a := img.At(x, y).RGBA()
+				buf[0], buf[1] = byte(r), byte(r>>8)
+				buf[2], buf[3] = byte(g), byte(g>>8)
+				buf[4], buf[5] = byte(b), byte(b>>8)
+				buf[6], buf[7] = byte(a), byte(a>>8)
+				h.Write(buf[:])
+			}
+		}
+	}
+	return h.Sum64()
+}
+
+// sameFrame reports whether a and b have the same size and colors
+func sameFrame(a, b image.Image) bool {
+	ba, bb := a.Bounds(), b.Bounds()
+	if ba.Dx() != bb.Dx() || ba.Dy() != bb.Dy() {
+		return false
+	}
+	for y := 0; y < ba.Dy(); y++ {
+		for x := 0; x < ba.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ba.Min.X+x, ba.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
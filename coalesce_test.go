@@ -0,0 +1,63 @@
+package gifencoder
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestCoalesceIdentical(t *testing.T) {
+	red := []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}
+	green := []color.RGBA{{0, 255, 0, 255}, {0, 0, 0, 255}}
+	images := []image.Image{
+		createStripeImage(16, 16, red),
+		createStripeImage(16, 16, green),
+		createStripeImage(16, 16, green),
+		createStripeImage(16, 16, green),
+		createStripeImage(16, 16, red),
+	}
+	opts := EncodeOptions{Delays: []int{100, 200, 300, 400, 500}, CoalesceIdentical: true}
+
+	data, err := EncodeGIFWithOptions(images, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	s := parseGIFStructure(t, data)
+	var delays []int
+	for _, f := range s.Frames {
+		delays = append(delays, f.Delay)
+	}
+	if want := []int{10, 90, 50}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("expected frame delays %v, got %v", want, delays)
+	}
+
+	opts.CoalesceIdentical = false
+	data, err = EncodeGIFWithOptions(images, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	if n := len(parseGIFStructure(t, data).Frames); n != 5 {
+		t.Errorf("expected 5 frames without coalescing, got %d", n)
+	}
+}
+
+func TestSameFrame(t *testing.T) {
+	a := createStripeImage(8, 8, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})
+	b := image.NewRGBA(image.Rect(4, 4, 12, 12))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			b.Set(4+x, 4+y, a.At(x, y))
+		}
+	}
+	if !sameFrame(a, b) {
+		t.Error("expected frames with different origins to match")
+	}
+	b.Set(11, 11, color.RGBA{1, 2, 3, 255})
+	if sameFrame(a, b) {
+		t.Error("expected frames differing in one pixel not to match")
+	}
+	if sameFrame(a, image.NewRGBA(image.Rect(0, 0, 8, 4))) {
+		t.Error("expected frames of different sizes not to match")
+	}
+}
@@ -0,0 +1,51 @@
+package gifencoder
+
+import "math"
+
+// ColorAdjust groups the color adjustments applied to every pixel before
+// quantization, see SetColorAdjust. A zero field leaves its property
+// unchanged, so ColorAdjust{} is the identity; use a small positive value
+// rather than 0 to remove a property entirely.
+type ColorAdjust struct {
+	Saturation float64 // HSL saturation factor, 0-2, 1 = unchanged
+	Contrast   float64 // contrast around mid gray, 0-2, 1 = unchanged
+	Brightness float64 // HSL lightness factor, 0-2, 1 = unchanged
+	Gamma      float64 // each channel becomes c^(1/Gamma), 0.1-10, >1 lightens mid-tones
+}
+
+// normalized returns adj with zero fields set to their identity value and
+// the others clamped to their range
+func (adj ColorAdjust) normalized() ColorAdjust {
+	clampRange := func(v, min, max float64) float64 {
+		if v == 0 {
+			return 1
+		}
+		return math.Max(min, math.Min(max, v))
+	}
+	return ColorAdjust{
+		Saturation: clampRange(adj.Saturation, 0, 2),
+		Contrast:   clampRange(adj.Contrast, 0, 2),
+		Brightness: clampRange(adj.Brightness, 0, 2),
+		Gamma:      clampRange(adj.Gamma, 0.1, 10),
+	}
+}
+
+// SetColorAdjust sets all color adjustments at once, replacing the values
+// given to SetColorEnhancement and SetBrightness. They are applied to each
+// pixel in this order: gamma per channel, contrast, and then saturation,
+// hue (see SetHueShift) and brightness in HSL space. Values out of range
+// are clamped.
+func (ge *GIFEncoder) SetColorAdjust(adj ColorAdjust) {
+	adj = adj.normalized()
+	ge.saturationBoost = adj.Saturation
+	ge.contrastBoost = adj.Contrast
+	ge.brightness = adj.Brightness
+
+	ge.gammaTable = nil
+	if adj.Gamma != 1 {
+		ge.gammaTable = make([]byte, 256)
+		for v := range ge.gammaTable {
+			ge.gammaTable[v] = byte(math.Round(255 * math.Pow(float64(v)/255, 1/adj.Gamma)))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gifencoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+)
+
+// DominantColors returns up to n colors (1-256) representing img, most
+// frequent first, with the fraction of pixels each one stands for. Colors
+// are found by median cut, so an image with at most n distinct colors
+// gets exactly those colors back.
+func DominantColors(img image.Image, n int) (color.Palette, []float64, error) {
+	if n < 1 || n > 256 {
+		return nil, nil, fmt.Errorf("invalid color count %d, expected 1-256", n)
+	}
+	pixels := imagePixels(img)
+	if len(pixels) == 0 {
+		return nil, nil, errors.New("image has no pixels")
+	}
+
+	mc := NewMedianCutQuantizer(pixels, n)
+	mc.BuildColormap()
+	colormap := mc.GetColormap()
+
+	counts := make([]int, len(colormap)/3)
+	for i := 0; i+2 < len(pixels); i += 3 {
+		counts[mc.LookupRGB(pixels[i], pixels[i+1], pixels[i+2])]++
+	}
+
+	order := make([]int, len(counts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return counts[order[a]] > counts[order[b]]
+	})
+
+	total := float64(len(pixels) / 3)
+	palette := make(color.Palette, len(order))
+	weights := make([]float64, len(order))
+	for i, index := range order {
+		palette[i] = color.RGBA{colormap[index*3], colormap[index*3+1], colormap[index*3+2], 255}
+		weights[i] = float64(counts[index]) / total
+	}
+	return palette, weights, nil
+}
+
+// Quantize reduces img to at most n colors (1-256) with the encoder's
+// color pipeline: median cut builds the palette and the pixels are mapped
+// with dithering method d, DitherNone for none. A "-serpentine" suffix is
+// accepted as in SetDither. Unused palette entries are dropped.
+func Quantize(img image.Image, n int, d DitherMethod) (*image.Paletted, error) {
+	if n < 1 || n > 256 {
+		return nil, fmt.Errorf("invalid color count %d, expected 1-256", n)
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("image has no pixels")
+	}
+
+	ge := NewGIFEncoder(bounds.Dx(), bounds.Dy())
+	defer ge.CleanupAll()
+	ge.SetDither(string(d))
+	if ge.ditherMethod == DitherNone && d != DitherNone && d != "" {
+		return nil, fmt.Errorf("unknown dither method %q", d)
+	}
+	ge.SetQuantizerFactory(func(pixels []byte, sample int) Quantizer {
+		return NewMedianCutQuantizer(pixels, n)
+	})
+
+	ge.image = img
+	ge.frameRect = image.Rect(0, 0, ge.width, ge.height)
+	ge.getImagePixels()
+	if err := ge.analyzePixels(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &image.Paletted{
+		Pix:     ge.indexedPixels,
+		Stride:  bounds.Dx(),
+		Rect:    bounds,
+		Palette: colormapToPalette(ge.colorTab, -1),
+	}, nil
+}
+
+// imagePixels flattens img into RGB bytes [r,g,b,r,g,b,...], translucent
+// pixels are composited over black as the encoder does by default
+func imagePixels(img image.Image) []byte {
+	bounds := img.Bounds()
+	pixels := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, byte(r>>8), byte(g>>8), byte(b>>8))
+		}
+	}
+	return pixels
+}
@@ -0,0 +1,106 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"testing"
+)
+
+func TestDominantColors(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			c := red
+			if x >= 7 {
+				c = blue
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	palette, weights, err := DominantColors(img, 4)
+	if err != nil {
+		t.Fatalf("DominantColors failed: %v", err)
+	}
+	if len(palette) != 2 || len(weights) != 2 {
+		t.Fatalf("Expected 2 colors, got %d", len(palette))
+	}
+	if palette[0] != red || palette[1] != blue {
+		t.Errorf("Expected red then blue, got %v", palette)
+	}
+	if math.Abs(weights[0]-0.7) > 0.01 || math.Abs(weights[1]-0.3) > 0.01 {
+		t.Errorf("Expected weights 0.7 and 0.3, got %v", weights)
+	}
+
+	// a gradient reduced to a few colors still covers every pixel
+	_, weights, err = DominantColors(createGradientImage(64, 64), 3)
+	if err != nil {
+		t.Fatalf("DominantColors failed: %v", err)
+	}
+	sum := 0.0
+	for i, w := range weights {
+		sum += w
+		if i > 0 && w > weights[i-1] {
+			t.Errorf("Weights not sorted: %v", weights)
+		}
+	}
+	if len(weights) != 3 || math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Expected 3 weights summing to 1, got %v", weights)
+	}
+
+	if _, _, err := DominantColors(img, 0); err == nil {
+		t.Error("Expected an error for n = 0")
+	}
+	if _, _, err := DominantColors(image.NewRGBA(image.Rect(0, 0, 0, 0)), 4); err == nil {
+		t.Error("Expected an error for an empty image")
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := createGradientImage(64, 48)
+
+	for _, tt := range []struct {
+		n      int
+		dither DitherMethod
+	}{
+		{2, DitherNone},
+		{16, DitherFloydSteinberg},
+		{16, DitherOrdered4x4},
+		{256, "Atkinson-serpentine"},
+	} {
+		p, err := Quantize(img, tt.n, tt.dither)
+		if err != nil {
+			t.Fatalf("Quantize(%d, %s) failed: %v", tt.n, tt.dither, err)
+		}
+		if p.Bounds() != img.Bounds() {
+			t.Errorf("Quantize(%d, %s): expected bounds %v, got %v", tt.n, tt.dither, img.Bounds(), p.Bounds())
+		}
+		if len(p.Palette) == 0 || len(p.Palette) > tt.n {
+			t.Errorf("Quantize(%d, %s): got %d palette entries", tt.n, tt.dither, len(p.Palette))
+		}
+
+		var buf bytes.Buffer
+		if err := gif.Encode(&buf, p, nil); err != nil {
+			t.Fatalf("Quantize(%d, %s): gif.Encode failed: %v", tt.n, tt.dither, err)
+		}
+		decoded, err := gif.Decode(&buf)
+		if err != nil {
+			t.Fatalf("Quantize(%d, %s): gif.Decode failed: %v", tt.n, tt.dither, err)
+		}
+		if !bytes.Equal(decoded.(*image.Paletted).Pix, p.Pix) {
+			t.Errorf("Quantize(%d, %s): decoded indices differ", tt.n, tt.dither)
+		}
+	}
+
+	if _, err := Quantize(img, 300, DitherNone); err == nil {
+		t.Error("Expected an error for n = 300")
+	}
+	if _, err := Quantize(img, 16, "Nope"); err == nil {
+		t.Error("Expected an error for an unknown dither method")
+	}
+}
@@ -0,0 +1,67 @@
+package gifencoder
+
+import (
+	"image"
+	"image/draw"
+)
+
+// compositor keeps the canvas a GIF viewer draws frames onto
+type compositor struct {
+	canvas *image.RGBA
+}
+
+func newCompositor(bounds image.Rectangle) *compositor {
+	return &compositor{canvas: image.NewRGBA(bounds)}
+}
+
+// add draws frame over the canvas, returns a copy of the canvas as shown
+// to the viewer, then applies the frame's disposal method. The background
+// restored by DisposalRestoreBackground is transparent, as in browsers.
+func (c *compositor) add(frame image.Image, disposal int) *image.RGBA {
+	var previous []byte
+	if disposal == DisposalRestorePrevious {
+		previous = make([]byte, len(c.canvas.Pix))
+		copy(previous, c.canvas.Pix)
+	}
+
+	bounds := frame.Bounds()
+	draw.Draw(c.canvas, bounds, frame, bounds.Min, draw.Over)
+
+	shown := image.NewRGBA(c.canvas.Bounds())
+	copy(shown.Pix, c.canvas.Pix)
+
+	switch disposal {
+	case DisposalRestoreBackground:
+		draw.Draw(c.canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+	case DisposalRestorePrevious:
+		copy(c.canvas.Pix, previous)
+	}
+	return shown
+}
+
+// CompositeFrames returns the frames as a viewer shows them: each frame is
+// drawn at its bounds over the result of the previous ones, honoring
+// transparency, after applying the previous frame's disposal method. The
+// canvas covers the union of all frame bounds. Missing disposals default
+// to DisposalNone.
+func CompositeFrames(frames []image.Image, disposals []int) []image.Image {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	bounds := frames[0].Bounds()
+	for _, frame := range frames[1:] {
+		bounds = bounds.Union(frame.Bounds())
+	}
+
+	c := newCompositor(bounds)
+	result := make([]image.Image, len(frames))
+	for i, frame := range frames {
+		disposal := DisposalNone
+		if i < len(disposals) {
+			disposal = disposals[i]
+		}
+		result[i] = c.add(frame, disposal)
+	}
+	return result
+}
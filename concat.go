@@ -0,0 +1,111 @@
+package gifencoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// ConcatGIFs joins GIFs into one animation that plays them in order,
+// keeping every frame's delay. All GIFs must have the size of the first
+// one, see ConcatGIFsWithOptions to scale them instead.
+func ConcatGIFs(gifs [][]byte) ([]byte, error) {
+	return ConcatGIFsWithOptions(gifs, EncodeOptions{})
+}
+
+// ConcatGIFsWithOptions joins GIFs into one animation as ConcatGIFs. The
+// output has the size set in opts or else the size of the first GIF, GIFs
+// of another size are an error unless opts.ResizeMode scales them, with
+// opts.Letterbox keeping their aspect ratio. When the frames hold at most
+// 256 opaque colors in total and opts sets no palette of its own, they are
+// written with one exact global palette, otherwise each frame is quantized
+// to a local color table. opts.Delays is ignored.
+func ConcatGIFsWithOptions(gifs [][]byte, opts EncodeOptions) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(gifs) == 0 {
+		return nil, errors.New("no GIFs provided")
+	}
+
+	var frames []image.Image
+	var delays []int
+	for i, data := range gifs {
+		f, d, err := DecodeGIF(data)
+		if err != nil {
+			return nil, fmt.Errorf("GIF %d: %w", i, err)
+		}
+		if len(f) == 0 {
+			return nil, fmt.Errorf("GIF %d has no frames", i)
+		}
+		frames = append(frames, f...)
+		delays = append(delays, d...)
+	}
+
+	if opts.Width == 0 || opts.Height == 0 {
+		size := frames[0].Bounds().Size()
+		opts.Width, opts.Height = size.X, size.Y
+	}
+	size := image.Pt(opts.Width, opts.Height)
+	sameSize := true
+	for _, f := range frames {
+		if f.Bounds().Size() != size {
+			sameSize = false
+			break
+		}
+	}
+	if !sameSize && opts.ResizeMode == ResizeNone {
+		return nil, fmt.Errorf("GIFs differ in size from %dx%d, set a ResizeMode to scale them", size.X, size.Y)
+	}
+
+	ownPalette := opts.GlobalPalette != nil || opts.GlobalPaletteColors != nil || opts.AutoGlobalPalette ||
+		opts.SharedPalette || opts.Grayscale || opts.Monochrome != nil || opts.Quantizer == QuantizerWebSafe
+	if sameSize && !ownPalette {
+		if palette, ok := exactPalette(frames); ok {
+			opts.GlobalPaletteColors = palette
+		}
+	}
+
+	encoder := encoderForImages(frames, opts)
+	defer encoder.CleanupAll()
+	for i, img := range frames {
+		encoder.SetDelay(delays[i])
+		if err := encoder.AddFrame(img); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+	}
+	if err := encoder.FinishContext(context.Background()); err != nil {
+		return nil, err
+	}
+	return encoder.GetData(), nil
+}
+
+// exactPalette returns the colors of frames when they are all opaque and
+// there are at most 256 of them
+func exactPalette(frames []image.Image) (color.Palette, bool) {
+	seen := make(map[color.RGBA]bool)
+	var palette color.Palette
+	for _, img := range frames {
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, a := img.At(x, y).RGBA()
+				if a != 0xffff {
+					return nil, false
+				}
+				c := color.RGBA{byte(r >> 8), byte(g >> 8), byte(b >> 8), 255}
+				if seen[c] {
+					continue
+				}
+				if len(palette) == 256 {
+					return nil, false
+				}
+				seen[c] = true
+				palette = append(palette, c)
+			}
+		}
+	}
+	return palette, true
+}
@@ -0,0 +1,82 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestConcatGIFs(t *testing.T) {
+	red := createStripeImage(20, 10, []color.RGBA{{255, 0, 0, 255}, {255, 255, 255, 255}})
+	green := createStripeImage(20, 10, []color.RGBA{{0, 255, 0, 255}, {255, 255, 255, 255}})
+	blue := createStripeImage(20, 10, []color.RGBA{{0, 0, 255, 255}, {0, 0, 0, 255}})
+
+	first, err := EncodeGIF([]image.Image{red, green}, []int{100, 200})
+	if err != nil {
+		t.Fatalf("EncodeGIF failed: %v", err)
+	}
+	second, err := EncodeGIF([]image.Image{blue, red}, []int{300, 400})
+	if err != nil {
+		t.Fatalf("EncodeGIF failed: %v", err)
+	}
+
+	data, err := ConcatGIFs([][]byte{first, second})
+	if err != nil {
+		t.Fatalf("ConcatGIFs failed: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(g.Image) != 4 {
+		t.Fatalf("expected 4 frames, got %d", len(g.Image))
+	}
+	for i, d := range []int{10, 20, 30, 40} {
+		if g.Delay[i] != d {
+			t.Errorf("frame %d: expected delay %d, got %d", i, d, g.Delay[i])
+		}
+	}
+	// 颜色很少, 应使用统一的全局调色板
+	if s := parseGIFStructure(t, data); s.GCTSize == 0 || s.Frames[1].LCTSize != 0 {
+		t.Error("expected a shared global palette")
+	}
+	want := []*image.RGBA{red, green, blue, red}
+	for i, frame := range g.Image {
+		if c := color.RGBAModel.Convert(frame.At(0, 0)); c != want[i].At(0, 0) {
+			t.Errorf("frame %d: expected %v, got %v", i, want[i].At(0, 0), c)
+		}
+	}
+}
+
+func TestConcatGIFsSizes(t *testing.T) {
+	small, err := EncodeGIF([]image.Image{createGradientImage(10, 10)}, nil)
+	if err != nil {
+		t.Fatalf("EncodeGIF failed: %v", err)
+	}
+	large, err := EncodeGIF([]image.Image{createGradientImage(40, 20)}, nil)
+	if err != nil {
+		t.Fatalf("EncodeGIF failed: %v", err)
+	}
+
+	if _, err := ConcatGIFs([][]byte{large, small}); err == nil {
+		t.Error("expected an error for GIFs of different sizes")
+	}
+
+	data, err := ConcatGIFsWithOptions([][]byte{large, small}, EncodeOptions{ResizeMode: ResizeBilinear, Letterbox: true})
+	if err != nil {
+		t.Fatalf("ConcatGIFsWithOptions failed: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(g.Image) != 2 || g.Config.Width != 40 || g.Config.Height != 20 {
+		t.Errorf("expected 2 frames of 40x20, got %d of %dx%d", len(g.Image), g.Config.Width, g.Config.Height)
+	}
+
+	if _, err := ConcatGIFs(nil); err == nil {
+		t.Error("expected an error without GIFs")
+	}
+}
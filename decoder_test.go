@@ -0,0 +1,261 @@
+package gifencoder
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+)
+
+func TestDecodeGIFRoundTrip(t *testing.T) {
+	frames := movingSquareFrames(6, 64)
+	delays := []int{100, 200, 50, 100, 300, 100}
+
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{Delays: delays, OptimizeFrames: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, gotDelays, err := DecodeGIF(data)
+	if err != nil {
+		t.Fatalf("DecodeGIF failed: %v", err)
+	}
+	if len(decoded) != len(frames) {
+		t.Fatalf("Expected %d frames, got %d", len(frames), len(decoded))
+	}
+	for i, d := range delays {
+		if gotDelays[i] != d {
+			t.Errorf("Frame %d: expected delay %dms, got %dms", i, d, gotDelays[i])
+		}
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	want := compositeStdGIF(g)
+	for i, frame := range decoded {
+		if frame.Bounds() != want[i].Bounds() {
+			t.Fatalf("Frame %d: expected bounds %v, got %v", i, want[i].Bounds(), frame.Bounds())
+		}
+		if !bytes.Equal(frame.(*image.RGBA).Pix, want[i].Pix) {
+			t.Errorf("Frame %d: pixels differ from image/gif", i)
+		}
+	}
+}
+
+func TestDecodeGIFDisposal(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	palette := color.Palette{red, blue, green, color.Transparent}
+
+	solid := func(r image.Rectangle, index uint8) *image.Paletted {
+		img := image.NewPaletted(r, palette)
+		for i := range img.Pix {
+			img.Pix[i] = index
+		}
+		return img
+	}
+
+	// blue is restored away (3), green is cleared to background (2)
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			solid(image.Rect(0, 0, 8, 8), 0),
+			solid(image.Rect(2, 2, 4, 4), 1),
+			solid(image.Rect(4, 4, 6, 6), 2),
+			solid(image.Rect(0, 0, 1, 1), 0),
+		},
+		Delay:    []int{1, 2, 3, 4},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalBackground, gif.DisposalNone},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+
+	frames, delays, err := DecodeGIF(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeGIF failed: %v", err)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(frames))
+	}
+	if delays[3] != 40 {
+		t.Errorf("Expected last delay 40ms, got %d", delays[3])
+	}
+
+	if c := frames[1].At(2, 2); c != blue {
+		t.Errorf("Frame 1: expected blue square, got %v", c)
+	}
+	if c := frames[2].At(2, 2); c != red {
+		t.Errorf("Frame 2: expected blue square restored to red, got %v", c)
+	}
+	if c := frames[2].At(4, 4); c != green {
+		t.Errorf("Frame 2: expected green square, got %v", c)
+	}
+	if c := color.RGBAModel.Convert(frames[3].At(4, 4)); c != (color.RGBA{}) {
+		t.Errorf("Frame 3: expected green square cleared, got %v", c)
+	}
+	if c := frames[3].At(7, 7); c != red {
+		t.Errorf("Frame 3: expected untouched red, got %v", c)
+	}
+}
+
+func TestDecodeGIFStream(t *testing.T) {
+	frames := movingSquareFrames(5, 32)
+	delays := []int{100, 200, 300, 400, 500}
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{Delays: delays})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want, _, err := DecodeGIF(data)
+	if err != nil {
+		t.Fatalf("DecodeGIF failed: %v", err)
+	}
+
+	calls := 0
+	err = DecodeGIFStream(bytes.NewReader(data), func(frame image.Image, delayMs int) error {
+		if delayMs != delays[calls] {
+			t.Errorf("Frame %d: expected delay %dms, got %dms", calls, delays[calls], delayMs)
+		}
+		if !bytes.Equal(frame.(*image.RGBA).Pix, want[calls].(*image.RGBA).Pix) {
+			t.Errorf("Frame %d: pixels differ from DecodeGIF", calls)
+		}
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DecodeGIFStream failed: %v", err)
+	}
+	if calls != len(frames) {
+		t.Errorf("Expected %d callbacks, got %d", len(frames), calls)
+	}
+
+	// an error from the callback stops decoding
+	stop := errors.New("stop")
+	calls = 0
+	err = DecodeGIFStream(bytes.NewReader(data), func(image.Image, int) error {
+		calls++
+		if calls == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected decoding to stop after 2 frames, got %d", calls)
+	}
+}
+
+func TestPosterFrame(t *testing.T) {
+	frames := movingSquareFrames(5, 64)
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{OptimizeFrames: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	poster, err := PosterFrame(data, 2)
+	if err != nil {
+		t.Fatalf("PosterFrame failed: %v", err)
+	}
+	if _, ok := poster.(*image.RGBA); !ok {
+		t.Errorf("Expected *image.RGBA, got %T", poster)
+	}
+	// the square of frame 2 covers x 21-30, the one of frame 1 at x 13-22
+	// must be painted over by the composited background
+	if r, g, b, _ := poster.At(25, 25).RGBA(); r>>8 < 200 || g>>8 < 200 || b>>8 > 60 {
+		t.Errorf("Expected a yellow square at (25,25), got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+	if r, g, _, _ := poster.At(15, 25).RGBA(); r>>8 > 100 && g>>8 > 100 {
+		t.Errorf("Expected the background at (15,25), got %d,%d", r>>8, g>>8)
+	}
+
+	all, _, err := DecodeGIF(data)
+	if err != nil {
+		t.Fatalf("DecodeGIF failed: %v", err)
+	}
+	last, err := PosterFrame(data, -1)
+	if err != nil {
+		t.Fatalf("PosterFrame(-1) failed: %v", err)
+	}
+	if !bytes.Equal(last.(*image.RGBA).Pix, all[4].(*image.RGBA).Pix) {
+		t.Error("Expected index -1 to return the last frame")
+	}
+
+	for _, index := range []int{5, -2} {
+		if _, err := PosterFrame(data, index); err == nil {
+			t.Errorf("Expected an error for index %d", index)
+		}
+	}
+}
+
+func TestDecodeGIFInvalid(t *testing.T) {
+	if _, _, err := DecodeGIF([]byte("PNG89a")); err == nil {
+		t.Error("Expected an error for an invalid signature")
+	}
+
+	data, err := EncodeGIF([]image.Image{createGradientImage(16, 16)}, nil)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if _, _, err := DecodeGIF(data[:len(data)/2]); err == nil {
+		t.Error("Expected an error for a truncated GIF")
+	}
+}
+
+func TestCompositeFrames(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	full := createStripeImage(8, 8, []color.RGBA{red})
+	square := image.NewRGBA(image.Rect(2, 2, 4, 4))
+	draw.Draw(square, square.Bounds(), image.NewUniform(blue), image.Point{}, draw.Src)
+
+	frames := []image.Image{full, square, square, square}
+	disposals := []int{DisposalRestoreBackground, DisposalRestorePrevious, DisposalKeep}
+	shown := CompositeFrames(frames, disposals)
+
+	if c := shown[0].At(0, 0); c != red {
+		t.Errorf("Frame 0: expected red, got %v", c)
+	}
+	// frame 0 was cleared back to the (transparent) background
+	if c := shown[1].At(0, 0); c != (color.RGBA{}) {
+		t.Errorf("Frame 1: expected cleared background, got %v", c)
+	}
+	if c := shown[1].At(2, 2); c != blue {
+		t.Errorf("Frame 1: expected blue square, got %v", c)
+	}
+	// frame 1 restored the canvas to the cleared state, frame 2 draws again
+	if c := shown[2].At(3, 3); c != blue {
+		t.Errorf("Frame 2: expected blue square, got %v", c)
+	}
+	if c := shown[3].At(7, 7); c != (color.RGBA{}) {
+		t.Errorf("Frame 3: expected background, got %v", c)
+	}
+	if shown[3].Bounds() != full.Bounds() {
+		t.Errorf("Expected canvas bounds %v, got %v", full.Bounds(), shown[3].Bounds())
+	}
+}
+
+func TestSetDisposeValidation(t *testing.T) {
+	encoder := NewGIFEncoder(4, 4)
+	for _, code := range []int{-1, DisposalNone, DisposalKeep, DisposalRestoreBackground, DisposalRestorePrevious} {
+		if err := encoder.SetDispose(code); err != nil {
+			t.Errorf("Disposal %d: unexpected error %v", code, err)
+		}
+	}
+	for _, code := range []int{-2, 4, 7} {
+		if err := encoder.SetDispose(code); err == nil {
+			t.Errorf("Disposal %d: expected an error", code)
+		}
+	}
+	if err := encoder.AddFrameWithOptions(createStripeImage(4, 4, []color.RGBA{{1, 2, 3, 255}}), FrameOptions{Disposal: 5}); err == nil {
+		t.Error("Expected AddFrameWithOptions to reject disposal 5")
+	}
+}
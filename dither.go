@@ -1,5 +1,11 @@
 package gifencoder
 
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
 // DitheringKernel 定义抖动核心
 type DitheringKernel [][]float64
 
@@ -45,6 +51,24 @@ var (
 		{1.0 / 8.0, 1, 1},
 		{1.0 / 8.0, 0, 2},
 	}
+
+	// SierraTwoRow 两行 Sierra 抖动核心，比 Stucki 更快，误差扩散范围较小
+	SierraTwoRow = DitheringKernel{
+		{4.0 / 16.0, 1, 0},
+		{3.0 / 16.0, 2, 0},
+		{1.0 / 16.0, -2, 1},
+		{2.0 / 16.0, -1, 1},
+		{3.0 / 16.0, 0, 1},
+		{2.0 / 16.0, 1, 1},
+		{1.0 / 16.0, 2, 1},
+	}
+
+	// SierraLite 抖动核心，只扩散到三个相邻像素，最快但噪点稍多
+	SierraLite = DitheringKernel{
+		{2.0 / 4.0, 1, 0},
+		{1.0 / 4.0, -1, 1},
+		{1.0 / 4.0, 0, 1},
+	}
 )
 
 // DitherMethod 抖动方法
@@ -56,8 +80,101 @@ const (
 	DitherFalseFloydSteinberg DitherMethod = "FalseFloydSteinberg"
 	DitherStucki              DitherMethod = "Stucki"
 	DitherAtkinson            DitherMethod = "Atkinson"
+	DitherSierraTwoRow        DitherMethod = "SierraTwoRow"
+	DitherSierraLite          DitherMethod = "SierraLite"
+	DitherOrdered2x2          DitherMethod = "Ordered2x2"
+	DitherOrdered4x4          DitherMethod = "Ordered4x4"
+	DitherOrdered8x8          DitherMethod = "Ordered8x8"
+	DitherBlueNoise           DitherMethod = "BlueNoise"
 )
 
+// isBuiltinDither 判断是否为内置的抖动方法
+func isBuiltinDither(method DitherMethod) bool {
+	switch method {
+	case DitherNone, DitherFloydSteinberg, DitherFalseFloydSteinberg,
+		DitherStucki, DitherAtkinson, DitherSierraTwoRow, DitherSierraLite,
+		DitherOrdered2x2, DitherOrdered4x4, DitherOrdered8x8, DitherBlueNoise:
+		return true
+	}
+	return false
+}
+
+// ditherAliases 抖动方法名称（小写，去掉空格、'-' 和 '_'）到方法的映射
+var ditherAliases = map[string]DitherMethod{
+	"":                    DitherNone,
+	"none":                DitherNone,
+	"floydsteinberg":      DitherFloydSteinberg,
+	"fs":                  DitherFloydSteinberg,
+	"falsefloydsteinberg": DitherFalseFloydSteinberg,
+	"falsefs":             DitherFalseFloydSteinberg,
+	"stucki":              DitherStucki,
+	"atkinson":            DitherAtkinson,
+	"sierratworow":        DitherSierraTwoRow,
+	"sierra2":             DitherSierraTwoRow,
+	"sierralite":          DitherSierraLite,
+	"ordered2x2":          DitherOrdered2x2,
+	"ordered4x4":          DitherOrdered4x4,
+	"ordered8x8":          DitherOrdered8x8,
+	"bluenoise":           DitherBlueNoise,
+}
+
+// serpentineSuffix 抖动方法名称后缀，表示使用蛇形扫描
+const serpentineSuffix = "-serpentine"
+
+// cutSerpentine 去掉名称末尾的 serpentine 后缀（忽略大小写）
+// 只有后缀时默认为 Floyd-Steinberg
+func cutSerpentine(name string) (string, bool) {
+	n := len(name) - len(serpentineSuffix)
+	if n < 0 || !strings.EqualFold(name[n:], serpentineSuffix) {
+		return name, false
+	}
+	base := strings.TrimSpace(name[:n])
+	if base == "" {
+		base = string(DitherFloydSteinberg)
+	}
+	return base, true
+}
+
+// parseDitherName 解析内置抖动方法名称，忽略大小写、空格、'-' 和 '_'
+func parseDitherName(name string) (DitherMethod, bool) {
+	key := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+	method, ok := ditherAliases[key]
+	return method, ok
+}
+
+// validate 检查抖动核心的每一行是否为 [权重, dx, dy]
+// 权重必须为正数，偏移必须为整数且指向扫描顺序中尚未处理的像素
+func (kernel DitheringKernel) validate() error {
+	if len(kernel) == 0 {
+		return fmt.Errorf("dither kernel is empty")
+	}
+	for i, row := range kernel {
+		if len(row) != 3 {
+			return fmt.Errorf("dither kernel row %d: expected [weight, dx, dy], got %d values", i, len(row))
+		}
+		weight, dx, dy := row[0], row[1], row[2]
+		if !(weight > 0) {
+			return fmt.Errorf("dither kernel row %d: weight must be positive, got %v", i, weight)
+		}
+		if dx != float64(int(dx)) || dy != float64(int(dy)) {
+			return fmt.Errorf("dither kernel row %d: offsets must be integers, got (%v, %v)", i, dx, dy)
+		}
+		if dy < 0 || (dy == 0 && dx <= 0) {
+			return fmt.Errorf("dither kernel row %d: offset (%v, %v) points to an already processed pixel", i, dx, dy)
+		}
+	}
+	return nil
+}
+
+// orderedSpread 有序抖动阈值的幅度（0-255 通道值）
+const orderedSpread = 48
+
 // ditherPixels 对像素应用抖动算法
 // method: 抖动方法名称
 // serpentine: 是否使用蛇形扫描
@@ -73,21 +190,35 @@ func (ge *GIFEncoder) ditherPixels(method DitherMethod, serpentine bool) {
 		kernel = Stucki
 	case DitherAtkinson:
 		kernel = Atkinson
+	case DitherSierraTwoRow:
+		kernel = SierraTwoRow
+	case DitherSierraLite:
+		kernel = SierraLite
 	default:
-		// 未知的抖动方法，回退到不抖动
-		ge.indexPixels()
-		return
+		custom, ok := ge.ditherKernels[method]
+		if !ok {
+			// 未知的抖动方法，回退到不抖动
+			ge.indexPixels()
+			return
+		}
+		kernel = custom
 	}
 
 	width := ge.width
 	height := ge.height
-	data := ge.pixels
 	direction := 1
 	if serpentine {
 		direction = -1
 	}
 
 	ge.indexedPixels = make([]byte, len(ge.pixels)/3)
+	ge.resetLookupCache()
+
+	// 误差在浮点缓冲区中累积，避免每次写回 8 位像素时截断和钳位造成的精度损失
+	data := make([]float64, len(ge.pixels))
+	for i, v := range ge.pixels {
+		data[i] = ge.toDitherSpace(v)
+	}
 
 	for y := 0; y < height; y++ {
 		// 蛇形扫描：每行改变方向
@@ -109,27 +240,27 @@ func (ge *GIFEncoder) ditherPixels(method DitherMethod, serpentine bool) {
 		for x != xEnd {
 			index := y*width + x
 
-			// 获取原始颜色
+			// 累积误差后的颜色可能超出 0-255，钳位后的值只用于查找调色板
 			idx := index * 3
-			r1 := int(data[idx])
-			g1 := int(data[idx+1])
-			b1 := int(data[idx+2])
+			r1 := ge.fromDitherSpace(data[idx])
+			g1 := ge.fromDitherSpace(data[idx+1])
+			b1 := ge.fromDitherSpace(data[idx+2])
 
 			// 找到最接近的调色板颜色
-			colorIdx := ge.findClosestRGB(byte(r1), byte(g1), byte(b1))
+			colorIdx := ge.findClosestCached(r1, g1, b1)
 			ge.usedEntry[colorIdx] = true
 			ge.indexedPixels[index] = byte(colorIdx)
 
 			// 获取量化后的颜色
 			paletteIdx := colorIdx * 3
-			r2 := int(ge.colorTab[paletteIdx])
-			g2 := int(ge.colorTab[paletteIdx+1])
-			b2 := int(ge.colorTab[paletteIdx+2])
+			r2 := ge.toDitherSpace(ge.colorTab[paletteIdx])
+			g2 := ge.toDitherSpace(ge.colorTab[paletteIdx+1])
+			b2 := ge.toDitherSpace(ge.colorTab[paletteIdx+2])
 
-			// 计算量化误差
-			er := r1 - r2
-			eg := g1 - g2
-			eb := b1 - b2
+			// 计算量化误差，使用未钳位的累积值，超出范围的部分继续扩散
+			er := data[idx] - r2
+			eg := data[idx+1] - g2
+			eb := data[idx+2] - b2
 
 			// 将误差扩散到邻近像素
 			var i, iEnd int
@@ -149,13 +280,13 @@ func (ge *GIFEncoder) ditherPixels(method DitherMethod, serpentine bool) {
 				nx := x + x1
 				ny := y + y1
 				if nx >= 0 && nx < width && ny >= 0 && ny < height {
-					d := kernel[i][0]
+					d := kernel[i][0] * ge.ditherStrength
 					nIdx := (ny*width + nx) * 3
 
-					// 扩散误差，确保值在 0-255 范围内
-					data[nIdx] = clamp(int(data[nIdx]) + int(float64(er)*d))
-					data[nIdx+1] = clamp(int(data[nIdx+1]) + int(float64(eg)*d))
-					data[nIdx+2] = clamp(int(data[nIdx+2]) + int(float64(eb)*d))
+					// 扩散误差
+					data[nIdx] += er * d
+					data[nIdx+1] += eg * d
+					data[nIdx+2] += eb * d
 				}
 
 				if direction == 1 {
@@ -180,3 +311,83 @@ func clamp(value int) byte {
 	}
 	return byte(value)
 }
+
+// orderedMatrixSize 返回有序抖动方法的阈值矩阵尺寸，非有序抖动返回 0
+func orderedMatrixSize(method DitherMethod) int {
+	switch method {
+	case DitherOrdered2x2:
+		return 2
+	case DitherOrdered4x4:
+		return 4
+	case DitherOrdered8x8:
+		return 8
+	case DitherBlueNoise:
+		return blueNoiseSize
+	}
+	return 0
+}
+
+// orderedMatrix 返回有序抖动方法的阈值矩阵，取值 0..size*size-1，非有序抖动返回 nil
+func orderedMatrix(method DitherMethod) [][]int {
+	if method == DitherBlueNoise {
+		return blueNoiseMatrix()
+	}
+	if size := orderedMatrixSize(method); size > 0 {
+		return bayerMatrix(size)
+	}
+	return nil
+}
+
+// bayerMatrix 生成 n×n（n 为 2 的幂）的 Bayer 阈值矩阵，取值 0..n*n-1
+func bayerMatrix(n int) [][]int {
+	m := [][]int{{0}}
+	for size := 1; size < n; size *= 2 {
+		next := make([][]int, size*2)
+		for y := range next {
+			next[y] = make([]int, size*2)
+		}
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				v := 4 * m[y][x]
+				next[y][x] = v
+				next[y][x+size] = v + 2
+				next[y+size][x] = v + 3
+				next[y+size][x+size] = v + 1
+			}
+		}
+		m = next
+	}
+	return m
+}
+
+// orderedDitherPixels 使用平铺的阈值矩阵（Bayer 或蓝噪声）进行有序抖动
+// 每个像素的偏移只取决于其坐标，因此动画中静止区域的图案保持稳定
+func (ge *GIFEncoder) orderedDitherPixels(matrix [][]int) {
+	size := len(matrix)
+	levels := float64(size * size)
+
+	width := ge.width
+	height := ge.height
+	data := ge.pixels
+	ge.indexedPixels = make([]byte, len(data)/3)
+	ge.resetLookupCache()
+
+	for y := 0; y < height; y++ {
+		row := matrix[y%size]
+		for x := 0; x < width; x++ {
+			index := y*width + x
+			idx := index * 3
+
+			// 阈值映射到 [-0.5, 0.5) 区间
+			offset := int(((float64(row[x%size])+0.5)/levels - 0.5) * orderedSpread)
+
+			colorIdx := ge.findClosestCached(
+				clamp(int(data[idx])+offset),
+				clamp(int(data[idx+1])+offset),
+				clamp(int(data[idx+2])+offset),
+			)
+			ge.usedEntry[colorIdx] = true
+			ge.indexedPixels[index] = byte(colorIdx)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"testing"
+)
+
+// createGradientImage creates a horizontal RGB gradient
+func createGradientImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8(255 - x*255/w), 255})
+		}
+	}
+	return img
+}
+
+func TestBayerMatrix(t *testing.T) {
+	for _, n := range []int{2, 4, 8} {
+		m := bayerMatrix(n)
+		seen := make(map[int]bool)
+		for _, row := range m {
+			for _, v := range row {
+				seen[v] = true
+			}
+		}
+		if len(m) != n || len(seen) != n*n {
+			t.Errorf("Bayer %dx%d: expected %d distinct thresholds, got %d", n, n, n*n, len(seen))
+		}
+	}
+}
+
+func TestOrderedDitherDeterministic(t *testing.T) {
+	img := createGradientImage(64, 64)
+
+	for _, method := range []string{"Ordered2x2", "Ordered4x4", "Ordered8x8", "BlueNoise"} {
+		encode := func() []byte {
+			encoder := NewGIFEncoder(64, 64)
+			encoder.SetDither(method)
+			if err := encoder.AddFrame(img); err != nil {
+				t.Fatalf("AddFrame failed: %v", err)
+			}
+			encoder.Finish()
+			return encoder.GetData()
+		}
+
+		first := encode()
+		if !bytes.Equal(first, encode()) {
+			t.Errorf("%s: repeated encodes differ", method)
+		}
+
+		encoder := NewGIFEncoder(64, 64)
+		encoder.SetDither(method)
+		if orderedMatrixSize(encoder.ditherMethod) == 0 {
+			t.Errorf("SetDither(%q) did not select ordered dithering", method)
+		}
+	}
+}
+
+// legacyDitherIndices reproduces the previous Floyd-Steinberg implementation
+// that clamped diffused error back into 8-bit pixels immediately
+func legacyDitherIndices(ge *GIFEncoder, pixels []byte) []byte {
+	data := make([]byte, len(pixels))
+	copy(data, pixels)
+	indexed := make([]byte, len(pixels)/3)
+
+	for y := 0; y < ge.height; y++ {
+		for x := 0; x < ge.width; x++ {
+			idx := (y*ge.width + x) * 3
+			r1, g1, b1 := int(data[idx]), int(data[idx+1]), int(data[idx+2])
+			colorIdx := ge.findClosestRGB(byte(r1), byte(g1), byte(b1))
+			indexed[y*ge.width+x] = byte(colorIdx)
+
+			er := r1 - int(ge.colorTab[colorIdx*3])
+			eg := g1 - int(ge.colorTab[colorIdx*3+1])
+			eb := b1 - int(ge.colorTab[colorIdx*3+2])
+			for _, k := range FloydSteinberg {
+				nx, ny := x+int(k[1]), y+int(k[2])
+				if nx < 0 || nx >= ge.width || ny >= ge.height {
+					continue
+				}
+				n := (ny*ge.width + nx) * 3
+				data[n] = clamp(int(data[n]) + int(float64(er)*k[0]))
+				data[n+1] = clamp(int(data[n+1]) + int(float64(eg)*k[0]))
+				data[n+2] = clamp(int(data[n+2]) + int(float64(eb)*k[0]))
+			}
+		}
+	}
+	return indexed
+}
+
+// blockError returns the mean absolute difference between 4x4 block averages
+// of the source gray channel and the dithered output
+func blockError(ge *GIFEncoder, pixels, indexed []byte) float64 {
+	total := 0.0
+	blocks := 0
+	for by := 0; by+4 <= ge.height; by += 4 {
+		for bx := 0; bx+4 <= ge.width; bx += 4 {
+			src, out := 0, 0
+			for y := by; y < by+4; y++ {
+				for x := bx; x < bx+4; x++ {
+					src += int(pixels[(y*ge.width+x)*3])
+					out += int(ge.colorTab[int(indexed[y*ge.width+x])*3])
+				}
+			}
+			d := float64(src-out) / 16
+			if d < 0 {
+				d = -d
+			}
+			total += d
+			blocks++
+		}
+	}
+	return total / float64(blocks)
+}
+
+func TestDitherErrorPrecision(t *testing.T) {
+	const w, h = 256, 32
+
+	// smooth gray ramp against a coarse 8-level gray palette
+	palette := make([]byte, 0, 8*3)
+	for i := 0; i < 8; i++ {
+		v := byte(i * 255 / 7)
+		palette = append(palette, v, v, v)
+	}
+	pixels := make([]byte, w*h*3)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := byte(x)
+			k := (y*w + x) * 3
+			pixels[k], pixels[k+1], pixels[k+2] = v, v, v
+		}
+	}
+
+	ge := NewGIFEncoder(w, h)
+	ge.colorTab = palette
+	legacy := blockError(ge, pixels, legacyDitherIndices(ge, pixels))
+
+	ge.pixels = append([]byte(nil), pixels...)
+	ge.ditherPixels(DitherFloydSteinberg, false)
+	current := blockError(ge, pixels, ge.indexedPixels)
+
+	t.Logf("mean block error: legacy %.3f, current %.3f", legacy, current)
+	if current >= legacy*0.9 {
+		t.Errorf("Expected a measurable drop in mean error: legacy %.3f, current %.3f", legacy, current)
+	}
+}
+
+func TestDitherErrorUnclamped(t *testing.T) {
+	const w, h = 256, 32
+
+	// a dark ramp interleaved with white: the error of dark pixels pushes
+	// their white neighbors past 255, and that excess must keep diffusing
+	ge := NewGIFEncoder(w, h)
+	ge.colorTab = []byte{0, 0, 0, 255, 255, 255}
+	pixels := make([]byte, w*h*3)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := byte(x / 2)
+			if (x+y)%2 == 0 {
+				v = 255
+			}
+			k := (y*w + x) * 3
+			pixels[k], pixels[k+1], pixels[k+2] = v, v, v
+		}
+	}
+
+	ge.pixels = append([]byte(nil), pixels...)
+	ge.ditherPixels(DitherFloydSteinberg, false)
+
+	src, out := 0, 0
+	for i := 0; i < w*h; i++ {
+		src += int(pixels[i*3])
+		out += int(ge.colorTab[int(ge.indexedPixels[i])*3])
+	}
+	n := float64(w * h)
+	if d := math.Abs(float64(src-out) / n); d > 2 {
+		t.Errorf("Expected dithered mean %.2f close to source mean %.2f", float64(out)/n, float64(src)/n)
+	}
+}
+
+func TestDitherStrength(t *testing.T) {
+	img := createGradientImage(64, 64)
+
+	encode := func(dither interface{}, strength float64) []byte {
+		encoder := NewGIFEncoder(64, 64)
+		encoder.SetDither(dither)
+		encoder.SetDitherStrength(strength)
+		if err := encoder.AddFrame(img); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		encoder.Finish()
+		return encoder.GetData()
+	}
+
+	none := encode(DitherNone, 1)
+	if !bytes.Equal(encode(DitherFloydSteinberg, 0), none) {
+		t.Error("Strength 0 should match DitherNone output")
+	}
+	if bytes.Equal(encode(DitherFloydSteinberg, 1), none) {
+		t.Error("Strength 1 should differ from DitherNone output")
+	}
+
+	// strength 0 passed through options must not fall back to the default
+	fromOptions := func(opts EncodeOptions) []byte {
+		data, err := EncodeGIFWithOptions([]image.Image{img}, opts)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		return data
+	}
+	zero := fromOptions(EncodeOptions{Dither: DitherFloydSteinberg, DitherStrength: floatPtr(0)})
+	if !bytes.Equal(zero, fromOptions(EncodeOptions{Dither: DitherNone})) {
+		t.Error("DitherStrength 0 in options should match DitherNone output")
+	}
+
+	encoder := NewGIFEncoder(1, 1)
+	encoder.SetDitherStrength(3)
+	if encoder.ditherStrength != 1 {
+		t.Errorf("Expected strength clamped to 1, got %v", encoder.ditherStrength)
+	}
+	encoder.SetDitherStrength(-1)
+	if encoder.ditherStrength != 0 {
+		t.Errorf("Expected strength clamped to 0, got %v", encoder.ditherStrength)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestCustomDitherKernel(t *testing.T) {
+	encoder := NewGIFEncoder(8, 2)
+
+	invalid := []DitheringKernel{
+		{},
+		{{1, 1}},
+		{{0, 1, 0}},
+		{{-0.5, 1, 0}},
+		{{1, -1, 0}},
+		{{1, 0.5, 1}},
+	}
+	for _, kernel := range invalid {
+		if err := encoder.SetDitherKernel("bad", kernel); err == nil {
+			t.Errorf("Expected kernel %v to be rejected", kernel)
+		}
+	}
+	if err := encoder.SetDitherKernel("FloydSteinberg", DitheringKernel{{1, 1, 0}}); err == nil {
+		t.Error("Expected builtin name to be rejected")
+	}
+
+	// push all error to the right neighbour only
+	if err := encoder.SetDitherKernel("right", DitheringKernel{{1, 1, 0}}); err != nil {
+		t.Fatalf("SetDitherKernel failed: %v", err)
+	}
+	if encoder.ditherMethod != "right" {
+		t.Fatalf("Expected custom kernel to be selected, got %q", encoder.ditherMethod)
+	}
+
+	encoder.colorTab = []byte{0, 0, 0, 255, 255, 255}
+	encoder.pixels = bytes.Repeat([]byte{128}, 8*2*3)
+	encoder.ditherPixels(encoder.ditherMethod, false)
+
+	// 128 -> white (error -127), 1 -> black (error 1), 129 -> white ...
+	want := []byte{1, 0, 1, 0, 1, 0, 1, 0}
+	for y := 0; y < 2; y++ {
+		row := encoder.indexedPixels[y*8 : y*8+8]
+		if !bytes.Equal(row, want) {
+			t.Errorf("Row %d: expected %v, got %v", y, want, row)
+		}
+	}
+
+	encoder.SetDither("none")
+	encoder.SetDither("right")
+	if encoder.ditherMethod != "right" {
+		t.Errorf("Expected SetDither to select the registered kernel, got %q", encoder.ditherMethod)
+	}
+}
+
+func TestSetDitherNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		want       DitherMethod
+		serpentine bool
+	}{
+		{"FloydSteinberg", DitherFloydSteinberg, false},
+		{"floydsteinberg", DitherFloydSteinberg, false},
+		{"Floyd-Steinberg", DitherFloydSteinberg, false},
+		{"floyd_steinberg", DitherFloydSteinberg, false},
+		{"  FS ", DitherFloydSteinberg, false},
+		{"fs-serpentine", DitherFloydSteinberg, true},
+		{"FS-Serpentine", DitherFloydSteinberg, true},
+		{"false-fs", DitherFalseFloydSteinberg, false},
+		{"FALSEFLOYDSTEINBERG", DitherFalseFloydSteinberg, false},
+		{"stucki", DitherStucki, false},
+		{"atkinson", DitherAtkinson, false},
+		{"ATKINSON-serpentine", DitherAtkinson, true},
+		{"Atkinson-serpentine", DitherAtkinson, true},
+		{"-serpentine", DitherFloydSteinberg, true},
+		{"serpentine", DitherNone, false},
+		{"Atkinson-serpentine-x", DitherNone, false},
+		{"ordered8X8", DitherOrdered8x8, false},
+		{"None", DitherNone, false},
+		{"", DitherNone, false},
+		{"sparkle", DitherNone, false},
+	}
+
+	for _, tt := range tests {
+		encoder := NewGIFEncoder(8, 8)
+		encoder.SetDither(tt.name)
+		if encoder.ditherMethod != tt.want || encoder.serpentine != tt.serpentine {
+			t.Errorf("SetDither(%q): got %q serpentine=%v, want %q serpentine=%v",
+				tt.name, encoder.ditherMethod, encoder.serpentine, tt.want, tt.serpentine)
+		}
+	}
+}
+
+func TestSierraKernels(t *testing.T) {
+	kernels := map[DitherMethod]DitheringKernel{
+		DitherSierraTwoRow: SierraTwoRow,
+		DitherSierraLite:   SierraLite,
+	}
+	for method, kernel := range kernels {
+		if err := kernel.validate(); err != nil {
+			t.Errorf("%s: %v", method, err)
+		}
+		sum := 0.0
+		for _, row := range kernel {
+			sum += row[0]
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("%s: expected coefficients to sum to 1, got %v", method, sum)
+		}
+
+		img := createStripeImage(32, 32, []color.RGBA{{200, 40, 90, 255}, {20, 180, 240, 255}, {90, 90, 90, 255}})
+		data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Dither: string(method) + "-serpentine"})
+		if err != nil {
+			t.Fatalf("%s: EncodeGIFWithOptions failed: %v", method, err)
+		}
+		if _, err := gif.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: failed to decode GIF: %v", method, err)
+		}
+	}
+
+	encoder := NewGIFEncoder(8, 8)
+	encoder.SetDither("sierra-lite")
+	if encoder.ditherMethod != DitherSierraLite {
+		t.Errorf("expected sierra-lite to select SierraLite, got %q", encoder.ditherMethod)
+	}
+}
+
+func TestBlueNoiseMatrix(t *testing.T) {
+	m := blueNoiseMatrix()
+	if len(m) != blueNoiseSize {
+		t.Fatalf("expected %d rows, got %d", blueNoiseSize, len(m))
+	}
+	seen := make([]bool, blueNoiseSize*blueNoiseSize)
+	for _, row := range m {
+		for _, v := range row {
+			if v < 0 || v >= len(seen) || seen[v] {
+				t.Fatalf("expected each rank 0-%d once, got %d again or out of range", len(seen)-1, v)
+			}
+			seen[v] = true
+		}
+	}
+}
+
+func TestBlueNoiseDither(t *testing.T) {
+	// mid gray dithered to black and white, every 8x8 block should get
+	// close to half white pixels
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []byte{128, 128, 128, 255})
+	}
+	encoder := NewGIFEncoder(64, 64)
+	encoder.SetDither("bluenoise")
+	if err := encoder.SetGlobalPaletteFromColors(color.Palette{color.Black, color.White}); err != nil {
+		t.Fatalf("SetGlobalPaletteFromColors failed: %v", err)
+	}
+	if err := encoder.AddFrame(img); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	encoder.Finish()
+	out, err := gif.Decode(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+
+	for by := 0; by < 64; by += 8 {
+		for bx := 0; bx < 64; bx += 8 {
+			white := 0
+			for y := by; y < by+8; y++ {
+				for x := bx; x < bx+8; x++ {
+					if r, _, _, _ := out.At(x, y).RGBA(); r > 0x8000 {
+						white++
+					}
+				}
+			}
+			if white < 20 || white > 44 {
+				t.Errorf("block (%d,%d): expected about 32 of 64 white pixels, got %d", bx, by, white)
+			}
+		}
+	}
+}
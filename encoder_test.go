@@ -1,12 +1,18 @@
 package gifencoder
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"image"
 	"image/color"
-	_ "image/jpeg" // 注册 JPEG 解码器
-	_ "image/png"  // 注册 PNG 解码器
+	"image/gif"
+	"image/jpeg"  // 同时注册 JPEG 解码器
+	_ "image/png" // 注册 PNG 解码器
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewGIFEncoder(t *testing.T) {
@@ -27,11 +33,78 @@ func TestSetDelay(t *testing.T) {
 	}
 }
 
-func TestSetFrameRate(t *testing.T) {
+func TestDelayCentiseconds(t *testing.T) {
+	encoder := NewGIFEncoder(100, 100)
+	encoder.SetDelay(95)
+	if encoder.delay != 10 {
+		t.Errorf("SetDelay(95): expected delay 10, got %d", encoder.delay)
+	}
+	encoder.SetDelayCentiseconds(10)
+	if encoder.delay != 10 {
+		t.Errorf("SetDelayCentiseconds(10): expected delay 10, got %d", encoder.delay)
+	}
+	encoder.SetDelayCentiseconds(9)
+	if encoder.delay != 9 {
+		t.Errorf("SetDelayCentiseconds(9): expected delay 9, got %d", encoder.delay)
+	}
+
+	frames := movingSquareFrames(3, 16)
+	for _, tt := range []struct {
+		opts EncodeOptions
+		want []int
+	}{
+		{EncodeOptions{Delays: []int{95, 90, 94}}, []int{10, 9, 9}},
+		{EncodeOptions{DelaysCentiseconds: []int{10, 9, 1}}, []int{10, 9, 1}},
+	} {
+		data, err := EncodeGIFWithOptions(frames, tt.opts)
+		if err != nil {
+			t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if !reflect.DeepEqual(g.Delay, tt.want) {
+			t.Errorf("%+v: expected delays %v, got %v", tt.opts, tt.want, g.Delay)
+		}
+	}
+}
+
+func TestEncoderWriteTo(t *testing.T) {
+	frames := movingSquareFrames(4, 100) // several pages of output
 	encoder := NewGIFEncoder(100, 100)
-	encoder.SetFrameRate(10)
-	if encoder.delay != 10 { // 100 / 10 = 10
-		t.Errorf("Expected delay 10, got %d", encoder.delay)
+	for _, frame := range frames {
+		if err := encoder.AddFrame(frame); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	var buf bytes.Buffer
+	n, err := encoder.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(buf.Len()) || !bytes.Equal(buf.Bytes(), encoder.GetData()) {
+		t.Error("WriteTo output differs from GetData")
+	}
+
+	opts := EncodeOptions{Dither: DitherFloydSteinberg}
+	want, err := EncodeGIFWithOptions(frames, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	buf.Reset()
+	if err := EncodeGIFToWriter(&buf, frames, opts); err != nil {
+		t.Fatalf("EncodeGIFToWriter failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("EncodeGIFToWriter output differs from EncodeGIFWithOptions")
+	}
+
+	buf.Reset()
+	if err := EncodeGIFToWriter(&buf, nil, opts); err == nil || buf.Len() != 0 {
+		t.Errorf("expected an error and no output without frames, got %v and %d bytes", err, buf.Len())
 	}
 }
 
@@ -181,6 +254,112 @@ func TestLZWEncoder(t *testing.T) {
 	}
 }
 
+// genericImage hides the concrete type of an image so getImagePixels
+// takes the At path
+type genericImage struct{ image.Image }
+
+func TestImagePixelsFastPath(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(3, 5, 23, 17))
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 20, 12))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = byte(i * 7)
+		nrgba.Pix[i] = byte(i * 13)
+	}
+	// RGBA must stay premultiplied
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		a := rgba.Pix[i+3]
+		for c := 0; c < 3; c++ {
+			if rgba.Pix[i+c] > a {
+				rgba.Pix[i+c] = a
+			}
+		}
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 20, 12))
+	cmyk := image.NewCMYK(image.Rect(0, 0, 20, 12))
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 21, 13), image.YCbCrSubsampleRatio420)
+	for i := range gray.Pix {
+		gray.Pix[i] = byte(i * 11)
+	}
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = byte(i * 5)
+	}
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = byte(i * 3)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i] = byte(i * 17)
+		ycbcr.Cr[i] = byte(255 - i*9)
+	}
+
+	images := []image.Image{rgba, nrgba, rgba.SubImage(image.Rect(5, 6, 15, 12)),
+		gray, cmyk, ycbcr, ycbcr.SubImage(image.Rect(1, 1, 20, 12))}
+	for _, img := range images {
+		for _, matte := range []color.RGBA{{}, {40, 200, 90, 255}} {
+			fast := NewGIFEncoder(20, 12)
+			fast.SetMatteColor(matte)
+			fast.SetAlphaThreshold(100)
+			fast.image = img
+			fast.getImagePixels()
+
+			slow := NewGIFEncoder(20, 12)
+			slow.SetMatteColor(matte)
+			slow.SetAlphaThreshold(100)
+			slow.image = genericImage{img}
+			slow.getImagePixels()
+
+			if !bytes.Equal(fast.pixels, slow.pixels) {
+				t.Errorf("%T %v: fast path pixels differ from At", img, img.Bounds())
+			}
+			for j := range slow.transMask {
+				if fast.transMask[j] != slow.transMask[j] {
+					t.Errorf("%T %v: transparency mask differs at %d", img, img.Bounds(), j)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestJPEGColors(t *testing.T) {
+	// solid blocks survive JPEG compression almost unchanged
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	colors := []color.RGBA{{220, 40, 40, 255}, {40, 180, 70, 255}, {30, 60, 200, 255}, {240, 220, 90, 255}}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, colors[(y/32)*2+x/32])
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("jpeg.Encode failed: %v", err)
+	}
+	img, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("jpeg.Decode failed: %v", err)
+	}
+	if _, ok := img.(*image.YCbCr); !ok {
+		t.Fatalf("expected the JPEG to decode to *image.YCbCr, got %T", img)
+	}
+
+	data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Quality: 1})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	out, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+
+	for i, c := range colors {
+		x, y := (i%2)*32+16, (i/2)*32+16
+		r, g, b, _ := out.At(x, y).RGBA()
+		if absDiff(r>>8, uint32(c.R)) > 8 || absDiff(g>>8, uint32(c.G)) > 8 || absDiff(b>>8, uint32(c.B)) > 8 {
+			t.Errorf("block %d: expected about %v, got %d,%d,%d", i, c, r>>8, g>>8, b>>8)
+		}
+	}
+}
+
 // Benchmark tests
 func BenchmarkNeuQuant(b *testing.B) {
 	pixels := make([]byte, 100*100*3)
@@ -316,3 +495,1274 @@ func TestEncodeWithOptions(t *testing.T) {
 		t.Error("Generated GIF data too small")
 	}
 }
+
+func TestSmallerFrameKeepsRows(t *testing.T) {
+	// 30x20 frame inside a 40x40 encoder: left half red, right half blue
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			if x < 15 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+
+	encoder := NewGIFEncoder(40, 40)
+	if err := encoder.AddFrame(img); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	encoder.Finish()
+
+	decoded, err := gif.Decode(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			r, _, b, _ := decoded.At(x, y).RGBA()
+			if x < 15 && (r>>8 < 200 || b>>8 > 50) {
+				t.Fatalf("Expected red at (%d,%d), got r=%d b=%d", x, y, r>>8, b>>8)
+			}
+			if x >= 15 && (b>>8 < 200 || r>>8 > 50) {
+				t.Fatalf("Expected blue at (%d,%d), got r=%d b=%d", x, y, r>>8, b>>8)
+			}
+		}
+	}
+}
+
+func TestEncodeWithContextCancel(t *testing.T) {
+	frames := make([]image.Image, 50)
+	for f := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+		for i := range img.Pix {
+			img.Pix[i] = byte((i*31 + f*17) ^ (i >> 7))
+		}
+		frames[f] = img
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := EncodeGIFWithContext(ctx, frames, EncodeOptions{Quality: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Cancellation took too long: %v", elapsed)
+	}
+
+	// an already cancelled context must not encode anything
+	if _, err := EncodeGIFWithContext(ctx, frames[:1], EncodeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled for cancelled context, got %v", err)
+	}
+}
+
+func TestPalettedFrameRoundTrip(t *testing.T) {
+	palette := color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 255, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+		color.RGBA{250, 200, 10, 255},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+	for i := range img.Pix {
+		img.Pix[i] = byte((i * 7) % len(palette))
+	}
+
+	encoder := NewGIFEncoder(8, 8)
+	if err := encoder.AddFrame(img); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	encoder.Finish()
+
+	decoded, err := gif.Decode(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	p, ok := decoded.(*image.Paletted)
+	if !ok {
+		t.Fatalf("Expected *image.Paletted, got %T", decoded)
+	}
+
+	// 5 colors fit in an 8-entry color table
+	if len(p.Palette) != 8 {
+		t.Errorf("Expected color table with 8 entries, got %d", len(p.Palette))
+	}
+	for i, c := range palette {
+		if color.RGBAModel.Convert(p.Palette[i]) != c {
+			t.Errorf("Palette entry %d: expected %v, got %v", i, c, p.Palette[i])
+		}
+	}
+	if !bytes.Equal(p.Pix, img.Pix) {
+		t.Errorf("Indices changed after round trip")
+	}
+}
+
+// palettedCopy returns img as a paletted image holding exactly its colors
+func palettedCopy(img *image.RGBA) *image.Paletted {
+	var palette color.Palette
+	p := image.NewPaletted(img.Bounds(), nil)
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		index := -1
+		for j, pc := range palette {
+			if pc == c {
+				index = j
+			}
+		}
+		if index < 0 {
+			index = len(palette)
+			palette = append(palette, c)
+		}
+		p.Pix[i/4] = byte(index)
+	}
+	p.Palette = palette
+	return p
+}
+
+func TestPalettedFrameAdjustments(t *testing.T) {
+	rgba := createStripeImage(8, 8, []color.RGBA{{200, 50, 50, 255}, {40, 90, 160, 255}})
+	paletted := palettedCopy(rgba)
+
+	// 调色板帧与 RGBA 帧应得到相同的颜色调整
+	cases := []struct {
+		name string
+		opts EncodeOptions
+	}{
+		{"saturation", EncodeOptions{SaturationBoost: 2}},
+		{"contrast", EncodeOptions{ContrastBoost: 1.5}},
+		{"gamma", EncodeOptions{Gamma: 2}},
+	}
+	for _, c := range cases {
+		var got [2]color.RGBA
+		for i, img := range []image.Image{rgba, paletted} {
+			data, err := EncodeGIFWithOptions([]image.Image{img}, c.opts)
+			if err != nil {
+				t.Fatalf("%s: Encode failed: %v", c.name, err)
+			}
+			decoded, err := gif.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: Failed to decode GIF: %v", c.name, err)
+			}
+			got[i] = color.RGBAModel.Convert(decoded.At(0, 0)).(color.RGBA)
+		}
+		if got[0] == (color.RGBA{200, 50, 50, 255}) {
+			t.Errorf("%s: expected the adjustment to change the color", c.name)
+		}
+		near := func(a, b uint8) bool { return a-b <= 2 || b-a <= 2 }
+		if !near(got[0].R, got[1].R) || !near(got[0].G, got[1].G) || !near(got[0].B, got[1].B) {
+			t.Errorf("%s: RGBA frame gave %v, paletted frame %v", c.name, got[0], got[1])
+		}
+	}
+}
+
+func TestAutoGlobalPalette(t *testing.T) {
+	frames := make([]image.Image, 4)
+	for f := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				img.Set(x, y, color.RGBA{uint8((x + f) * 8), uint8(y * 8), 100, 255})
+			}
+		}
+		frames[f] = img
+	}
+
+	local, err := EncodeGIFWithOptions(frames, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	global, err := EncodeGIFWithOptions(frames, EncodeOptions{AutoGlobalPalette: true})
+	if err != nil {
+		t.Fatalf("Encode with AutoGlobalPalette failed: %v", err)
+	}
+
+	if n := parseGIFStructure(t, local).colorTableCount(); n != len(frames) {
+		t.Errorf("Expected %d color tables without global palette, got %d", len(frames), n)
+	}
+	if n := parseGIFStructure(t, global).colorTableCount(); n != 1 {
+		t.Errorf("Expected 1 color table with AutoGlobalPalette, got %d", n)
+	}
+	if len(global) >= len(local) {
+		t.Errorf("Expected global palette to shrink output: %d >= %d", len(global), len(local))
+	}
+
+	if _, err := gif.DecodeAll(bytes.NewReader(global)); err != nil {
+		t.Errorf("Failed to decode GIF: %v", err)
+	}
+}
+
+func TestAddFrameWithOptions(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	encoder := NewGIFEncoder(10, 10)
+	encoder.SetDelay(500)
+	transIndex := 3
+	frames := []FrameOptions{
+		{DelayMs: 100},
+		{DelayMs: 250, Disposal: 2, TransparentIndex: &transIndex},
+		{},
+	}
+	for _, opts := range frames {
+		if err := encoder.AddFrameWithOptions(img, opts); err != nil {
+			t.Fatalf("AddFrameWithOptions failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	s := parseGIFStructure(t, encoder.GetData())
+	if len(s.Frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(s.Frames))
+	}
+
+	if s.Frames[0].Delay != 10 || s.Frames[1].Delay != 25 {
+		t.Errorf("Expected GCE delays 10 and 25, got %d and %d", s.Frames[0].Delay, s.Frames[1].Delay)
+	}
+	if s.Frames[2].Delay != 50 {
+		t.Errorf("Frame without options should use SetDelay value 50, got %d", s.Frames[2].Delay)
+	}
+
+	if f := s.Frames[1]; f.Disposal != 2 || !f.Transparent || f.TransIndex != 3 {
+		t.Errorf("Expected disposal 2 with transparent index 3, got %+v", f)
+	}
+	if f := s.Frames[2]; f.Disposal != 0 || f.Transparent {
+		t.Errorf("Per-frame options leaked into the next frame: %+v", f)
+	}
+}
+
+func TestAddFrameWithOptionsTransparentIndexRange(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for _, index := range []int{300, -5} {
+		encoder := NewGIFEncoder(10, 10)
+		if err := encoder.AddFrameWithOptions(img, FrameOptions{TransparentIndex: &index}); err == nil {
+			t.Errorf("Expected an error for transparent index %d", index)
+		}
+	}
+
+	// index 5 is valid for GIF but outside the frame's 2-color table
+	paletted := palettedCopy(createStripeImage(10, 10, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}))
+	index := 5
+	encoder := NewGIFEncoder(10, 10)
+	if err := encoder.AddFrameWithOptions(paletted, FrameOptions{TransparentIndex: &index}); err == nil {
+		t.Error("Expected an error for a transparent index outside the color table")
+	}
+	index = 1
+	if err := encoder.AddFrameWithOptions(paletted, FrameOptions{TransparentIndex: &index}); err != nil {
+		t.Errorf("AddFrameWithOptions failed: %v", err)
+	}
+	encoder.Finish()
+	if _, err := gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil {
+		t.Errorf("Failed to decode GIF: %v", err)
+	}
+}
+
+func TestSmallPaletteTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		colors   []color.RGBA
+		gctBits  byte
+		codeSize int
+	}{
+		{"solid red", []color.RGBA{{255, 0, 0, 255}}, 0, 2},
+		{"four colors", twelveColors[:4], 1, 2},
+		{"twelve colors", twelveColors, 3, 4},
+	}
+
+	for _, tt := range tests {
+		img := createStripeImage(48, 8, tt.colors)
+		encoder := NewGIFEncoder(48, 8)
+		encoder.SetQuantizerMethod(QuantizerMedianCut)
+		if err := encoder.AddFrame(img); err != nil {
+			t.Fatalf("%s: AddFrame failed: %v", tt.name, err)
+		}
+		encoder.Finish()
+		data := encoder.GetData()
+
+		s := parseGIFStructure(t, data)
+		if bits := s.LSDFlags & 7; bits != tt.gctBits {
+			t.Errorf("%s: expected GCT size bits %d, got %d", tt.name, tt.gctBits, bits)
+		}
+		if s.Frames[0].MinCodeSize != tt.codeSize {
+			t.Errorf("%s: expected LZW minimum code size %d, got %d", tt.name, tt.codeSize, s.Frames[0].MinCodeSize)
+		}
+
+		decoded, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: failed to decode GIF: %v", tt.name, err)
+		}
+		for x := 0; x < 48; x++ {
+			if color.RGBAModel.Convert(decoded.At(x, 3)) != img.At(x, 3) {
+				t.Fatalf("%s: pixel %d changed after round trip", tt.name, x)
+			}
+		}
+	}
+}
+
+func TestSetFrameRate(t *testing.T) {
+	cases := []struct {
+		fps   int
+		delay int // centiseconds
+	}{
+		{10, 10},
+		{25, 4},
+		{30, 3},
+		{50, 2},
+		{60, 2},
+		{120, 2},
+	}
+	for _, c := range cases {
+		encoder := NewGIFEncoder(1, 1)
+		encoder.SetFrameRate(c.fps)
+		if encoder.delay != c.delay {
+			t.Errorf("%d fps: expected delay %dcs, got %dcs", c.fps, c.delay, encoder.delay)
+		}
+	}
+
+	encoder := NewGIFEncoder(1, 1)
+	encoder.SetFrameRateMinDelay(1)
+	encoder.SetFrameRate(120)
+	if encoder.delay != 1 {
+		t.Errorf("Expected 120 fps with minimum 1 to give 1cs, got %dcs", encoder.delay)
+	}
+}
+
+func TestTransparentIndexStable(t *testing.T) {
+	frames := movingSquareFrames(4, 48)
+
+	encoder := NewGIFEncoder(48, 48)
+	encoder.BuildGlobalPalette(frames)
+	encoder.SetTransparent(&color.RGBA{255, 255, 0, 255})
+	for _, frame := range frames {
+		if err := encoder.AddFrame(frame); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	s := parseGIFStructure(t, encoder.GetData())
+	want := s.Frames[0].TransIndex
+	for i, f := range s.Frames {
+		if !f.Transparent || f.TransIndex != want {
+			t.Errorf("Frame %d: expected transparent index %d, got transparent=%v index=%d", i, want, f.Transparent, f.TransIndex)
+		}
+	}
+
+	// an explicit index is written as is
+	encoder = NewGIFEncoder(48, 48)
+	encoder.SetTransparentIndex(200)
+	for _, frame := range frames {
+		if err := encoder.AddFrame(frame); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	s = parseGIFStructure(t, encoder.GetData())
+	for i, f := range s.Frames {
+		if !f.Transparent || f.TransIndex != 200 {
+			t.Errorf("Frame %d: expected transparent index 200, got transparent=%v index=%d", i, f.Transparent, f.TransIndex)
+		}
+		if f.LCTSize <= 200 && s.GCTSize <= 200 {
+			t.Errorf("Frame %d: color table too small for index 200", i)
+		}
+	}
+	if _, err := gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil {
+		t.Errorf("Failed to decode GIF: %v", err)
+	}
+}
+
+func TestBackgroundIndex(t *testing.T) {
+	img := createStripeImage(16, 16, []color.RGBA{{0, 0, 255, 255}})
+
+	encode := func(setup func(*GIFEncoder) error) gifStructure {
+		t.Helper()
+		encoder := NewGIFEncoder(16, 16)
+		encoder.SetGlobalPalette([]byte{0, 0, 0, 255, 0, 0, 0, 255, 0, 0, 0, 255})
+		if err := setup(encoder); err != nil {
+			t.Fatalf("Setup failed: %v", err)
+		}
+		if err := encoder.AddFrame(img); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		encoder.Finish()
+		return parseGIFStructure(t, encoder.GetData())
+	}
+
+	s := encode(func(*GIFEncoder) error { return nil })
+	if s.BackgroundIdx != 0 {
+		t.Errorf("Expected default background index 0, got %d", s.BackgroundIdx)
+	}
+
+	s = encode(func(ge *GIFEncoder) error { return ge.SetBackgroundIndex(2) })
+	if s.BackgroundIdx != 2 {
+		t.Errorf("Expected background index 2, got %d", s.BackgroundIdx)
+	}
+
+	s = encode(func(ge *GIFEncoder) error { return ge.SetBackgroundColor(color.RGBA{240, 10, 10, 255}) })
+	if s.BackgroundIdx != 1 {
+		t.Errorf("Expected background color to map to index 1, got %d", s.BackgroundIdx)
+	}
+
+	encoder := NewGIFEncoder(16, 16)
+	encoder.SetGlobalPalette([]byte{0, 0, 0, 255, 255, 255})
+	if err := encoder.SetBackgroundIndex(5); err == nil {
+		t.Error("Expected an error for an index outside the global palette")
+	}
+	if err := NewGIFEncoder(16, 16).SetBackgroundColor(color.RGBA{}); err == nil {
+		t.Error("Expected an error for a background color without global palette")
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	cases := []struct {
+		ratio float64
+		want  int
+	}{
+		{1, 0},
+		{0, 0},
+		{2, 113},
+		{0.5, 17},
+		{8.0 / 7.0, 58}, // NTSC-like 8:7 pixels
+		{0.1, 1},
+		{10, 255},
+	}
+	img := createStripeImage(4, 4, []color.RGBA{{255, 0, 0, 255}})
+	for _, c := range cases {
+		encoder := NewGIFEncoder(4, 4)
+		encoder.SetAspectRatio(c.ratio)
+		if err := encoder.AddFrame(img); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		encoder.Finish()
+		if s := parseGIFStructure(t, encoder.GetData()); s.AspectRatio != c.want {
+			t.Errorf("Ratio %v: expected aspect byte %d, got %d", c.ratio, c.want, s.AspectRatio)
+		}
+	}
+}
+
+func TestHueShiftAndBrightness(t *testing.T) {
+	red := createStripeImage(8, 8, []color.RGBA{{255, 0, 0, 255}})
+
+	cases := []struct {
+		name string
+		opts EncodeOptions
+		want color.RGBA
+	}{
+		{"identity", EncodeOptions{}, color.RGBA{255, 0, 0, 255}},
+		{"hue+180", EncodeOptions{HueShift: 180}, color.RGBA{0, 255, 255, 255}},
+		{"hue-240", EncodeOptions{HueShift: -240}, color.RGBA{0, 255, 0, 255}},
+		{"brightness", EncodeOptions{Brightness: 0.5}, color.RGBA{128, 0, 0, 255}},
+	}
+	for _, c := range cases {
+		// 调色板帧走快速路径，同样需要应用调整
+		for i, img := range []image.Image{red, palettedCopy(red)} {
+			data, err := EncodeGIFWithOptions([]image.Image{img}, c.opts)
+			if err != nil {
+				t.Fatalf("%s: Encode failed: %v", c.name, err)
+			}
+			decoded, err := gif.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: Failed to decode GIF: %v", c.name, err)
+			}
+			got := color.RGBAModel.Convert(decoded.At(4, 4)).(color.RGBA)
+			if absDiff(uint32(got.R), uint32(c.want.R)) > 2 || absDiff(uint32(got.G), uint32(c.want.G)) > 2 || absDiff(uint32(got.B), uint32(c.want.B)) > 2 {
+				t.Errorf("%s (paletted %v): expected %v, got %v", c.name, i == 1, c.want, got)
+			}
+		}
+	}
+}
+
+func TestColorAdjust(t *testing.T) {
+	// adjusted returns the color c is turned into before quantization
+	adjusted := func(adj ColorAdjust, c color.RGBA) color.RGBA {
+		encoder := NewGIFEncoder(1, 1)
+		encoder.SetColorAdjust(adj)
+		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		img.SetRGBA(0, 0, c)
+		encoder.image = img
+		encoder.getImagePixels()
+		return color.RGBA{encoder.pixels[0], encoder.pixels[1], encoder.pixels[2], 255}
+	}
+
+	muted := color.RGBA{200, 100, 100, 255}
+	cases := []struct {
+		name string
+		adj  ColorAdjust
+		in   color.RGBA
+		want color.RGBA
+	}{
+		{"identity", ColorAdjust{}, muted, muted},
+		{"saturation", ColorAdjust{Saturation: 2}, muted, color.RGBA{250, 50, 50, 255}},
+		{"desaturation", ColorAdjust{Saturation: 0.01}, muted, color.RGBA{151, 149, 149, 255}},
+		{"contrast", ColorAdjust{Contrast: 2}, muted, color.RGBA{255, 72, 72, 255}},
+		{"low contrast", ColorAdjust{Contrast: 0.5}, muted, color.RGBA{164, 114, 114, 255}},
+		{"brightness", ColorAdjust{Brightness: 0.5}, muted, color.RGBA{110, 39, 39, 255}},
+		{"gamma", ColorAdjust{Gamma: 2}, color.RGBA{64, 128, 255, 255}, color.RGBA{128, 181, 255, 255}},
+		{"gamma below 1", ColorAdjust{Gamma: 0.5}, color.RGBA{64, 128, 255, 255}, color.RGBA{16, 64, 255, 255}},
+		{"clamped", ColorAdjust{Saturation: 5}, muted, color.RGBA{250, 50, 50, 255}},
+	}
+	for _, c := range cases {
+		got := adjusted(c.adj, c.in)
+		if absDiff(uint32(got.R), uint32(c.want.R)) > 1 || absDiff(uint32(got.G), uint32(c.want.G)) > 1 || absDiff(uint32(got.B), uint32(c.want.B)) > 1 {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestProgressCallback(t *testing.T) {
+	frames := movingSquareFrames(5, 32)
+
+	for _, opts := range []EncodeOptions{{}, {Parallelism: 3}, {SharedPalette: true, SharedPaletteFrames: 2}} {
+		var calls [][2]int
+		opts.OnProgress = func(frameIndex, totalFrames int) {
+			calls = append(calls, [2]int{frameIndex, totalFrames})
+		}
+		if _, err := EncodeGIFWithOptions(frames, opts); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+
+		if len(calls) != len(frames) {
+			t.Fatalf("parallelism=%d shared=%v: expected %d calls, got %d", opts.Parallelism, opts.SharedPalette, len(frames), len(calls))
+		}
+		for i, c := range calls {
+			if c != [2]int{i, len(frames)} {
+				t.Errorf("parallelism=%d shared=%v: call %d got (%d, %d)", opts.Parallelism, opts.SharedPalette, i, c[0], c[1])
+			}
+		}
+	}
+}
+
+func TestToStdGIF(t *testing.T) {
+	frames := movingSquareFrames(3, 32)
+
+	g, err := ToStdGIF(frames, EncodeOptions{Delays: []int{100, 250, 500}, Repeat: 3})
+	if err != nil {
+		t.Fatalf("ToStdGIF failed: %v", err)
+	}
+	if len(g.Image) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(g.Image))
+	}
+	want := []int{10, 25, 50}
+	for i, d := range want {
+		if g.Delay[i] != d {
+			t.Errorf("Frame %d: expected delay %d, got %d", i, d, g.Delay[i])
+		}
+	}
+	if g.LoopCount != 3 {
+		t.Errorf("Expected LoopCount 3, got %d", g.LoopCount)
+	}
+	if len(g.Disposal) != 3 {
+		t.Errorf("Expected 3 disposal entries, got %d", len(g.Disposal))
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Errorf("gif.EncodeAll failed: %v", err)
+	}
+}
+
+func TestResizeMode(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	// left half red, right half blue
+	src := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			if x < 50 {
+				src.Set(x, y, red)
+			} else {
+				src.Set(x, y, blue)
+			}
+		}
+	}
+
+	for _, mode := range []ResizeMode{ResizeNearest, ResizeBilinear} {
+		data, err := EncodeGIFWithOptions([]image.Image{src}, EncodeOptions{Width: 50, Height: 50, ResizeMode: mode})
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		decoded, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode GIF: %v", err)
+		}
+		if size := decoded.Bounds().Size(); size != image.Pt(50, 50) {
+			t.Fatalf("Mode %d: expected 50x50, got %v", mode, size)
+		}
+		if c := color.RGBAModel.Convert(decoded.At(10, 25)); c != red {
+			t.Errorf("Mode %d: expected red on the left, got %v", mode, c)
+		}
+		if c := color.RGBAModel.Convert(decoded.At(40, 25)); c != blue {
+			t.Errorf("Mode %d: expected blue on the right, got %v", mode, c)
+		}
+	}
+
+	// a 2:1 frame letterboxed into a square leaves black bars above and below
+	wide := createStripeImage(100, 50, []color.RGBA{red})
+	data, err := EncodeGIFWithOptions([]image.Image{wide}, EncodeOptions{Width: 50, Height: 50, ResizeMode: ResizeBilinear, Letterbox: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	if c := color.RGBAModel.Convert(decoded.At(25, 5)); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Expected a black bar at the top, got %v", c)
+	}
+	if c := color.RGBAModel.Convert(decoded.At(25, 25)).(color.RGBA); c.R < 240 || c.G > 10 || c.B > 10 {
+		t.Errorf("Expected red in the middle, got %v", c)
+	}
+}
+
+func TestAddFrameAt(t *testing.T) {
+	gray := color.RGBA{128, 128, 128, 255}
+	red := color.RGBA{255, 0, 0, 255}
+
+	encoder := NewGIFEncoder(40, 40)
+	if err := encoder.AddFrame(createStripeImage(40, 40, []color.RGBA{gray})); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	if err := encoder.AddFrameAt(createStripeImage(8, 6, []color.RGBA{red}), 10, 20); err != nil {
+		t.Fatalf("AddFrameAt failed: %v", err)
+	}
+	if err := encoder.AddFrameAt(createStripeImage(8, 8, []color.RGBA{red}), 35, 0); err == nil {
+		t.Error("Expected an error for a frame outside the screen")
+	}
+	encoder.Finish()
+	data := encoder.GetData()
+
+	s := parseGIFStructure(t, data)
+	if s.ScreenWidth != 40 || s.ScreenHeight != 40 {
+		t.Errorf("Expected a 40x40 screen, got %dx%d", s.ScreenWidth, s.ScreenHeight)
+	}
+	f := s.Frames[1]
+	if f.Left != 10 || f.Top != 20 || f.Width != 8 || f.Height != 6 {
+		t.Errorf("Expected sub-frame 8x6 at (10,20), got %dx%d at (%d,%d)", f.Width, f.Height, f.Left, f.Top)
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	shown := compositeStdGIF(g)[1]
+	if c := shown.At(12, 22); c != red {
+		t.Errorf("Expected red inside the sub-frame, got %v", c)
+	}
+	if c := shown.At(5, 5); c != gray {
+		t.Errorf("Expected gray outside the sub-frame, got %v", c)
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	encoder := NewGIFEncoder(32, 32)
+	encoder.SetRepeat(0)
+	encoder.SetQuantizerMethod(QuantizerWebSafe)
+
+	var outputs [][]byte
+	for run, frames := range [][]image.Image{movingSquareFrames(3, 32), movingSquareFrames(2, 32)} {
+		if run > 0 {
+			encoder.Reset()
+		}
+		for _, frame := range frames {
+			if err := encoder.AddFrame(frame); err != nil {
+				t.Fatalf("Run %d: AddFrame failed: %v", run, err)
+			}
+		}
+		encoder.Finish()
+		outputs = append(outputs, encoder.GetData())
+	}
+
+	for run, data := range outputs {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Run %d: failed to decode GIF: %v", run, err)
+		}
+		if want := 3 - run; len(g.Image) != want {
+			t.Errorf("Run %d: expected %d frames, got %d", run, want, len(g.Image))
+		}
+		s := parseGIFStructure(t, data)
+		if s.GCTSize != 256 || s.colorTableCount() != 1 {
+			t.Errorf("Run %d: expected the web-safe global palette only, got GCT %d and %d tables", run, s.GCTSize, s.colorTableCount())
+		}
+		if s.LoopCount != 0 {
+			t.Errorf("Run %d: expected loop count 0, got %d", run, s.LoopCount)
+		}
+	}
+}
+
+func TestFrameCount(t *testing.T) {
+	encoder := NewGIFEncoder(32, 32)
+	if n := encoder.FrameCount(); n != 0 {
+		t.Errorf("Expected 0 frames on a new encoder, got %d", n)
+	}
+
+	for i, frame := range movingSquareFrames(3, 32) {
+		if err := encoder.AddFrame(frame); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		if n := encoder.FrameCount(); n != i+1 {
+			t.Errorf("Expected %d frames, got %d", i+1, n)
+		}
+	}
+	encoder.Finish()
+	if n := encoder.FrameCount(); n != 3 {
+		t.Errorf("Expected 3 frames after Finish, got %d", n)
+	}
+
+	encoder.Reset()
+	if n := encoder.FrameCount(); n != 0 {
+		t.Errorf("Expected 0 frames after Reset, got %d", n)
+	}
+}
+
+func TestNewGIFEncoderFromImage(t *testing.T) {
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}
+	encoder, err := NewGIFEncoderFromImage(createStripeImage(24, 10, colors))
+	if err != nil {
+		t.Fatalf("NewGIFEncoderFromImage failed: %v", err)
+	}
+	if encoder.width != 24 || encoder.height != 10 {
+		t.Errorf("expected size 24x10, got %dx%d", encoder.width, encoder.height)
+	}
+	if n := encoder.FrameCount(); n != 1 {
+		t.Errorf("expected 1 frame, got %d", n)
+	}
+
+	// the first frame is written later, with the settings made in between
+	encoder.SetRepeat(0)
+	encoder.SetDelay(200)
+	if err := encoder.AddFrame(createStripeImage(24, 10, colors)); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	encoder.Finish()
+	g, err := gif.DecodeAll(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	if g.Config.Width != 24 || g.Config.Height != 10 || len(g.Image) != 2 {
+		t.Errorf("expected 2 frames of 24x10, got %d of %dx%d", len(g.Image), g.Config.Width, g.Config.Height)
+	}
+	if g.LoopCount != 0 || g.Delay[0] != 20 {
+		t.Errorf("expected the first frame to loop forever with delay 20, got LoopCount %d and delay %d", g.LoopCount, g.Delay[0])
+	}
+
+	// Finish writes a frame that is still held
+	encoder, err = NewGIFEncoderFromImage(createStripeImage(24, 10, colors))
+	if err != nil {
+		t.Fatalf("NewGIFEncoderFromImage failed: %v", err)
+	}
+	encoder.Finish()
+	if g, err = gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil || len(g.Image) != 1 {
+		t.Errorf("expected a GIF with 1 frame, got error %v", err)
+	}
+
+	if _, err := NewGIFEncoderFromImage(image.NewRGBA(image.Rect(0, 0, 0, 5))); err == nil {
+		t.Error("expected an error for an empty image")
+	}
+}
+
+func TestSortPalette(t *testing.T) {
+	// three colors covering 1/8, 3/8 and 1/2 of each frame
+	frame := func(a, b, c color.RGBA) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				switch {
+				case x < 2:
+					img.Set(x, y, a)
+				case x < 8:
+					img.Set(x, y, b)
+				default:
+					img.Set(x, y, c)
+				}
+			}
+		}
+		return img
+	}
+	red, green, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	images := []image.Image{frame(red, green, blue), frame(blue, red, green)}
+
+	data, err := EncodeGIFWithOptions(images, EncodeOptions{SortPalette: true, Quantizer: QuantizerMedianCut})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	s := parseGIFStructure(t, data)
+	if s.LSDFlags&0x08 == 0 {
+		t.Error("expected the global color table sort flag to be set")
+	}
+	if !s.Frames[1].LCTSorted {
+		t.Error("expected the local color table sort flag to be set")
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	for i, img := range g.Image {
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				if got, want := color.RGBAModel.Convert(img.At(x, y)), images[i].At(x, y); got != want {
+					t.Fatalf("frame %d (%d,%d): expected %v, got %v", i, x, y, want, got)
+				}
+			}
+		}
+		// most used color first
+		if c := color.RGBAModel.Convert(img.Palette[0]); c != images[i].At(15, 0) {
+			t.Errorf("frame %d: expected palette to start with %v, got %v", i, images[i].At(15, 0), c)
+		}
+	}
+
+	data, err = EncodeGIFWithOptions(images, EncodeOptions{Quantizer: QuantizerMedianCut})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	if s := parseGIFStructure(t, data); s.LSDFlags&0x08 != 0 || s.Frames[1].LCTSorted {
+		t.Error("expected no sort flags by default")
+	}
+}
+
+func TestSetDelays(t *testing.T) {
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}
+	encoder := NewGIFEncoder(8, 8)
+	encoder.SetDelays([]int{100, 250, 40})
+	for i := 0; i < 4; i++ {
+		if err := encoder.AddFrame(createStripeImage(8, 8, colors)); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.SetDelay(500)
+	if err := encoder.AddFrame(createStripeImage(8, 8, colors)); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	encoder.Finish()
+
+	g, err := gif.DecodeAll(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	// the last value repeats until SetDelay replaces the slice
+	if want := []int{10, 25, 4, 4, 50}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("expected delays %v, got %v", want, g.Delay)
+	}
+
+	// frames held for the shared palette keep their delays
+	encoder = NewGIFEncoder(8, 8)
+	encoder.SetSharedPalette(2)
+	encoder.SetDelays([]int{100, 200, 300})
+	for i := 0; i < 3; i++ {
+		if err := encoder.AddFrame(createStripeImage(8, 8, colors)); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+	if g, err = gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	if want := []int{10, 20, 30}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("shared palette: expected delays %v, got %v", want, g.Delay)
+	}
+
+	// a per-frame delay overrides one frame and keeps the slice for the rest
+	encoder = NewGIFEncoder(8, 8)
+	encoder.SetDelays([]int{100, 200, 300, 400})
+	for i := 0; i < 4; i++ {
+		var opts FrameOptions
+		if i == 1 {
+			opts.DelayMs = 50
+		}
+		if err := encoder.AddFrameWithOptions(createStripeImage(8, 8, colors), opts); err != nil {
+			t.Fatalf("AddFrameWithOptions failed: %v", err)
+		}
+	}
+	encoder.Finish()
+	if g, err = gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	if want := []int{10, 5, 30, 40}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("frame options: expected delays %v, got %v", want, g.Delay)
+	}
+
+	// the per-frame delay survives frames held for the shared palette
+	encoder = NewGIFEncoder(8, 8)
+	encoder.SetSharedPalette(3)
+	encoder.SetDelays([]int{100, 100, 100})
+	for i := 0; i < 3; i++ {
+		var opts FrameOptions
+		if i == 1 {
+			opts.DelayMs = 500
+		}
+		if err := encoder.AddFrameWithOptions(createStripeImage(8, 8, colors), opts); err != nil {
+			t.Fatalf("AddFrameWithOptions failed: %v", err)
+		}
+	}
+	encoder.Finish()
+	if g, err = gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	if want := []int{10, 50, 10}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("shared palette with frame options: expected delays %v, got %v", want, g.Delay)
+	}
+}
+
+func TestSetQualityClamp(t *testing.T) {
+	tests := []struct {
+		quality int
+		want    int
+	}{
+		{-5, 1},
+		{0, 1},
+		{1, 1},
+		{10, 10},
+		{30, 30},
+		{1000, 30},
+	}
+
+	for _, tt := range tests {
+		encoder := NewGIFEncoder(8, 8)
+		encoder.SetQuality(tt.quality)
+		if encoder.sample != tt.want {
+			t.Errorf("SetQuality(%d): sample = %d, want %d", tt.quality, encoder.sample, tt.want)
+		}
+	}
+}
+
+func TestSetRepeatClamp(t *testing.T) {
+	tests := []struct {
+		repeat int
+		want   int // -1 = no Netscape extension
+	}{
+		{0, 0},
+		{5, 5},
+		{65535, 65535},
+		{70000, 65535},
+		{-1, -1},
+		{-7, -1},
+	}
+
+	for _, tt := range tests {
+		encoder := NewGIFEncoder(8, 8)
+		encoder.SetRepeat(tt.repeat)
+		if err := encoder.AddFrame(createStripeImage(8, 8, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		encoder.Finish()
+		data := encoder.GetData()
+
+		if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+			t.Fatalf("SetRepeat(%d): failed to decode GIF: %v", tt.repeat, err)
+		}
+		if s := parseGIFStructure(t, data); s.LoopCount != tt.want {
+			t.Errorf("SetRepeat(%d): expected loop count %d, got %d", tt.repeat, tt.want, s.LoopCount)
+		}
+	}
+}
+
+func TestSetLoopCount(t *testing.T) {
+	for _, tt := range []struct{ count, want int }{{3, 3}, {0, 0}, {70000, 65535}} {
+		encoder := NewGIFEncoder(8, 8)
+		if err := encoder.SetLoopCount(tt.count); err != nil {
+			t.Fatalf("SetLoopCount(%d) failed: %v", tt.count, err)
+		}
+		if err := encoder.AddFrame(createStripeImage(8, 8, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		encoder.Finish()
+
+		if s := parseGIFStructure(t, encoder.GetData()); s.LoopCount != tt.want {
+			t.Errorf("SetLoopCount(%d): expected loop count %d, got %d", tt.count, tt.want, s.LoopCount)
+		}
+	}
+
+	encoder := NewGIFEncoder(8, 8)
+	if err := encoder.SetLoopCount(-1); err == nil {
+		t.Error("expected an error for a negative loop count")
+	}
+}
+
+func TestPosterize(t *testing.T) {
+	encoder := NewGIFEncoder(8, 8)
+	encoder.SetPosterize(3)
+	for v, want := range map[int]byte{0: 0, 63: 0, 64: 128, 191: 128, 192: 255, 255: 255} {
+		if got := encoder.posterize[v]; got != want {
+			t.Errorf("3 levels: %d maps to %d, expected %d", v, got, want)
+		}
+	}
+
+	img := createGradientImage(64, 64)
+	data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Posterize: 2, Quantizer: QuantizerMedianCut})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	// 每个通道只剩 0 和 255, 颜色落在立方体的 8 个顶点上
+	colors := make(map[color.RGBA]bool)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBAModel.Convert(g.Image[0].At(x, y)).(color.RGBA)
+			for _, v := range []byte{c.R, c.G, c.B} {
+				if v != 0 && v != 255 {
+					t.Fatalf("pixel (%d,%d) is %v, expected a corner of the RGB cube", x, y, c)
+				}
+			}
+			colors[c] = true
+		}
+	}
+	if len(colors) > 8 || len(colors) < 2 {
+		t.Errorf("expected 2-8 distinct colors, got %d", len(colors))
+	}
+}
+
+func TestVersion87a(t *testing.T) {
+	frames := movingSquareFrames(3, 16)
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{
+		Version87a:  true,
+		Repeat:      3,
+		Delays:      []int{100, 200, 300},
+		SortPalette: true,
+	})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+
+	if string(data[:6]) != "GIF87a" {
+		t.Errorf("expected a GIF87a header, got %q", data[:6])
+	}
+	s := parseGIFStructure(t, data)
+	if s.ExtensionCount != 0 || s.LoopCount != -1 || s.Frames[0].HasGCE {
+		t.Errorf("expected no extension blocks, got %d", s.ExtensionCount)
+	}
+	if len(s.Frames) != 1 {
+		t.Errorf("expected only the first frame, got %d", len(s.Frames))
+	}
+	if s.LSDFlags&0x08 != 0 || s.AspectRatio != 0 {
+		t.Error("expected the GIF89a sort flag and aspect ratio to be left out")
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if c := color.RGBAModel.Convert(g.Image[0].At(0, 0)); c != color.RGBAModel.Convert(frames[0].At(0, 0)) {
+		t.Errorf("expected the first frame, got %v at (0,0)", c)
+	}
+
+	if err := (EncodeOptions{Version87a: true, AlphaThreshold: 128}).Validate(); err == nil {
+		t.Error("expected an error for transparency in GIF87a")
+	}
+}
+
+func TestTransparencyDisposal(t *testing.T) {
+	tests := []struct {
+		name    string
+		dispose int // -1 = not set
+		want    int
+	}{
+		{"default", -1, DisposalRestoreBackground},
+		{"keep", DisposalKeep, DisposalKeep},
+		{"unspecified", DisposalNone, DisposalNone},
+		{"restore previous", DisposalRestorePrevious, DisposalRestorePrevious},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := NewGIFEncoder(8, 8)
+			encoder.SetTransparent(&color.RGBA{255, 0, 0, 255})
+			if err := encoder.SetDispose(tt.dispose); err != nil {
+				t.Fatalf("SetDispose failed: %v", err)
+			}
+			if err := encoder.AddFrame(createStripeImage(8, 8, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})); err != nil {
+				t.Fatalf("AddFrame failed: %v", err)
+			}
+			encoder.Finish()
+
+			s := parseGIFStructure(t, encoder.GetData())
+			f := s.Frames[0]
+			if !f.Transparent {
+				t.Error("Expected the transparency flag to be set")
+			}
+			if f.Disposal != tt.want {
+				t.Errorf("Expected disposal %d, got %d", tt.want, f.Disposal)
+			}
+		})
+	}
+}
+
+func TestDedupPalettes(t *testing.T) {
+	frame := createGradientImage(32, 32)
+	other := createStripeImage(32, 32, []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}})
+
+	for _, dedup := range []bool{false, true} {
+		data, err := EncodeGIFWithOptions([]image.Image{frame, frame, other}, EncodeOptions{DedupPalettes: dedup})
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Failed to decode GIF: %v", err)
+		}
+
+		s := parseGIFStructure(t, data)
+		want := 3
+		if dedup {
+			// the second frame reuses the global table, the third differs
+			want = 2
+		}
+		if n := s.colorTableCount(); n != want {
+			t.Errorf("DedupPalettes %v: expected %d color tables, got %d", dedup, want, n)
+		}
+	}
+}
+
+func TestTinyFrames(t *testing.T) {
+	pixel := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	pixel.Set(0, 0, color.RGBA{10, 20, 30, 255})
+
+	for _, method := range []QuantizerMethod{QuantizerNeuQuant, QuantizerMedianCut, QuantizerOctree} {
+		for _, dither := range []bool{false, true} {
+			encoder := NewGIFEncoder(1, 1)
+			encoder.SetQuantizerMethod(method)
+			encoder.SetDither(dither)
+			for i := 0; i < 2; i++ {
+				if err := encoder.AddFrame(pixel); err != nil {
+					t.Fatalf("%s dither=%v: AddFrame failed: %v", method, dither, err)
+				}
+			}
+			encoder.Finish()
+
+			g, err := gif.DecodeAll(bytes.NewReader(encoder.GetData()))
+			if err != nil {
+				t.Fatalf("%s dither=%v: failed to decode GIF: %v", method, dither, err)
+			}
+			if len(g.Image) != 2 || g.Image[0].Bounds() != image.Rect(0, 0, 1, 1) {
+				t.Errorf("%s dither=%v: expected two 1x1 frames, got %d", method, dither, len(g.Image))
+			}
+		}
+	}
+
+	for _, size := range []image.Point{{0, 5}, {5, 0}, {0, 0}, {70000, 1}} {
+		encoder := NewGIFEncoder(size.X, size.Y)
+		if err := encoder.AddFrame(pixel); err == nil {
+			t.Errorf("Expected an error for a %dx%d encoder", size.X, size.Y)
+		}
+	}
+}
+
+func TestUsedColorCountLastFrame(t *testing.T) {
+	encoder := NewGIFEncoder(48, 8)
+	encoder.SetQuantizerMethod(QuantizerMedianCut)
+	if n := encoder.UsedColorCountLastFrame(); n != 0 {
+		t.Errorf("Expected 0 before the first frame, got %d", n)
+	}
+
+	for _, colors := range [][]color.RGBA{twelveColors[:3], twelveColors[:1], twelveColors} {
+		if err := encoder.AddFrame(createStripeImage(48, 8, colors)); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		if n := encoder.UsedColorCountLastFrame(); n != len(colors) {
+			t.Errorf("Expected %d used colors, got %d", len(colors), n)
+		}
+	}
+	encoder.Finish()
+}
+
+func TestMinDelay(t *testing.T) {
+	frames := movingSquareFrames(3, 16)
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{
+		Delays:               []int{5, 100, 20},
+		MinDelayCentiseconds: 2,
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	s := parseGIFStructure(t, data)
+	for i, want := range []int{2, 10, 2} {
+		if got := s.Frames[i].Delay; got != want {
+			t.Errorf("Frame %d: expected delay %d, got %d", i, want, got)
+		}
+	}
+}
+
+func TestPlayOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*GIFEncoder)
+		want  int // gif.GIF LoopCount, -1 = no extension
+	}{
+		{"forever", func(e *GIFEncoder) { e.SetRepeat(0) }, 0},
+		{"repeat once", func(e *GIFEncoder) { e.SetRepeat(1) }, 1},
+		{"play once", func(e *GIFEncoder) { e.SetRepeat(3); e.SetPlayOnce() }, 1},
+		{"no extension", func(e *GIFEncoder) { e.SetRepeat(-1) }, -1},
+	}
+
+	for _, tt := range tests {
+		encoder := NewGIFEncoder(16, 16)
+		tt.setup(encoder)
+		for _, frame := range movingSquareFrames(2, 16) {
+			if err := encoder.AddFrame(frame); err != nil {
+				t.Fatalf("%s: AddFrame failed: %v", tt.name, err)
+			}
+		}
+		encoder.Finish()
+
+		g, err := gif.DecodeAll(bytes.NewReader(encoder.GetData()))
+		if err != nil {
+			t.Fatalf("%s: failed to decode GIF: %v", tt.name, err)
+		}
+		if g.LoopCount != tt.want {
+			t.Errorf("%s: expected LoopCount %d, got %d", tt.name, tt.want, g.LoopCount)
+		}
+	}
+}
+
+func TestMinimalExtensions(t *testing.T) {
+	still := createStripeImage(16, 8, twelveColors[:3])
+
+	for _, minimal := range []bool{false, true} {
+		data, err := EncodeGIFWithOptions([]image.Image{still}, EncodeOptions{MinimalExtensions: minimal})
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Failed to decode GIF: %v", err)
+		}
+		if s := parseGIFStructure(t, data); s.Frames[0].HasGCE == minimal {
+			t.Errorf("MinimalExtensions %v: expected HasGCE %v", minimal, !minimal)
+		}
+	}
+
+	// animations keep their delays
+	data, err := EncodeGIFWithOptions(movingSquareFrames(3, 16), EncodeOptions{MinimalExtensions: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	for i, f := range parseGIFStructure(t, data).Frames {
+		if !f.HasGCE || f.Delay != 10 {
+			t.Errorf("Frame %d: expected a GCE with delay 10, got %+v", i, f)
+		}
+	}
+}
+
+func BenchmarkImagePixelsRGBA(b *testing.B) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 1000))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	encoder := NewGIFEncoder(1000, 1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encoder.image = img
+		encoder.getImagePixels()
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"image/color"
 	"os"
 
-	"gifencoder"
+	"github.com/ManInM00N/nicogif"
 )
 
 func main() {
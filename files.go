@@ -0,0 +1,178 @@
+package gifencoder
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF for image.Decode
+	_ "image/jpeg" // register JPEG for image.Decode
+	_ "image/png"  // register PNG for image.Decode
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EncodeGIFFromFiles decodes the image files at paths (PNG, JPEG, GIF or
+// any other format registered with the image package) and encodes them as
+// frames. All images must have the same size. delays, in milliseconds,
+// replaces opts.Delays when not nil.
+func EncodeGIFFromFiles(paths []string, delays []int, opts EncodeOptions) ([]byte, error) {
+	images, err := loadImages(paths)
+	if err != nil {
+		return nil, err
+	}
+	if delays != nil {
+		opts.Delays = delays
+	}
+	return EncodeGIFWithOptions(images, opts)
+}
+
+// EncodeGIFFromGlob encodes the image files matching pattern, see
+// filepath.Match for the syntax, as frames in natural order, so frame2 comes
+// before frame10. Every frame is shown for delayMs milliseconds, a delayMs
+// of 0 or less keeps opts.Delays.
+func EncodeGIFFromGlob(pattern string, delayMs int, opts EncodeOptions) ([]byte, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %q", pattern)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return naturalLess(paths[i], paths[j])
+	})
+
+	var delays []int
+	if delayMs > 0 {
+		delays = make([]int, len(paths))
+		for i := range delays {
+			delays[i] = delayMs
+		}
+	}
+	return EncodeGIFFromFiles(paths, delays, opts)
+}
+
+// naturalLess compares strings treating runs of digits as numbers, so
+// "a2" sorts before "a10". Numerically equal runs such as "01" and "1"
+// fall back to plain string order.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			// 去掉前导零后先比较位数再逐位比较
+			na := strings.TrimLeft(a[si:i], "0")
+			nb := strings.TrimLeft(b[sj:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// loadImages decodes the image files at paths, checking they share one size
+func loadImages(paths []string) ([]image.Image, error) {
+	images := make([]image.Image, 0, len(paths))
+	for _, path := range paths {
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(images) > 0 {
+			want, got := images[0].Bounds().Size(), img.Bounds().Size()
+			if got != want {
+				return nil, fmt.Errorf("%s: size %dx%d differs from %dx%d of %s", path, got.X, got.Y, want.X, want.Y, paths[0])
+			}
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// loadImage decodes a single image file
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// EncodeToFile encodes frames and writes the GIF to path. The data goes to
+// a temporary file in the same directory that is renamed over path once
+// complete, so a failure never leaves a truncated GIF behind. A new file
+// gets mode 0644, a replaced one keeps its mode. Encoding
+// errors are returned wrapped with an "encode gif" prefix, file system
+// errors wrap the underlying *fs.PathError or *os.LinkError.
+func EncodeToFile(path string, frames []image.Image, opts EncodeOptions) error {
+	encoder, err := encodeImages(context.Background(), frames, opts)
+	if err != nil {
+		return fmt.Errorf("encode gif: %w", err)
+	}
+	defer encoder.CleanupAll()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write gif: %w", err)
+	}
+	// no-op once the rename succeeded
+	defer os.Remove(tmp.Name())
+
+	if _, err := encoder.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write gif: %w", err)
+	}
+	// CreateTemp makes the file 0600, give it the mode of the file it
+	// replaces or the usual 0644, and flush it to disk before the rename
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write gif: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write gif: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write gif: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write gif: %w", err)
+	}
+	return nil
+}
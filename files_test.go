@@ -0,0 +1,161 @@
+package gifencoder
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writePNG saves img as a PNG file in dir and returns its path
+func writePNG(t *testing.T, dir, name string, img image.Image) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("Failed to encode %s: %v", path, err)
+	}
+	return path
+}
+
+func TestEncodeGIFFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	red := writePNG(t, dir, "red.png", createStripeImage(16, 8, []color.RGBA{{255, 0, 0, 255}}))
+	blue := writePNG(t, dir, "blue.png", createStripeImage(16, 8, []color.RGBA{{0, 0, 255, 255}}))
+
+	data, err := EncodeGIFFromFiles([]string{red, blue}, []int{100, 200}, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeGIFFromFiles failed: %v", err)
+	}
+	s := parseGIFStructure(t, data)
+	if len(s.Frames) != 2 || s.ScreenWidth != 16 || s.ScreenHeight != 8 {
+		t.Fatalf("Expected 2 frames of 16x8, got %d frames of %dx%d", len(s.Frames), s.ScreenWidth, s.ScreenHeight)
+	}
+	if s.Frames[1].Delay != 20 {
+		t.Errorf("Expected second frame delay 20, got %d", s.Frames[1].Delay)
+	}
+
+	small := writePNG(t, dir, "small.png", createStripeImage(8, 8, []color.RGBA{{0, 255, 0, 255}}))
+	if _, err := EncodeGIFFromFiles([]string{red, small}, nil, EncodeOptions{}); err == nil || !strings.Contains(err.Error(), "small.png") {
+		t.Errorf("Expected a size mismatch error naming small.png, got %v", err)
+	}
+
+	broken := filepath.Join(dir, "broken.png")
+	if err := os.WriteFile(broken, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncodeGIFFromFiles([]string{red, broken}, nil, EncodeOptions{}); err == nil || !strings.Contains(err.Error(), "broken.png") {
+		t.Errorf("Expected a decode error naming broken.png, got %v", err)
+	}
+}
+
+func TestEncodeGIFFromGlob(t *testing.T) {
+	dir := t.TempDir()
+	colors := map[string]color.RGBA{
+		"a1.png":  {255, 0, 0, 255},
+		"a2.png":  {0, 255, 0, 255},
+		"a10.png": {0, 0, 255, 255},
+	}
+	for name, c := range colors {
+		writePNG(t, dir, name, createStripeImage(16, 8, []color.RGBA{c}))
+	}
+
+	data, err := EncodeGIFFromGlob(filepath.Join(dir, "a*.png"), 150, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeGIFFromGlob failed: %v", err)
+	}
+	frames, delays, err := DecodeGIF(data)
+	if err != nil {
+		t.Fatalf("DecodeGIF failed: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(frames))
+	}
+	for i, name := range []string{"a1.png", "a2.png", "a10.png"} {
+		got := color.RGBAModel.Convert(frames[i].At(4, 4)).(color.RGBA)
+		want := colors[name]
+		if absDiff(uint32(got.R), uint32(want.R)) > 8 || absDiff(uint32(got.G), uint32(want.G)) > 8 ||
+			absDiff(uint32(got.B), uint32(want.B)) > 8 {
+			t.Errorf("Frame %d: expected %s (%v), got %v", i, name, want, got)
+		}
+		if delays[i] != 150 {
+			t.Errorf("Frame %d: expected delay 150, got %d", i, delays[i])
+		}
+	}
+
+	if _, err := EncodeGIFFromGlob(filepath.Join(dir, "none*.png"), 100, EncodeOptions{}); err == nil {
+		t.Error("Expected an error when nothing matches")
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	sorted := []string{"a", "a01", "a1", "a2", "a10", "a10b", "a10c", "b1", "frame2.png", "frame10.png"}
+	for i := range sorted {
+		for j := range sorted {
+			if got := naturalLess(sorted[i], sorted[j]); got != (i < j) {
+				t.Errorf("naturalLess(%q, %q) = %v", sorted[i], sorted[j], got)
+			}
+		}
+	}
+}
+
+func TestEncodeToFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.gif")
+	frames := []image.Image{createGradientImage(16, 16), createGradientImage(16, 16)}
+
+	if err := EncodeToFile(path, frames, EncodeOptions{}); err != nil {
+		t.Fatalf("EncodeToFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if !strings.HasPrefix(string(data), "GIF89a") || data[len(data)-1] != 0x3b {
+		t.Error("Expected the file to start with GIF89a and end with the trailer")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the GIF in the directory, found %d entries", len(entries))
+	}
+
+	// new files are readable by everyone, replaced ones keep their mode
+	if runtime.GOOS != "windows" {
+		perm := func() os.FileMode {
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			return fi.Mode().Perm()
+		}
+		if p := perm(); p != 0644 {
+			t.Errorf("Expected mode 0644, got %v", p)
+		}
+		if err := os.Chmod(path, 0640); err != nil {
+			t.Fatalf("Chmod failed: %v", err)
+		}
+		if err := EncodeToFile(path, frames, EncodeOptions{}); err != nil {
+			t.Fatalf("EncodeToFile failed: %v", err)
+		}
+		if p := perm(); p != 0640 {
+			t.Errorf("Expected the replaced file to keep mode 0640, got %v", p)
+		}
+	}
+
+	var pathErr *fs.PathError
+	if err := EncodeToFile(filepath.Join(dir, "missing", "out.gif"), frames, EncodeOptions{}); !errors.As(err, &pathErr) {
+		t.Errorf("Expected a file system error, got %v", err)
+	}
+	if err := EncodeToFile(path, nil, EncodeOptions{}); err == nil || errors.As(err, &pathErr) {
+		t.Errorf("Expected an encode error, got %v", err)
+	}
+}
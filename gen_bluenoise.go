@@ -0,0 +1,143 @@
+//go:build ignore
+
+// gen_bluenoise writes bluenoise_table.go, the blue-noise threshold mask
+// used by DitherBlueNoise. Run it with go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// blueNoiseSize must match the constant in bluenoise.go
+const blueNoiseSize = 64
+
+func main() {
+	m := voidAndCluster(blueNoiseSize, 1.5, 1)
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen_bluenoise.go; DO NOT EDIT.\n\n")
+	b.WriteString("package gifencoder\n\n")
+	b.WriteString("// blueNoiseTable holds the ranks of the 64x64 blue-noise mask row by row\n")
+	fmt.Fprintf(&b, "var blueNoiseTable = [blueNoiseSize * blueNoiseSize]uint16{\n")
+	for _, row := range m {
+		for i, v := range row {
+			if i%16 == 0 {
+				b.WriteString("\t")
+			}
+			fmt.Fprintf(&b, "%d,", v)
+			if i%16 == 15 {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+	}
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("bluenoise_table.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// voidAndCluster ranks the cells of an n×n torus so that every set of the
+// lowest ranks is evenly spread (Ulichney 1993). sigma is the width of the
+// Gaussian used to measure clustering, seed fixes the initial pattern.
+func voidAndCluster(n int, sigma float64, seed int64) [][]int {
+	total := n * n
+
+	// 环面上的高斯权重，按坐标差索引
+	kernel := make([]float64, total)
+	for dy := 0; dy < n; dy++ {
+		for dx := 0; dx < n; dx++ {
+			x, y := math.Min(float64(dx), float64(n-dx)), math.Min(float64(dy), float64(n-dy))
+			kernel[dy*n+dx] = math.Exp(-(x*x + y*y) / (2 * sigma * sigma))
+		}
+	}
+
+	set := make([]bool, total)
+	energy := make([]float64, total)
+	toggle := func(p int, on bool) {
+		set[p] = on
+		sign := 1.0
+		if !on {
+			sign = -1
+		}
+		px, py := p%n, p/n
+		for y := 0; y < n; y++ {
+			row := ((y - py + n) % n) * n
+			for x := 0; x < n; x++ {
+				energy[y*n+x] += sign * kernel[row+(x-px+n)%n]
+			}
+		}
+	}
+	// tightestCluster 找能量最高的已设置像素，largestVoid 找能量最低的空像素
+	tightestCluster := func() int {
+		best := -1
+		for p := range set {
+			if set[p] && (best < 0 || energy[p] > energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+	largestVoid := func() int {
+		best := -1
+		for p := range set {
+			if !set[p] && (best < 0 || energy[p] < energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+
+	// initial pattern: a tenth of the cells at random, then spread evenly by
+	// moving the tightest cluster to the largest void until nothing moves
+	rng := rand.New(rand.NewSource(seed))
+	ones := total / 10
+	for _, p := range rng.Perm(total)[:ones] {
+		toggle(p, true)
+	}
+	for {
+		cluster := tightestCluster()
+		toggle(cluster, false)
+		void := largestVoid()
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	prototype := append([]bool(nil), set...)
+	protoEnergy := append([]float64(nil), energy...)
+
+	ranks := make([]int, total)
+	// 从原型中依次移除最密集的点，得到较低的排名
+	for rank := ones - 1; rank >= 0; rank-- {
+		p := tightestCluster()
+		toggle(p, false)
+		ranks[p] = rank
+	}
+	// 从原型开始依次填入最大的空隙，得到较高的排名
+	copy(set, prototype)
+	copy(energy, protoEnergy)
+	for rank := ones; rank < total; rank++ {
+		p := largestVoid()
+		toggle(p, true)
+		ranks[p] = rank
+	}
+
+	matrix := make([][]int, n)
+	for y := range matrix {
+		matrix[y] = ranks[y*n : (y+1)*n]
+	}
+	return matrix
+}
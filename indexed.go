@@ -0,0 +1,80 @@
+package gifencoder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+)
+
+// EncodeFramesIndexed runs the color pipeline of EncodeGIFWithOptions,
+// quantization, dithering and palette handling, without the GIF container.
+// It returns one index buffer per frame, width*height bytes in row order,
+// and the palette each buffer refers to as [r,g,b,r,g,b,...] of at most 256
+// colors. Frames with the same palette, as with a global palette, share
+// the same slice. Options about the container and timing, such as delays,
+// OptimizeFrames and CoalesceIdentical, are ignored, and transparency is
+// not reported.
+func EncodeFramesIndexed(frames []image.Image, opts EncodeOptions) ([][]byte, [][]byte, error) {
+	return encodeFramesIndexed(context.Background(), frames, opts)
+}
+
+// QuantizeResult is the outcome of QuantizeAsync
+type QuantizeResult struct {
+	Palette []byte // [r,g,b,r,g,b,...] of at most 256 colors
+	Indices []byte // width*height palette indices in row order
+	Err     error  // ctx.Err() when cancelled
+}
+
+// QuantizeAsync quantizes img as EncodeFramesIndexed would in a new
+// goroutine, so the next frame can be prepared while the current one is
+// written. The returned channel delivers exactly one result and is then
+// closed. Cancelling ctx stops the work early with ctx.Err().
+func QuantizeAsync(ctx context.Context, img image.Image, opts EncodeOptions) <-chan QuantizeResult {
+	results := make(chan QuantizeResult, 1)
+	go func() {
+		defer close(results)
+		indices, palettes, err := encodeFramesIndexed(ctx, []image.Image{img}, opts)
+		if err != nil {
+			results <- QuantizeResult{Err: err}
+			return
+		}
+		results <- QuantizeResult{Palette: palettes[0], Indices: indices[0]}
+	}()
+	return results
+}
+
+func encodeFramesIndexed(ctx context.Context, frames []image.Image, opts EncodeOptions) ([][]byte, [][]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(frames) == 0 {
+		return nil, nil, errors.New("no images provided")
+	}
+
+	// 每帧都需要完整的索引
+	opts.OptimizeFrames = false
+	encoder := encoderForImages(frames, opts)
+	defer encoder.CleanupAll()
+
+	indices := make([][]byte, 0, len(frames))
+	palettes := make([][]byte, 0, len(frames))
+	encoder.indexSink = func(pix, colorTab []byte) {
+		indices = append(indices, append([]byte(nil), pix...))
+		if n := len(palettes); n > 0 && bytes.Equal(palettes[n-1], colorTab) {
+			palettes = append(palettes, palettes[n-1])
+			return
+		}
+		palettes = append(palettes, append([]byte(nil), colorTab...))
+	}
+
+	for _, img := range frames {
+		if err := encoder.AddFrameContext(ctx, img); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := encoder.FinishContext(ctx); err != nil {
+		return nil, nil, err
+	}
+	return indices, palettes, nil
+}
@@ -0,0 +1,89 @@
+package gifencoder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeFramesIndexed(t *testing.T) {
+	frames := []image.Image{
+		createGradientImage(40, 30),
+		createStripeImage(40, 30, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}),
+		createGradientImage(40, 30),
+	}
+
+	for _, opts := range []EncodeOptions{
+		{Dither: DitherFloydSteinberg},
+		{AutoGlobalPalette: true},
+		{SharedPalette: true, SharedPaletteFrames: 2, OptimizeFrames: true},
+	} {
+		indices, palettes, err := EncodeFramesIndexed(frames, opts)
+		if err != nil {
+			t.Fatalf("EncodeFramesIndexed failed: %v", err)
+		}
+		if len(indices) != len(frames) || len(palettes) != len(frames) {
+			t.Fatalf("expected %d frames, got %d index buffers and %d palettes", len(frames), len(indices), len(palettes))
+		}
+		for i := range frames {
+			if len(indices[i]) != 40*30 {
+				t.Errorf("%+v frame %d: expected %d indices, got %d", opts, i, 40*30, len(indices[i]))
+			}
+			if len(palettes[i]) == 0 || len(palettes[i]) > 768 || len(palettes[i])%3 != 0 {
+				t.Errorf("%+v frame %d: invalid palette of %d bytes", opts, i, len(palettes[i]))
+			}
+			for _, index := range indices[i] {
+				if int(index)*3 >= len(palettes[i]) {
+					t.Fatalf("%+v frame %d: index %d outside the palette", opts, i, index)
+				}
+			}
+		}
+		if opts.Dither == nil && &palettes[0][0] != &palettes[2][0] {
+			t.Errorf("%+v: expected frames to share the global palette", opts)
+		}
+	}
+
+	// the red stripe keeps its color
+	indices, palettes, err := EncodeFramesIndexed(frames[1:2], EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeFramesIndexed failed: %v", err)
+	}
+	i := int(indices[0][0]) * 3
+	if palettes[0][i] < 240 || palettes[0][i+1] > 15 || palettes[0][i+2] > 15 {
+		t.Errorf("expected red at the first pixel, got %v", palettes[0][i:i+3])
+	}
+
+	if _, _, err := EncodeFramesIndexed(nil, EncodeOptions{}); err == nil {
+		t.Error("expected an error without frames")
+	}
+}
+
+func TestQuantizeAsync(t *testing.T) {
+	img := createGradientImage(40, 30)
+	opts := EncodeOptions{Dither: DitherFloydSteinberg}
+
+	wantIndices, wantPalettes, err := EncodeFramesIndexed([]image.Image{img}, opts)
+	if err != nil {
+		t.Fatalf("EncodeFramesIndexed failed: %v", err)
+	}
+
+	res, ok := <-QuantizeAsync(context.Background(), img, opts)
+	if !ok {
+		t.Fatal("channel closed without a result")
+	}
+	if res.Err != nil {
+		t.Fatalf("QuantizeAsync failed: %v", res.Err)
+	}
+	if !bytes.Equal(res.Indices, wantIndices[0]) || !bytes.Equal(res.Palette, wantPalettes[0]) {
+		t.Error("asynchronous result differs from EncodeFramesIndexed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := <-QuantizeAsync(ctx, img, opts); !errors.Is(res.Err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", res.Err)
+	}
+}
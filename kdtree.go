@@ -0,0 +1,136 @@
+package gifencoder
+
+import "sort"
+
+// kdNode is a palette color stored in a kdTree
+type kdNode struct {
+	c           [3]int // r, g, b
+	index       int    // palette index
+	axis        int    // splitting channel
+	left, right int    // child nodes, -1 if none
+}
+
+// kdTree answers nearest-color queries on a fixed palette in roughly
+// O(log n) instead of scanning every entry
+type kdTree struct {
+	nodes []kdNode
+	root  int
+}
+
+// newKDTree builds a tree over a palette [r,g,b,r,g,b,...]
+func newKDTree(palette []byte) *kdTree {
+	n := len(palette) / 3
+	nodes := make([]kdNode, n)
+	order := make([]int, n)
+	for i := range nodes {
+		nodes[i] = kdNode{
+			c:     [3]int{int(palette[i*3]), int(palette[i*3+1]), int(palette[i*3+2])},
+			index: i,
+			left:  -1,
+			right: -1,
+		}
+		order[i] = i
+	}
+	t := &kdTree{nodes: nodes}
+	t.root = t.build(order)
+	return t
+}
+
+// build splits the nodes in order at the median of their widest channel
+// and returns the subtree root
+func (t *kdTree) build(order []int) int {
+	if len(order) == 0 {
+		return -1
+	}
+
+	var lo, hi [3]int
+	lo = [3]int{255, 255, 255}
+	for _, i := range order {
+		for a := 0; a < 3; a++ {
+			if v := t.nodes[i].c[a]; v < lo[a] {
+				lo[a] = v
+			}
+			if v := t.nodes[i].c[a]; v > hi[a] {
+				hi[a] = v
+			}
+		}
+	}
+	axis := 0
+	for a := 1; a < 3; a++ {
+		if hi[a]-lo[a] > hi[axis]-lo[axis] {
+			axis = a
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return t.nodes[order[i]].c[axis] < t.nodes[order[j]].c[axis]
+	})
+	mid := len(order) / 2
+	root := order[mid]
+	t.nodes[root].axis = axis
+	t.nodes[root].left = t.build(order[:mid])
+	t.nodes[root].right = t.build(order[mid+1:])
+	return root
+}
+
+// nearest returns the palette index closest to r, g, b. Ties go to the
+// lowest index, matching a linear scan.
+func (t *kdTree) nearest(r, g, b byte) int {
+	q := [3]int{int(r), int(g), int(b)}
+	best, bestD := 0, 1<<30
+
+	// pending far sides with the squared distance to their splitting plane
+	var stack [64]struct{ node, planeD int }
+	sp := 0
+	stack[sp].node, stack[sp].planeD = t.root, 0
+	sp++
+	for sp > 0 {
+		sp--
+		n := stack[sp].node
+		// the far side can only hold a closer (or equally close) color if
+		// the splitting plane is within the best distance
+		if stack[sp].planeD > bestD {
+			continue
+		}
+		for n >= 0 {
+			node := &t.nodes[n]
+			dr := q[0] - node.c[0]
+			dg := q[1] - node.c[1]
+			db := q[2] - node.c[2]
+			if d := dr*dr + dg*dg + db*db; d < bestD || (d == bestD && node.index < best) {
+				best = node.index
+				bestD = d
+			}
+
+			diff := q[node.axis] - node.c[node.axis]
+			near, far := node.left, node.right
+			if diff >= 0 {
+				near, far = far, near
+			}
+			if far >= 0 && diff*diff <= bestD {
+				stack[sp].node, stack[sp].planeD = far, diff*diff
+				sp++
+			}
+			n = near
+		}
+	}
+	return best
+}
+
+// closestInPalette finds the palette color closest to r, g, b with a
+// linear scan
+func closestInPalette(palette []byte, r, g, b byte) int {
+	minpos := 0
+	dmin := 256 * 256 * 256
+	for i, index := 0, 0; i+2 < len(palette); i, index = i+3, index+1 {
+		dr := int(r) - int(palette[i])
+		dg := int(g) - int(palette[i+1])
+		db := int(b) - int(palette[i+2])
+		d := dr*dr + dg*dg + db*db
+		if d < dmin {
+			dmin = d
+			minpos = index
+		}
+	}
+	return minpos
+}
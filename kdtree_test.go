@@ -0,0 +1,60 @@
+package gifencoder
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// randomPalette returns n random colors, with some duplicates to exercise ties
+func randomPalette(rng *rand.Rand, n int) []byte {
+	palette := make([]byte, n*3)
+	rng.Read(palette)
+	for i := 3; i+2 < len(palette); i += 9 {
+		copy(palette[i:i+3], palette[i-3:i])
+	}
+	return palette
+}
+
+func TestKDTreeMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for _, n := range []int{1, 2, 3, 17, 64, 256} {
+		palette := randomPalette(rng, n)
+		tree := newKDTree(palette)
+		for q := 0; q < 20000; q++ {
+			r, g, b := byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256))
+			if q%4 == 0 {
+				// exact palette colors
+				i := rng.Intn(n) * 3
+				r, g, b = palette[i], palette[i+1], palette[i+2]
+			}
+			want := closestInPalette(palette, r, g, b)
+			if got := tree.nearest(r, g, b); got != want {
+				t.Fatalf("%d colors: query (%d,%d,%d) got index %d, linear scan %d", n, r, g, b, got, want)
+			}
+		}
+	}
+}
+
+// benchmarkFrame is the RGB data of a 1000x1000 frame
+var benchmarkFrame = rgbPixels(createGradientImage(1000, 1000))
+
+func BenchmarkNearestLinear(b *testing.B) {
+	palette := randomPalette(rand.New(rand.NewSource(2)), 256)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for k := 0; k < len(benchmarkFrame); k += 3 {
+			closestInPalette(palette, benchmarkFrame[k], benchmarkFrame[k+1], benchmarkFrame[k+2])
+		}
+	}
+}
+
+func BenchmarkNearestKDTree(b *testing.B) {
+	palette := randomPalette(rand.New(rand.NewSource(2)), 256)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree := newKDTree(palette)
+		for k := 0; k < len(benchmarkFrame); k += 3 {
+			tree.nearest(benchmarkFrame[k], benchmarkFrame[k+1], benchmarkFrame[k+2])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package gifencoder
+
+import "math"
+
+// srgbToLinear maps an 8-bit sRGB channel to linear light
+var srgbToLinear = func() [256]float64 {
+	var t [256]float64
+	for i := range t {
+		c := float64(i) / 255.0
+		if c <= 0.04045 {
+			t[i] = c / 12.92
+		} else {
+			t[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return t
+}()
+
+// labColor is a color in CIE L*a*b* space
+type labColor struct {
+	l, a, b float64
+}
+
+// rgbToLab converts an sRGB color to CIE L*a*b* under the D65 white point
+func rgbToLab(r, g, b byte) labColor {
+	lr, lg, lb := srgbToLinear[r], srgbToLinear[g], srgbToLinear[b]
+
+	// 线性 RGB -> XYZ, 按 D65 白点归一化
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / 0.95047
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389.0 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27.0*t + 16.0) / 116.0
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return labColor{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// SetPerceptualMatch makes nearest-color matching compare colors by their
+// distance in CIE Lab (delta E 1976) instead of RGB, which keeps skin tones
+// and skies closer to the source at some CPU cost. Only the mapping of
+// pixels to the color table changes, palettes are still built by the
+// quantizer with its own metric, NeuQuant for example trains in RGB.
+// Monochrome output keeps its luminance threshold.
+func (ge *GIFEncoder) SetPerceptualMatch(perceptual bool) {
+	ge.perceptual = perceptual
+}
+
+// labPalette returns the current color table in Lab, converted again only
+// when the table changes
+func (ge *GIFEncoder) labPalette() []labColor {
+	if len(ge.labTab) != len(ge.colorTab) ||
+		(len(ge.colorTab) > 0 && &ge.labTab[0] != &ge.colorTab[0]) {
+		// a new slice, frame workers may share the previous one
+		labs := make([]labColor, 0, len(ge.colorTab)/3)
+		for i := 0; i+2 < len(ge.colorTab); i += 3 {
+			labs = append(labs, rgbToLab(ge.colorTab[i], ge.colorTab[i+1], ge.colorTab[i+2]))
+		}
+		ge.labColors = labs
+		ge.labTab = ge.colorTab
+	}
+	return ge.labColors
+}
+
+// findClosestLab finds the palette color with the smallest delta E to r, g, b
+func (ge *GIFEncoder) findClosestLab(r, g, b byte) int {
+	c := rgbToLab(r, g, b)
+	minpos := 0
+	dmin := math.MaxFloat64
+	for i, p := range ge.labPalette() {
+		dl, da, db := c.l-p.l, c.a-p.a, c.b-p.b
+		if d := dl*dl + da*da + db*db; d < dmin {
+			dmin = d
+			minpos = i
+		}
+	}
+	return minpos
+}
@@ -0,0 +1,63 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"testing"
+)
+
+func TestRGBToLab(t *testing.T) {
+	tests := []struct {
+		r, g, b byte
+		want    labColor
+	}{
+		{0, 0, 0, labColor{0, 0, 0}},
+		{255, 255, 255, labColor{100, 0, 0}},
+		{255, 0, 0, labColor{53.24, 80.09, 67.20}},
+		{0, 0, 255, labColor{32.30, 79.19, -107.86}},
+	}
+	for _, tt := range tests {
+		got := rgbToLab(tt.r, tt.g, tt.b)
+		if math.Abs(got.l-tt.want.l) > 0.05 || math.Abs(got.a-tt.want.a) > 0.05 || math.Abs(got.b-tt.want.b) > 0.05 {
+			t.Errorf("rgbToLab(%d, %d, %d) = %+v, want %+v", tt.r, tt.g, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPerceptualMatch(t *testing.T) {
+	// the green is closer in RGB, the pink is closer in Lab
+	pixel := color.RGBA{62, 54, 142, 255}
+	green := color.RGBA{30, 163, 107, 255}
+	pink := color.RGBA{219, 177, 214, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.Set(i%4, i/4, pixel)
+	}
+
+	for _, tt := range []struct {
+		perceptual bool
+		want       color.RGBA
+	}{
+		{false, green},
+		{true, pink},
+	} {
+		data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{
+			GlobalPaletteColors: color.Palette{green, pink},
+			PerceptualMatch:     tt.perceptual,
+		})
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		g, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode GIF: %v", err)
+		}
+		if got := color.RGBAModel.Convert(g.At(1, 1)); got != tt.want {
+			t.Errorf("PerceptualMatch %v: expected %v, got %v", tt.perceptual, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package gifencoder
+
+import "math"
+
+// linearSteps is the resolution of the linear light to sRGB table
+const linearSteps = 4096
+
+// linearToSRGB maps linear light, quantized to linearSteps levels, back to
+// an 8-bit sRGB channel
+var linearToSRGB = func() [linearSteps + 1]byte {
+	var t [linearSteps + 1]byte
+	for i := range t {
+		c := float64(i) / linearSteps
+		if c <= 0.0031308 {
+			c *= 12.92
+		} else {
+			c = 1.055*math.Pow(c, 1/2.4) - 0.055
+		}
+		t[i] = byte(math.Min(255, c*255+0.5))
+	}
+	return t
+}()
+
+// SetLinearLightDither makes error diffusion dithering measure and spread
+// the quantization error in linear light instead of gamma encoded sRGB,
+// so a mix of dithered colors averages to the brightness of the source and
+// gradients no longer come out too bright between palette colors. Only the
+// diffused error is linear: palettes are still built and nearest colors
+// still matched in sRGB, as 8-bit linear values would band the shadows.
+// Without an error diffusion dither method it has no effect, ordered and
+// blue-noise dithering are not affected either.
+func (ge *GIFEncoder) SetLinearLightDither(linear bool) {
+	ge.linearLight = linear
+}
+
+// toDitherSpace returns channel value v as used for error diffusion, linear
+// light scaled to 0-255 when SetLinearLightDither is on
+func (ge *GIFEncoder) toDitherSpace(v byte) float64 {
+	if ge.linearLight {
+		return srgbToLinear[v] * 255
+	}
+	return float64(v)
+}
+
+// fromDitherSpace converts an accumulated channel value back to 8-bit sRGB,
+// clamped to 0-255
+func (ge *GIFEncoder) fromDitherSpace(v float64) byte {
+	if !ge.linearLight {
+		return clampFloat(v + 0.5)
+	}
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return linearToSRGB[int(v/255*linearSteps+0.5)]
+}
@@ -0,0 +1,67 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"testing"
+)
+
+// rampError encodes a horizontal gray ramp dithered to black and white and
+// returns the mean difference in linear light between each source column
+// and the average of its output pixels
+func rampError(t *testing.T, linear bool) float64 {
+	const w, h = 64, 64
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / (w - 1))
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{
+		GlobalPaletteColors: color.Palette{color.Black, color.White},
+		Dither:              DitherFloydSteinberg,
+		LinearLightDither:   linear,
+	})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	out, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+
+	total := 0.0
+	for x := 0; x < w; x++ {
+		sum := 0.0
+		for y := 0; y < h; y++ {
+			r, _, _, _ := out.At(x, y).RGBA()
+			sum += srgbToLinear[r>>8]
+		}
+		src := srgbToLinear[uint8(x*255/(w-1))]
+		total += math.Abs(sum/h - src)
+	}
+	return total / w
+}
+
+func TestLinearLightDither(t *testing.T) {
+	srgb := rampError(t, false)
+	linear := rampError(t, true)
+	if linear >= srgb/2 {
+		t.Errorf("expected linear light dithering to halve the error, got %.4f with and %.4f without", linear, srgb)
+	}
+}
+
+func TestLinearLightRoundTrip(t *testing.T) {
+	encoder := NewGIFEncoder(1, 1)
+	encoder.SetLinearLightDither(true)
+	for v := 0; v < 256; v++ {
+		if got := encoder.fromDitherSpace(encoder.toDitherSpace(byte(v))); got != byte(v) {
+			t.Errorf("channel %d: round trip gave %d", v, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package gifencoder
+
+// lookupCacheBits is the number of bits per channel used to pick a cache slot
+const lookupCacheBits = 5
+
+// lookupCache remembers recent nearest-color results. Each slot covers a
+// 5-bit-per-channel cell and stores the exact color it was computed for,
+// so a hit always returns the same index as an uncached lookup.
+type lookupCache struct {
+	keys  [1 << (3 * lookupCacheBits)]uint32 // packed RGB | cacheValid, 0 = empty
+	index [1 << (3 * lookupCacheBits)]byte
+}
+
+// cacheValid marks a used slot, packed RGB only takes 24 bits
+const cacheValid = 1 << 24
+
+// resetLookupCache empties the cache, needed whenever the color table changes
+func (ge *GIFEncoder) resetLookupCache() {
+	if ge.lookupCache == nil {
+		ge.lookupCache = new(lookupCache)
+		return
+	}
+	ge.lookupCache.keys = [len(ge.lookupCache.keys)]uint32{}
+}
+
+// findClosestCached is findClosestRGB backed by the lookup cache, for the
+// per-pixel loops where flat regions repeat the same color many times
+func (ge *GIFEncoder) findClosestCached(r, g, b byte) int {
+	c := ge.lookupCache
+	slot := int(r>>(8-lookupCacheBits))<<(2*lookupCacheBits) |
+		int(g>>(8-lookupCacheBits))<<lookupCacheBits |
+		int(b>>(8-lookupCacheBits))
+	key := packRGB(r, g, b) | cacheValid
+	if c.keys[slot] == key {
+		return int(c.index[slot])
+	}
+
+	index := ge.findClosestRGB(r, g, b)
+	c.keys[slot] = key
+	c.index[slot] = byte(index)
+	return index
+}
@@ -0,0 +1,63 @@
+package gifencoder
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// newIndexingEncoder returns an encoder with a NeuQuant palette trained on
+// pixels, ready for indexPixels
+func newIndexingEncoder(pixels []byte) *GIFEncoder {
+	ge := NewGIFEncoder(1, 1)
+	q := NewNeuQuant(pixels, 10)
+	q.BuildColormap()
+	ge.quantizer = q
+	ge.colorTab = q.GetColormap()
+	ge.pixels = pixels
+	return ge
+}
+
+func TestLookupCacheMatchesUncached(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	pixels := make([]byte, 64*64*3)
+	rng.Read(pixels)
+
+	for _, withQuantizer := range []bool{true, false} {
+		ge := newIndexingEncoder(pixels)
+		if !withQuantizer {
+			ge.quantizer = nil
+		}
+		ge.resetLookupCache()
+		for i := 0; i < 200000; i++ {
+			// a narrow range makes slots collide often
+			r, g, b := byte(rng.Intn(24)), byte(rng.Intn(24)), byte(100+rng.Intn(24))
+			if got, want := ge.findClosestCached(r, g, b), ge.findClosestRGB(r, g, b); got != want {
+				t.Fatalf("quantizer=%v: (%d,%d,%d) cached %d, uncached %d", withQuantizer, r, g, b, got, want)
+			}
+		}
+	}
+}
+
+// fewColorFrame is the RGB data of a 1000x1000 frame with large flat areas
+var fewColorFrame = rgbPixels(createStripeImage(1000, 1000, []color.RGBA{
+	{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {40, 40, 40, 255},
+}))
+
+func BenchmarkIndexPixelsUncached(b *testing.B) {
+	ge := newIndexingEncoder(fewColorFrame)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for k := 0; k < len(fewColorFrame); k += 3 {
+			ge.findClosestRGB(fewColorFrame[k], fewColorFrame[k+1], fewColorFrame[k+2])
+		}
+	}
+}
+
+func BenchmarkIndexPixelsCached(b *testing.B) {
+	ge := newIndexingEncoder(fewColorFrame)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ge.indexPixels()
+	}
+}
@@ -0,0 +1,202 @@
+package gifencoder
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// lzwEncode compresses indices with LZWEncoder and returns the minimum code
+// size and the image data with its sub-block framing removed
+func lzwEncode(t *testing.T, indices []byte, colorDepth int) (int, []byte) {
+	t.Helper()
+	out := NewByteArray()
+	NewLZWEncoder(len(indices), 1, indices, colorDepth).Encode(out)
+	raw := out.GetData()
+
+	var data []byte
+	pos := 1
+	for raw[pos] != 0 {
+		n := int(raw[pos])
+		data = append(data, raw[pos+1:pos+1+n]...)
+		pos += n + 1
+	}
+	if pos != len(raw)-1 {
+		t.Fatalf("Expected block terminator at the end, found it at %d of %d", pos, len(raw))
+	}
+	return int(raw[0]), data
+}
+
+func TestLZWRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	cases := []struct {
+		name       string
+		colorDepth int
+		indices    []byte
+	}{
+		{"empty", 2, []byte{}},
+		{"single", 2, []byte{3}},
+		{"repeated", 2, bytes.Repeat([]byte{1}, 5000)},
+		{"kwkwk", 2, []byte{0, 0, 0, 0, 0, 0, 1, 1, 1}},
+		{"pattern", 4, bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 300)},
+		{"random", 8, nil},
+		{"random-low-depth", 3, nil},
+	}
+	for _, c := range cases {
+		if c.indices == nil {
+			// enough noise to fill the 12-bit table several times
+			c.indices = make([]byte, 60000)
+			for i := range c.indices {
+				c.indices[i] = byte(rng.Intn(1 << c.colorDepth))
+			}
+		}
+
+		minCodeSize, data := lzwEncode(t, c.indices, c.colorDepth)
+		got, err := NewLZWDecoder(minCodeSize).Decode(data, len(c.indices))
+		if err != nil {
+			t.Errorf("%s: Decode failed: %v", c.name, err)
+			continue
+		}
+		if !bytes.Equal(got, c.indices) {
+			t.Errorf("%s: decoded indices differ from the input", c.name)
+		}
+	}
+}
+
+func TestLZWMinCodeSize(t *testing.T) {
+	indices := bytes.Repeat([]byte{0, 1, 2, 3}, 64)
+
+	for _, c := range []struct{ colors, want int }{
+		{2, 2}, {4, 2}, {5, 3}, {16, 4}, {256, 8},
+	} {
+		minCodeSize, data := lzwEncode(t, indices, colorDepthFor(c.colors))
+		if minCodeSize != c.want {
+			t.Errorf("%d colors: expected minimum code size %d, got %d", c.colors, c.want, minCodeSize)
+		}
+		got, err := NewLZWDecoder(minCodeSize).Decode(data, len(indices))
+		if err != nil || !bytes.Equal(got, indices) {
+			t.Errorf("%d colors: round trip failed: %v", c.colors, err)
+		}
+	}
+}
+
+func TestLZWDeferredClear(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	// few colors fill the code table with long strings that stay useful
+	noise := make([]byte, 100000)
+	for i := range noise {
+		noise[i] = byte(rng.Intn(4))
+	}
+
+	cases := []struct {
+		name    string
+		indices []byte
+	}{
+		{"repetitive", bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 9, 8, 7}, 20000)},
+		{"noise", noise},
+	}
+	for _, c := range cases {
+		encode := func(deferClear bool) []byte {
+			out := NewByteArray()
+			enc := NewLZWEncoder(len(c.indices), 1, c.indices, 4)
+			enc.SetDeferredClear(deferClear)
+			enc.Encode(out)
+			return out.GetData()
+		}
+		eager, deferred := encode(false), encode(true)
+
+		if len(deferred) > len(eager) {
+			t.Errorf("%s: deferred clear output %d bytes, larger than %d", c.name, len(deferred), len(eager))
+		}
+
+		// strip the sub-block framing and decode
+		var data []byte
+		for pos := 1; deferred[pos] != 0; pos += int(deferred[pos]) + 1 {
+			data = append(data, deferred[pos+1:pos+1+int(deferred[pos])]...)
+		}
+		got, err := NewLZWDecoder(int(deferred[0])).Decode(data, len(c.indices))
+		if err != nil {
+			t.Errorf("%s: Decode failed: %v", c.name, err)
+			continue
+		}
+		if !bytes.Equal(got, c.indices) {
+			t.Errorf("%s: decoded indices differ from the input", c.name)
+		}
+	}
+}
+
+func TestLZWDecodeErrors(t *testing.T) {
+	indices := bytes.Repeat([]byte{0, 1, 2, 3}, 100)
+	minCodeSize, data := lzwEncode(t, indices, 2)
+
+	if _, err := NewLZWDecoder(minCodeSize).Decode(data, len(indices)+10); err == nil {
+		t.Error("Expected an error when the data holds fewer pixels than requested")
+	}
+	if _, err := NewLZWDecoder(minCodeSize).Decode(data, len(indices)-10); err == nil {
+		t.Error("Expected an error when the data holds more pixels than requested")
+	}
+	if _, err := NewLZWDecoder(12).Decode(data, len(indices)); err == nil {
+		t.Error("Expected an error for an invalid minimum code size")
+	}
+}
+
+func TestLZWHashSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	indices := make([]byte, 100000)
+	for i := range indices {
+		indices[i] = byte(rng.Intn(16) * rng.Intn(16))
+	}
+	want := NewByteArray()
+	NewLZWEncoder(500, 200, indices, 8).Encode(want)
+
+	// 哈希表大小只影响速度和内存, 不影响输出
+	for _, hsize := range []int{0, 4099, 5003, 20011, 1048573} {
+		enc, err := NewLZWEncoderWithOptions(500, 200, indices, 8, hsize)
+		if err != nil {
+			t.Fatalf("hsize %d: %v", hsize, err)
+		}
+		out := NewByteArray()
+		enc.Encode(out)
+		if !bytes.Equal(out.GetData(), want.GetData()) {
+			t.Errorf("hsize %d: output differs from the default hash size", hsize)
+		}
+	}
+
+	for _, hsize := range []int{-1, 4093, 5000, 1<<20 + 7} {
+		if _, err := NewLZWEncoderWithOptions(500, 200, indices, 8, hsize); err == nil {
+			t.Errorf("hsize %d: expected an error", hsize)
+		}
+	}
+}
+
+func BenchmarkLZWHashSize(b *testing.B) {
+	// 4000x4000 indexed frame of smooth regions with some noise
+	const size = 4000
+	rng := rand.New(rand.NewSource(3))
+	indices := make([]byte, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := (x/50 + y/70) % 64
+			if rng.Intn(8) == 0 {
+				v = rng.Intn(256)
+			}
+			indices[y*size+x] = byte(v)
+		}
+	}
+
+	for _, hsize := range []int{4099, 5003, 20011, 80021, 1048573} {
+		b.Run(fmt.Sprintf("hsize=%d", hsize), func(b *testing.B) {
+			out := NewByteArray()
+			for i := 0; i < b.N; i++ {
+				enc, err := NewLZWEncoderWithOptions(size, size, indices, 8, hsize)
+				if err != nil {
+					b.Fatal(err)
+				}
+				out.Reset()
+				enc.Encode(out)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package gifencoder
+
+import (
+	"image"
+	"image/color"
+)
+
+// SetOptimizeFrames enables inter-frame transparency optimization. Pixels
+// that did not change since the previous frame are written as the
+// transparent index, and frames use disposal 1 (do not dispose) so the
+// previous frame shows through. The first frame is always fully opaque.
+// Optimization is skipped while a transparent color or index is set, and
+// for frames added with a FrameOptions.TransparentIndex.
+func (ge *GIFEncoder) SetOptimizeFrames(optimize bool) {
+	ge.optimize = optimize
+	if !optimize {
+		ge.prevPixels = nil
+		ge.unchanged = nil
+	}
+}
+
+// diffPixels compares the current frame's pixels with the previous frame
+// and records the unchanged ones in ge.unchanged. The current pixels are
+// kept as reference for the next frame.
+func (ge *GIFEncoder) diffPixels() {
+	ge.unchanged = nil
+
+	if !ge.optimize || ge.hasTransparency() || ge.frameTransIndex != nil {
+		ge.prevPixels = nil
+		return
+	}
+
+	if !ge.firstFrame && len(ge.prevPixels) == len(ge.pixels) {
+		ge.frameRect = ge.computeDirtyRect(ge.prevPixels, ge.pixels)
+		nPix := len(ge.pixels) / 3
+		ge.unchanged = make([]bool, nPix)
+		for j, k := 0, 0; j < nPix; j, k = j+1, k+3 {
+			ge.unchanged[j] = ge.pixels[k] == ge.prevPixels[k] &&
+				ge.pixels[k+1] == ge.prevPixels[k+1] &&
+				ge.pixels[k+2] == ge.prevPixels[k+2]
+		}
+	}
+
+	// ge.pixels is released after indexing, keep a copy for the next frame
+	if len(ge.prevPixels) != len(ge.pixels) {
+		ge.prevPixels = make([]byte, len(ge.pixels))
+	}
+	copy(ge.prevPixels, ge.pixels)
+}
+
+// computeDirtyRect returns the smallest rectangle containing every pixel
+// that differs between prev and cur. Identical frames yield a 1x1 rectangle
+// at the origin since an image descriptor can't be empty.
+func (ge *GIFEncoder) computeDirtyRect(prev, cur []byte) image.Rectangle {
+	minX, minY := ge.width, ge.height
+	maxX, maxY := -1, -1
+
+	for y := 0; y < ge.height; y++ {
+		row := y * ge.width * 3
+		for x := 0; x < ge.width; x++ {
+			k := row + x*3
+			if prev[k] == cur[k] && prev[k+1] == cur[k+1] && prev[k+2] == cur[k+2] {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			maxY = y
+		}
+	}
+
+	if maxX < 0 {
+		return image.Rect(0, 0, 1, 1)
+	}
+	return image.Rect(minX, minY, maxX+1, maxY+1)
+}
+
+// cropIndexedPixels keeps only the indexed pixels inside frameRect
+func (ge *GIFEncoder) cropIndexedPixels() {
+	r := ge.frameRect
+	if r == image.Rect(0, 0, ge.width, ge.height) {
+		return
+	}
+
+	cropped := make([]byte, 0, r.Dx()*r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		cropped = append(cropped, ge.indexedPixels[y*ge.width+r.Min.X:y*ge.width+r.Max.X]...)
+	}
+	ge.indexedPixels = cropped
+}
+
+// changedPixels returns the RGB bytes of the pixels that differ from the
+// previous frame and are not below the alpha threshold, used to train the
+// quantizer on what is actually drawn
+func (ge *GIFEncoder) changedPixels() []byte {
+	if ge.unchanged == nil && ge.transMask == nil {
+		return ge.pixels
+	}
+
+	changed := make([]byte, 0, len(ge.pixels))
+	for j := 0; j < len(ge.pixels)/3; j++ {
+		if (ge.unchanged != nil && ge.unchanged[j]) || (ge.transMask != nil && ge.transMask[j]) {
+			continue
+		}
+		changed = append(changed, ge.pixels[j*3], ge.pixels[j*3+1], ge.pixels[j*3+2])
+	}
+	if len(changed) == 0 {
+		// nothing visible, any palette will do
+		return ge.pixels
+	}
+	return changed
+}
+
+// applyUnchangedMask maps every unchanged pixel to a palette slot reserved
+// for transparency
+func (ge *GIFEncoder) applyUnchangedMask() {
+	if ge.unchanged == nil {
+		return
+	}
+
+	counts := make([]int, 256)
+	for j, same := range ge.unchanged {
+		if !same {
+			counts[ge.indexedPixels[j]]++
+		}
+	}
+
+	ge.transIndex = ge.reserveTransparentIndex(counts, ge.unchanged)
+	for j, same := range ge.unchanged {
+		if same {
+			ge.indexedPixels[j] = byte(ge.transIndex)
+		}
+	}
+	ge.usedEntry[ge.transIndex] = true
+}
+
+// reserveTransparentIndex returns a palette slot no opaque pixel uses.
+// counts holds how many opaque pixels use each entry, skip marks pixels
+// that are not opaque. If every slot is taken, the least used entry is
+// freed by moving its pixels to their next closest color.
+func (ge *GIFEncoder) reserveTransparentIndex(counts []int, skip []bool) int {
+	nColors := len(ge.colorTab) / 3
+	limit := len(counts)
+	if ge.globalPalette != nil {
+		// the global table size is fixed by the first frame
+		limit = 1 << colorDepthFor(nColors)
+	}
+	if nColors < limit {
+		// a slot past the end of the table is free
+		for i := nColors; i < limit; i++ {
+			if counts[i] == 0 {
+				return i
+			}
+		}
+	}
+
+	victim := 0
+	for i := 0; i < nColors && i < len(counts); i++ {
+		if counts[i] < counts[victim] {
+			victim = i
+		}
+	}
+	if counts[victim] == 0 {
+		return victim
+	}
+
+	// 将被占用颜色的像素重新映射到次接近的颜色
+	r := ge.colorTab[victim*3]
+	g := ge.colorTab[victim*3+1]
+	b := ge.colorTab[victim*3+2]
+	replacement := ge.findClosestExcluding(r, g, b, victim)
+	for j, index := range ge.indexedPixels {
+		if int(index) == victim && (skip == nil || !skip[j]) {
+			ge.indexedPixels[j] = byte(replacement)
+		}
+	}
+	return victim
+}
+
+// findClosestExcluding finds the closest palette color other than exclude
+func (ge *GIFEncoder) findClosestExcluding(r, g, b byte, exclude int) int {
+	minpos := 0
+	dmin := 256 * 256 * 256
+	for i, index := 0, 0; i+2 < len(ge.colorTab); i, index = i+3, index+1 {
+		if index == exclude {
+			continue
+		}
+		dr := int(r) - int(ge.colorTab[i])
+		dg := int(g) - int(ge.colorTab[i+1])
+		db := int(b) - int(ge.colorTab[i+2])
+		d := dr*dr + dg*dg + db*db
+		if d < dmin {
+			dmin = d
+			minpos = index
+		}
+	}
+	return minpos
+}
+
+// DiffMask compares two frames as the frame optimization does and returns
+// a mask that is 255 where a pixel changed and 0 elsewhere, together with
+// the bounding rectangle of the changes, empty when there are none. Frames
+// are aligned at their top left corners as the encoder places them. When
+// their sizes differ the mask covers both, and pixels only one of them has
+// count as changed. A nil frame has no pixels.
+func DiffMask(prev, cur image.Image) (*image.Gray, image.Rectangle) {
+	var prevSize, curSize image.Point
+	if prev != nil {
+		prevSize = prev.Bounds().Size()
+	}
+	if cur != nil {
+		curSize = cur.Bounds().Size()
+	}
+	w, h := prevSize.X, prevSize.Y
+	if curSize.X > w {
+		w = curSize.X
+	}
+	if curSize.Y > h {
+		h = curSize.Y
+	}
+
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	var dirty image.Rectangle
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := image.Pt(x, y)
+			inPrev := p.In(image.Rectangle{Max: prevSize})
+			inCur := p.In(image.Rectangle{Max: curSize})
+			if inPrev && inCur && sameColor(prev.At(prev.Bounds().Min.X+x, prev.Bounds().Min.Y+y),
+				cur.At(cur.Bounds().Min.X+x, cur.Bounds().Min.Y+y)) {
+				continue
+			}
+			mask.Pix[y*mask.Stride+x] = 0xff
+			dirty = dirty.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return mask, dirty
+}
+
+// sameColor reports whether a and b are equal at 8 bits per channel, the
+// precision pixels are compared with when encoding
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1>>8 == r2>>8 && g1>>8 == g2>>8 && b1>>8 == b2>>8 && a1>>8 == a2>>8
+}
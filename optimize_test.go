@@ -0,0 +1,227 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+)
+
+// movingSquareFrames creates frames with a static tiled background and a
+// small square moving across it
+func movingSquareFrames(n, size int) []image.Image {
+	frames := make([]image.Image, n)
+	for f := 0; f < n; f++ {
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				img.Set(x, y, color.RGBA{uint8(x * 4 / size * 60), uint8(y * 4 / size * 60), 128, 255})
+			}
+		}
+		for y := 20; y < 30; y++ {
+			for x := 5 + f*8; x < 15+f*8; x++ {
+				img.Set(x, y, color.RGBA{255, 255, 0, 255})
+			}
+		}
+		frames[f] = img
+	}
+	return frames
+}
+
+// compositeStdGIF renders every frame of a decoded GIF onto a canvas,
+// honoring transparency, and returns the canvas after each frame
+func compositeStdGIF(g *gif.GIF) []*image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	result := make([]*image.RGBA, len(g.Image))
+	for i, frame := range g.Image {
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		snapshot := image.NewRGBA(canvas.Bounds())
+		copy(snapshot.Pix, canvas.Pix)
+		result[i] = snapshot
+	}
+	return result
+}
+
+func TestOptimizeFramesShrinksOutput(t *testing.T) {
+	frames := movingSquareFrames(10, 200)
+
+	plain, err := EncodeGIFWithOptions(frames, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	optimized, err := EncodeGIFWithOptions(frames, EncodeOptions{OptimizeFrames: true})
+	if err != nil {
+		t.Fatalf("Optimized encode failed: %v", err)
+	}
+
+	if len(optimized)*2 > len(plain) {
+		t.Errorf("Expected optimized output to be less than half: %d vs %d bytes", len(optimized), len(plain))
+	}
+	t.Logf("plain %d bytes, optimized %d bytes", len(plain), len(optimized))
+
+	s := parseGIFStructure(t, optimized)
+	if s.Frames[0].Transparent {
+		t.Error("First frame must stay fully opaque")
+	}
+	for i, f := range s.Frames[1:] {
+		if !f.Transparent || f.Disposal != 1 {
+			t.Errorf("Frame %d: expected transparency with disposal 1, got transparent=%v disposal=%d", i+1, f.Transparent, f.Disposal)
+		}
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(optimized))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	last := compositeStdGIF(g)[len(g.Image)-1]
+	want := frames[len(frames)-1]
+	for y := 0; y < 200; y += 3 {
+		for x := 0; x < 200; x += 3 {
+			r1, g1, b1, _ := last.At(x, y).RGBA()
+			r2, g2, b2, _ := want.At(x, y).RGBA()
+			if absDiff(r1>>8, r2>>8) > 40 || absDiff(g1>>8, g2>>8) > 40 || absDiff(b1>>8, b2>>8) > 40 {
+				t.Fatalf("Composited pixel (%d,%d) = %d,%d,%d, want %d,%d,%d", x, y, r1>>8, g1>>8, b1>>8, r2>>8, g2>>8, b2>>8)
+			}
+		}
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestOptimizeFramesDirtyRect(t *testing.T) {
+	frames := movingSquareFrames(5, 100)
+
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{OptimizeFrames: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	s := parseGIFStructure(t, data)
+	if len(s.Frames) != 5 {
+		t.Fatalf("Expected 5 frames, got %d", len(s.Frames))
+	}
+	first := s.Frames[0]
+	if first.Left != 0 || first.Top != 0 || first.Width != 100 || first.Height != 100 {
+		t.Errorf("First frame should cover the canvas, got %+v", first)
+	}
+
+	// the square moves 8px right each frame: old and new positions are dirty
+	for f := 1; f < 5; f++ {
+		got := s.Frames[f]
+		want := image.Rect(5+(f-1)*8, 20, 15+f*8, 30)
+		if got.Left != want.Min.X || got.Top != want.Min.Y || got.Width != want.Dx() || got.Height != want.Dy() {
+			t.Errorf("Frame %d: expected bounds %v, got (%d,%d) %dx%d", f, want, got.Left, got.Top, got.Width, got.Height)
+		}
+	}
+
+	if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+		t.Errorf("Failed to decode GIF: %v", err)
+	}
+}
+
+func TestComputeDirtyRect(t *testing.T) {
+	encoder := NewGIFEncoder(4, 3)
+	prev := make([]byte, 4*3*3)
+	cur := make([]byte, 4*3*3)
+
+	if r := encoder.computeDirtyRect(prev, cur); r != image.Rect(0, 0, 1, 1) {
+		t.Errorf("Identical frames: expected 1x1 rect, got %v", r)
+	}
+
+	cur[(1*4+2)*3] = 255 // (2,1)
+	cur[(2*4+1)*3+2] = 7 // (1,2)
+	if r := encoder.computeDirtyRect(prev, cur); r != image.Rect(1, 1, 3, 3) {
+		t.Errorf("Expected rect (1,1)-(3,3), got %v", r)
+	}
+}
+
+func TestOptimizeFramesWithTransparentIndex(t *testing.T) {
+	frames := movingSquareFrames(3, 64)
+
+	encoder := NewGIFEncoder(64, 64)
+	encoder.SetOptimizeFrames(true)
+	transIndex := 0
+	for i, img := range frames {
+		var opts FrameOptions
+		if i == 1 {
+			opts.TransparentIndex = &transIndex
+		}
+		if err := encoder.AddFrameWithOptions(img, opts); err != nil {
+			t.Fatalf("AddFrameWithOptions failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	g, err := gif.DecodeAll(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+
+	// the frame with its own transparent index is written whole, every
+	// opaque pixel must show the source color
+	frame := g.Image[1]
+	if frame.Bounds() != frames[1].Bounds() {
+		t.Fatalf("Frame with TransparentIndex should cover the canvas, got %v", frame.Bounds())
+	}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if frame.ColorIndexAt(x, y) == uint8(transIndex) {
+				continue
+			}
+			r1, g1, b1, _ := frame.At(x, y).RGBA()
+			r2, g2, b2, _ := frames[1].At(x, y).RGBA()
+			if absDiff(r1>>8, r2>>8) > 40 || absDiff(g1>>8, g2>>8) > 40 || absDiff(b1>>8, b2>>8) > 40 {
+				t.Fatalf("Pixel (%d,%d) = %d,%d,%d, want %d,%d,%d", x, y, r1>>8, g1>>8, b1>>8, r2>>8, g2>>8, b2>>8)
+			}
+		}
+	}
+}
+
+func TestDiffMask(t *testing.T) {
+	frames := movingSquareFrames(1, 32)
+	prev := frames[0].(*image.RGBA)
+	cur := image.NewRGBA(prev.Bounds())
+	copy(cur.Pix, prev.Pix)
+	changed := image.Rect(5, 7, 12, 10)
+	draw.Draw(cur, changed, image.NewUniform(color.RGBA{1, 2, 3, 255}), image.Point{}, draw.Src)
+
+	mask, rect := DiffMask(prev, cur)
+	if rect != changed {
+		t.Errorf("expected changes in %v, got %v", changed, rect)
+	}
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			want := uint8(0)
+			if image.Pt(x, y).In(changed) {
+				want = 0xff
+			}
+			if got := mask.GrayAt(x, y).Y; got != want {
+				t.Fatalf("mask at (%d,%d) is %d, expected %d", x, y, got, want)
+			}
+		}
+	}
+
+	if _, rect := DiffMask(prev, prev); !rect.Empty() {
+		t.Errorf("expected no changes between identical frames, got %v", rect)
+	}
+
+	// 尺寸不同时, 只有一帧覆盖的像素算作变化
+	small := prev.SubImage(image.Rect(0, 0, 16, 16))
+	mask, rect = DiffMask(small, prev)
+	if mask.Bounds() != prev.Bounds() || rect != image.Rect(0, 0, 32, 32) {
+		t.Errorf("expected a 32x32 mask and changes in the uncovered area, got %v and %v", mask.Bounds(), rect)
+	}
+	if mask.GrayAt(3, 3).Y != 0 || mask.GrayAt(20, 3).Y != 0xff || mask.GrayAt(3, 20).Y != 0xff {
+		t.Error("expected the shared area unchanged and the rest changed")
+	}
+	if mask, rect := DiffMask(nil, small); rect != image.Rect(0, 0, 16, 16) || mask.Bounds().Dx() != 16 {
+		t.Errorf("expected a nil previous frame to mark everything, got %v", rect)
+	}
+}
@@ -0,0 +1,114 @@
+package gifencoder
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// canEncodeParallel reports whether frames can be quantized and compressed
+// independently. Each frame must get its own local color table, so global
+// and shared palettes, a custom quantizer shared by all frames, and frame
+// optimization, which compares against the previous frame, rule it out.
+func (ge *GIFEncoder) canEncodeParallel() bool {
+	return ge.globalPalette == nil &&
+		ge.sharedFrames == 0 &&
+		ge.customQuantizer == nil &&
+		ge.frameTransIndex == nil &&
+		!ge.optimize
+}
+
+// frameWorker returns a copy of the encoder that writes a single frame,
+// with its local color table, to its own output buffer
+func (ge *GIFEncoder) frameWorker(delayMs int) *GIFEncoder {
+	w := *ge
+	w.out = getByteArray()
+	w.firstFrame = false
+	w.usedEntry = make([]bool, 256)
+	w.prevPixels = nil
+	w.pending = nil
+	w.lookupCache = nil
+	w.pixelBuf = nil
+	w.progress = nil
+	w.frameStats = nil
+	w.SetDelay(delayMs)
+	return &w
+}
+
+// addFramesParallel adds images with the given delays in milliseconds,
+// quantizing and compressing up to workers frames at a time. The first
+// frame is written directly since it carries the global color table, the
+// others are encoded into separate buffers and appended in order. It falls
+// back to adding frames one by one when canEncodeParallel is false.
+// workers < 1 uses runtime.NumCPU().
+func (ge *GIFEncoder) addFramesParallel(ctx context.Context, images []image.Image, delays []int, workers int) error {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	serial := len(images)
+	if workers > 1 && ge.canEncodeParallel() {
+		serial = 0
+		if ge.firstFrame {
+			serial = 1
+		}
+	}
+	for i := 0; i < serial && i < len(images); i++ {
+		ge.SetDelay(delays[i])
+		if err := ge.AddFrameContext(ctx, images[i]); err != nil {
+			return err
+		}
+	}
+	start := serial
+	if start >= len(images) {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*GIFEncoder, len(images))
+	errs := make([]error, len(images))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := start; i < len(images); i++ {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+
+		results[i] = ge.frameWorker(delays[i])
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := results[i].AddFrameContext(ctx, images[i]); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range results[start:] {
+		w.out.WriteTo(ge.out)
+		putByteArray(w.out)
+		ge.lastColorTab = w.lastColorTab
+		ge.lastTransIndex = w.lastTransIndex
+		ge.lastUsedColors = w.lastUsedColors
+		ge.lastStats = w.lastStats
+		ge.frameWritten()
+	}
+	ge.SetDelay(delays[len(delays)-1])
+	return nil
+}
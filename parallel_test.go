@@ -0,0 +1,67 @@
+package gifencoder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParallelMatchesSerial(t *testing.T) {
+	frames := movingSquareFrames(7, 48)
+	delays := []int{100, 200, 300, 100, 200, 300, 100}
+
+	for _, opts := range []EncodeOptions{
+		{Delays: delays},
+		{Delays: delays, Dither: DitherFloydSteinberg},
+		{Delays: delays, OptimizeFrames: true}, // falls back to serial
+	} {
+		serial, err := EncodeGIFWithOptions(frames, opts)
+		if err != nil {
+			t.Fatalf("Serial encode failed: %v", err)
+		}
+		opts.Parallelism = 4
+		parallel, err := EncodeGIFWithOptions(frames, opts)
+		if err != nil {
+			t.Fatalf("Parallel encode failed: %v", err)
+		}
+		if !bytes.Equal(serial, parallel) {
+			t.Errorf("dither=%v optimize=%v: parallel output differs from serial", opts.Dither, opts.OptimizeFrames)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	frames := movingSquareFrames(5, 48)
+
+	for _, opts := range []EncodeOptions{
+		{Deterministic: true, Parallelism: -1},
+		{Deterministic: true, Parallelism: 4, Dither: DitherFloydSteinberg, Quantizer: QuantizerMedianCut},
+		{Deterministic: true, Dither: DitherBlueNoise, SharedPalette: true, OptimizeFrames: true},
+	} {
+		first, err := EncodeGIFWithOptions(frames, opts)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		for run := 0; run < 3; run++ {
+			again, err := EncodeGIFWithOptions(frames, opts)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if !bytes.Equal(first, again) {
+				t.Errorf("dither=%v quantizer=%q: run %d differs from the first", opts.Dither, opts.Quantizer, run+1)
+			}
+		}
+	}
+}
+
+func benchmarkEncodeParallelism(b *testing.B, parallelism int) {
+	frames := movingSquareFrames(16, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeGIFWithOptions(frames, EncodeOptions{Parallelism: parallelism}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeSerial(b *testing.B)   { benchmarkEncodeParallelism(b, 1) }
+func BenchmarkEncodeParallel(b *testing.B) { benchmarkEncodeParallelism(b, -1) }
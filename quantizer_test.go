@@ -0,0 +1,737 @@
+package gifencoder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"math/rand"
+	"testing"
+)
+
+// twelveColors is a synthetic flat-UI palette
+var twelveColors = []color.RGBA{
+	{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 0, 255},
+	{0, 255, 255, 255}, {255, 0, 255, 255}, {255, 255, 255, 255}, {0, 0, 0, 255},
+	{128, 128, 128, 255}, {200, 100, 50, 255}, {30, 60, 90, 255}, {250, 240, 230, 255},
+}
+
+// createStripeImage creates an image with vertical stripes of the given colors
+func createStripeImage(w, h int, colors []color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, colors[(x*len(colors))/w])
+		}
+	}
+	return img
+}
+
+// rgbPixels flattens an image into the encoder's RGB layout
+func rgbPixels(img *image.RGBA) []byte {
+	b := img.Bounds()
+	pixels := make([]byte, 0, b.Dx()*b.Dy()*3)
+	for i := 0; i < len(img.Pix); i += 4 {
+		pixels = append(pixels, img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+	}
+	return pixels
+}
+
+func TestMedianCutExactPalette(t *testing.T) {
+	img := createStripeImage(48, 10, twelveColors)
+
+	mc := NewMedianCutQuantizer(rgbPixels(img), 256)
+	mc.BuildColormap()
+	colormap := mc.GetColormap()
+
+	if len(colormap) != len(twelveColors)*3 {
+		t.Fatalf("Expected %d palette entries, got %d", len(twelveColors), len(colormap)/3)
+	}
+
+	for _, c := range twelveColors {
+		i := mc.LookupRGB(c.R, c.G, c.B)
+		if colormap[i*3] != c.R || colormap[i*3+1] != c.G || colormap[i*3+2] != c.B {
+			t.Errorf("Color %v mapped to %v", c, colormap[i*3:i*3+3])
+		}
+	}
+}
+
+func TestMedianCutReducesColors(t *testing.T) {
+	img := createStripeImage(48, 10, twelveColors)
+
+	mc := NewMedianCutQuantizer(rgbPixels(img), 4)
+	mc.BuildColormap()
+	if n := len(mc.GetColormap()) / 3; n != 4 {
+		t.Errorf("Expected 4 palette entries, got %d", n)
+	}
+}
+
+func TestNeuQuantVsMedianCutExactness(t *testing.T) {
+	img := createStripeImage(48, 10, twelveColors)
+
+	countExact := func(method QuantizerMethod) int {
+		data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Quantizer: method})
+		if err != nil {
+			t.Fatalf("Encode with %s failed: %v", method, err)
+		}
+		decoded, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Decode with %s failed: %v", method, err)
+		}
+		exact := 0
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 48; x++ {
+				if color.RGBAModel.Convert(decoded.At(x, y)) == img.At(x, y) {
+					exact++
+				}
+			}
+		}
+		return exact
+	}
+
+	if exact := countExact(QuantizerMedianCut); exact != 48*10 {
+		t.Errorf("MedianCut reproduced %d of %d pixels exactly", exact, 48*10)
+	}
+	if mcExact, nqExact := countExact(QuantizerMedianCut), countExact(QuantizerNeuQuant); mcExact < nqExact {
+		t.Errorf("MedianCut (%d exact) worse than NeuQuant (%d exact)", mcExact, nqExact)
+	}
+}
+
+func BenchmarkMedianCutNoise(b *testing.B) {
+	pixels := make([]byte, 1000*1000*3)
+	rand.New(rand.NewSource(1)).Read(pixels)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mc := NewMedianCutQuantizer(pixels, 256)
+		mc.BuildColormap()
+	}
+}
+
+func TestNeuQuantOverrideColor(t *testing.T) {
+	nq := NewNeuQuant(rgbPixels(createGradientImage(64, 64)), 10)
+	if err := nq.OverrideColor(0, 255, 0, 255); err == nil {
+		t.Error("expected an error before BuildColormap")
+	}
+	nq.BuildColormap()
+
+	// 渐变图中没有品红, 替换一个条目后附近的颜色应映射到它
+	before := nq.LookupRGB(250, 10, 245)
+	index := (before + 128) % 256
+	if err := nq.OverrideColor(index, 255, 0, 255); err != nil {
+		t.Fatalf("OverrideColor failed: %v", err)
+	}
+	if got := nq.GetColormap()[index*3 : index*3+3]; !bytes.Equal(got, []byte{255, 0, 255}) {
+		t.Errorf("expected entry %d to be magenta, got %v", index, got)
+	}
+	for _, c := range [][3]byte{{255, 0, 255}, {250, 10, 245}, {240, 5, 250}} {
+		if got := nq.LookupRGB(c[0], c[1], c[2]); got != index {
+			t.Errorf("LookupRGB%v = %d, expected the overridden entry %d", c, got, index)
+		}
+	}
+
+	if err := nq.OverrideColor(256, 0, 0, 0); err == nil {
+		t.Error("expected an error for an index out of range")
+	}
+}
+
+func TestOctreeExactPalette(t *testing.T) {
+	img := createStripeImage(48, 10, twelveColors)
+
+	oq := NewOctreeQuantizer(rgbPixels(img), 256)
+	oq.BuildColormap()
+	colormap := oq.GetColormap()
+
+	if len(colormap) != len(twelveColors)*3 {
+		t.Fatalf("Expected %d palette entries, got %d", len(twelveColors), len(colormap)/3)
+	}
+	for _, c := range twelveColors {
+		i := oq.LookupRGB(c.R, c.G, c.B)
+		if colormap[i*3] != c.R || colormap[i*3+1] != c.G || colormap[i*3+2] != c.B {
+			t.Errorf("Color %v mapped to %v", c, colormap[i*3:i*3+3])
+		}
+	}
+
+	// the palette only depends on the pixels
+	again := NewOctreeQuantizer(rgbPixels(img), 256)
+	again.BuildColormap()
+	if !bytes.Equal(colormap, again.GetColormap()) {
+		t.Error("Expected the same palette for the same pixels")
+	}
+}
+
+func TestOctreeReducesColors(t *testing.T) {
+	// 16384 distinct colors, more than the tree keeps while it is built
+	img := createGradientImage(128, 128)
+
+	for _, maxColors := range []int{1, 4, 16, 256} {
+		oq := NewOctreeQuantizer(rgbPixels(img), maxColors)
+		oq.BuildColormap()
+		colormap := oq.GetColormap()
+		n := len(colormap) / 3
+		if n < 1 || n > maxColors {
+			t.Errorf("maxColors %d: expected 1..%d palette entries, got %d", maxColors, maxColors, n)
+		}
+
+		// every pixel maps to a valid entry reasonably close to its color
+		pixels := rgbPixels(img)
+		for i := 0; i+2 < len(pixels); i += 3 {
+			idx := oq.LookupRGB(pixels[i], pixels[i+1], pixels[i+2])
+			if idx < 0 || idx >= n {
+				t.Fatalf("maxColors %d: index %d out of range", maxColors, idx)
+			}
+			if maxColors >= 16 {
+				for c := 0; c < 3; c++ {
+					if d := absDiff(uint32(colormap[idx*3+c]), uint32(pixels[i+c])); d > 64 {
+						t.Fatalf("maxColors %d: pixel %v mapped to %v", maxColors, pixels[i:i+3], colormap[idx*3:idx*3+3])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOctreeQuantizerMethod(t *testing.T) {
+	img := createStripeImage(48, 10, twelveColors)
+
+	data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Quantizer: QuantizerOctree})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 48; x++ {
+			if got := color.RGBAModel.Convert(decoded.At(x, y)); got != img.At(x, y) {
+				t.Fatalf("Pixel (%d,%d): expected %v, got %v", x, y, img.At(x, y), got)
+			}
+		}
+	}
+}
+
+// fixedQuantizer is a trivial quantizer with a black/white palette
+type fixedQuantizer struct {
+	builds int
+}
+
+func (q *fixedQuantizer) BuildColormap() { q.builds++ }
+
+func (q *fixedQuantizer) GetColormap() []byte { return []byte{0, 0, 0, 255, 255, 255} }
+
+func (q *fixedQuantizer) LookupRGB(r, g, b byte) int {
+	if int(r)+int(g)+int(b) >= 3*128 {
+		return 1
+	}
+	return 0
+}
+
+func TestCustomQuantizer(t *testing.T) {
+	img := createStripeImage(40, 10, twelveColors)
+
+	q := &fixedQuantizer{}
+	encoder := NewGIFEncoder(40, 10)
+	encoder.SetQuantizer(q)
+	for i := 0; i < 2; i++ {
+		if err := encoder.AddFrame(img); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	if q.builds != 1 {
+		t.Errorf("Expected colormap to be built once, got %d", q.builds)
+	}
+
+	decoded, err := gif.Decode(bytes.NewReader(encoder.GetData()))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBAModel.Convert(decoded.At(x, y)).(color.RGBA)
+			if c != (color.RGBA{0, 0, 0, 255}) && c != (color.RGBA{255, 255, 255, 255}) {
+				t.Fatalf("Unexpected color %v at (%d,%d)", c, x, y)
+			}
+		}
+	}
+}
+
+func TestQuantizerFactory(t *testing.T) {
+	img := createStripeImage(40, 10, twelveColors)
+
+	calls := 0
+	encoder := NewGIFEncoder(40, 10)
+	encoder.SetQuantizerFactory(func(pixels []byte, sample int) Quantizer {
+		calls++
+		if len(pixels) != 40*10*3 {
+			t.Errorf("Expected %d pixel bytes, got %d", 40*10*3, len(pixels))
+		}
+		return &fixedQuantizer{}
+	})
+	for i := 0; i < 3; i++ {
+		if err := encoder.AddFrame(img); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+
+	if calls != 3 {
+		t.Errorf("Expected factory to be called once per frame, got %d", calls)
+	}
+}
+
+func TestAutoQuality(t *testing.T) {
+	sampleFor := func(w, h int, opts EncodeOptions) int {
+		sample := 0
+		encoder := NewGIFEncoderWithOptions(w, h, opts)
+		encoder.SetQuantizerFactory(func(pixels []byte, s int) Quantizer {
+			sample = s
+			return &fixedQuantizer{}
+		})
+		if err := encoder.AddFrame(createGradientImage(w, h)); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+		encoder.Finish()
+		return sample
+	}
+
+	tiny := sampleFor(32, 32, EncodeOptions{AutoQuality: true})
+	large := sampleFor(1024, 768, EncodeOptions{AutoQuality: true})
+	if tiny != 1 {
+		t.Errorf("Expected sample factor 1 for a tiny frame, got %d", tiny)
+	}
+	if large <= tiny {
+		t.Errorf("Expected a coarser sample factor for a large frame, got %d (tiny %d)", large, tiny)
+	}
+
+	if s := sampleFor(32, 32, EncodeOptions{AutoQuality: true, Quality: 20}); s != 20 {
+		t.Errorf("Expected an explicit Quality to win, got %d", s)
+	}
+}
+
+func TestGetPalette(t *testing.T) {
+	img := createStripeImage(48, 10, twelveColors)
+
+	nq := NewNeuQuant(rgbPixels(img), 10)
+	nq.BuildColormap()
+	colormap := nq.GetColormap()
+	palette := nq.GetPalette()
+	if len(palette) != len(colormap)/3 {
+		t.Fatalf("Expected %d entries, got %d", len(colormap)/3, len(palette))
+	}
+	for i, c := range palette {
+		want := color.RGBA{colormap[i*3], colormap[i*3+1], colormap[i*3+2], 255}
+		if c != want {
+			t.Errorf("Entry %d: expected %v, got %v", i, want, c)
+		}
+	}
+
+	encoder := NewGIFEncoder(48, 10)
+	if encoder.GetPalette() != nil {
+		t.Error("Expected nil palette before the first frame")
+	}
+	encoder.SetQuantizerMethod(QuantizerMedianCut)
+	encoder.SetTransparent(&color.RGBA{255, 255, 255, 255})
+	if err := encoder.AddFrame(img); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	encoder.Finish()
+
+	palette = encoder.GetPalette()
+	if len(palette) != len(twelveColors) {
+		t.Fatalf("Expected %d entries, got %d", len(twelveColors), len(palette))
+	}
+	transparent := 0
+	for _, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent++
+		}
+	}
+	if transparent != 1 {
+		t.Errorf("Expected exactly one transparent entry, got %d", transparent)
+	}
+}
+
+func TestGlobalPaletteFromColors(t *testing.T) {
+	palette := make(color.Palette, 16)
+	colors := make([]color.RGBA, 16)
+	for i := range palette {
+		colors[i] = color.RGBA{uint8(i * 16), uint8(255 - i*16), uint8(i * 7), 255}
+		palette[i] = colors[i]
+	}
+	img := createStripeImage(64, 8, colors)
+
+	data, err := EncodeGIFWithOptions([]image.Image{img, img}, EncodeOptions{GlobalPaletteColors: palette})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if n := parseGIFStructure(t, data).colorTableCount(); n != 1 {
+		t.Errorf("Expected a single global color table, got %d", n)
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	for i, c := range palette {
+		if color.RGBAModel.Convert(g.Image[0].Palette[i]) != c {
+			t.Errorf("Palette entry %d: expected %v, got %v", i, c, g.Image[0].Palette[i])
+		}
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 64; x++ {
+			if color.RGBAModel.Convert(g.Image[1].At(x, y)) != img.At(x, y) {
+				t.Fatalf("Pixel (%d,%d) changed after round trip", x, y)
+			}
+		}
+	}
+
+	encoder := NewGIFEncoder(1, 1)
+	if err := encoder.SetGlobalPaletteFromColors(make(color.Palette, 257)); err == nil {
+		t.Error("Expected palette with 257 colors to be rejected")
+	}
+	if _, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{GlobalPaletteColors: make(color.Palette, 300)}); err == nil {
+		t.Error("Expected EncodeGIFWithOptions to reject palette with 300 colors")
+	}
+}
+
+func TestWebSafePalette(t *testing.T) {
+	palette := WebSafePalette()
+	if len(palette) != 216*3 {
+		t.Fatalf("Expected 216 entries, got %d", len(palette)/3)
+	}
+	unique := make(map[uint32]bool)
+	for i := 0; i < len(palette); i += 3 {
+		unique[packRGB(palette[i], palette[i+1], palette[i+2])] = true
+	}
+	if len(unique) != 216 {
+		t.Errorf("Expected 216 unique entries, got %d", len(unique))
+	}
+
+	expected := []struct {
+		c     color.RGBA
+		index int
+	}{
+		{color.RGBA{255, 0, 0, 255}, 180},
+		{color.RGBA{0, 255, 0, 255}, 30},
+		{color.RGBA{0, 0, 255, 255}, 5},
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	for i, e := range expected {
+		img.Set(i, 0, e.c)
+	}
+	data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Quantizer: QuantizerWebSafe})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	p := decoded.(*image.Paletted)
+	for i, e := range expected {
+		if got := int(p.ColorIndexAt(i, 0)); got != e.index {
+			t.Errorf("%v: expected index %d, got %d", e.c, e.index, got)
+		}
+		if color.RGBAModel.Convert(p.At(i, 0)) != e.c {
+			t.Errorf("%v: decoded as %v", e.c, p.At(i, 0))
+		}
+	}
+
+	// nearest-color mapping of off-grid colors
+	q := webSafeQuantizer{}
+	if got := q.LookupRGB(30, 200, 130); got != 1*36+4*6+3 {
+		t.Errorf("Expected index %d for (30,200,130), got %d", 1*36+4*6+3, got)
+	}
+}
+
+func TestMonochrome(t *testing.T) {
+	img := createGradientImage(64, 16)
+	for _, dither := range []bool{false, true} {
+		data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{
+			Monochrome: &MonoOptions{Dither: dither},
+		})
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+
+		s := parseGIFStructure(t, data)
+		if s.GCTSize != 2 {
+			t.Errorf("dither=%v: expected a 2 entry global color table, got %d", dither, s.GCTSize)
+		}
+		if s.Frames[0].MinCodeSize != 2 {
+			t.Errorf("dither=%v: expected LZW min code size 2, got %d", dither, s.Frames[0].MinCodeSize)
+		}
+
+		decoded, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode GIF: %v", err)
+		}
+		bounds := decoded.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.RGBAModel.Convert(decoded.At(x, y)).(color.RGBA)
+				if c != (color.RGBA{0, 0, 0, 255}) && c != (color.RGBA{255, 255, 255, 255}) {
+					t.Fatalf("dither=%v: pixel (%d,%d) is %v, expected black or white", dither, x, y, c)
+				}
+			}
+		}
+	}
+
+	q := monoQuantizer{threshold: 200}
+	if q.LookupRGB(180, 180, 180) != 0 || q.LookupRGB(220, 220, 220) != 1 {
+		t.Error("Expected threshold 200 to split 180 and 220 gray")
+	}
+}
+
+func TestSharedPalette(t *testing.T) {
+	frames := []image.Image{createGradientImage(64, 32), createGradientImage(32, 64)}
+	delays := []int{100, 300}
+
+	data, err := EncodeGIFWithOptions(frames, EncodeOptions{Delays: delays})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if s := parseGIFStructure(t, data); s.Frames[1].LCTSize == 0 {
+		t.Fatal("Expected a local color table per frame without SharedPalette")
+	}
+
+	data, err = EncodeGIFWithOptions(frames, EncodeOptions{Delays: delays, SharedPalette: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	s := parseGIFStructure(t, data)
+	if len(s.Frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(s.Frames))
+	}
+	if n := s.colorTableCount(); n != 1 {
+		t.Errorf("Expected a single shared color table, got %d", n)
+	}
+	for i, f := range s.Frames {
+		if f.Delay != delays[i]/10 {
+			t.Errorf("Frame %d: expected delay %d, got %d", i, delays[i]/10, f.Delay)
+		}
+	}
+}
+
+func TestSharedPaletteFinishContext(t *testing.T) {
+	encoder := NewGIFEncoder(64, 64)
+	encoder.SetSharedPalette(8)
+	for i := 0; i < 2; i++ {
+		if err := encoder.AddFrame(createGradientImage(64, 64)); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+
+	// the held frames are quantized in FinishContext, which must report
+	// that it was cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := encoder.FinishContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	encoder = NewGIFEncoder(64, 64)
+	encoder.SetSharedPalette(8)
+	if err := encoder.AddFrame(createGradientImage(64, 64)); err != nil {
+		t.Fatalf("AddFrame failed: %v", err)
+	}
+	if err := encoder.FinishContext(context.Background()); err != nil {
+		t.Errorf("FinishContext failed: %v", err)
+	}
+	if _, err := gif.DecodeAll(bytes.NewReader(encoder.GetData())); err != nil {
+		t.Errorf("Failed to decode GIF: %v", err)
+	}
+}
+
+func TestPopularityExactPalette(t *testing.T) {
+	// fewer colors than cells, each in a cell of its own
+	img := createStripeImage(48, 10, twelveColors)
+
+	pq := NewPopularityQuantizer(rgbPixels(img), 256)
+	pq.BuildColormap()
+	colormap := pq.GetColormap()
+	if len(colormap) != len(twelveColors)*3 {
+		t.Fatalf("Expected %d palette entries, got %d", len(twelveColors), len(colormap)/3)
+	}
+	for _, c := range twelveColors {
+		i := pq.LookupRGB(c.R, c.G, c.B)
+		if colormap[i*3] != c.R || colormap[i*3+1] != c.G || colormap[i*3+2] != c.B {
+			t.Errorf("Color %v mapped to %v", c, colormap[i*3:i*3+3])
+		}
+	}
+}
+
+func TestPopularityMostFrequent(t *testing.T) {
+	// a gradient spanning far more than 256 cells, a quarter covered by one color
+	img := createGradientImage(128, 128)
+	dominant := color.RGBA{17, 99, 201, 255}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, dominant)
+		}
+	}
+
+	pq := NewPopularityQuantizer(rgbPixels(img), 256)
+	pq.BuildColormap()
+	colormap := pq.GetColormap()
+	if n := len(colormap) / 3; n != 256 {
+		t.Errorf("Expected 256 palette entries, got %d", n)
+	}
+	if colormap[0] != dominant.R || colormap[1] != dominant.G || colormap[2] != dominant.B {
+		t.Errorf("Expected the most frequent color first, got %v", colormap[:3])
+	}
+
+	data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{Quantizer: QuantizerPopularity})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	out, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+	if c := color.RGBAModel.Convert(out.At(10, 10)); c != dominant {
+		t.Errorf("Expected the dominant color to survive, got %v", c)
+	}
+}
+
+func TestForceColors(t *testing.T) {
+	magenta := color.RGBA{255, 0, 255, 255}
+	img := createGradientImage(64, 64)
+	// 少量品红像素, 量化器通常不会单独为它们保留条目
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			img.Set(x, y, magenta)
+		}
+	}
+
+	hasMagenta := func(data []byte) bool {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		for _, c := range g.Image[0].Palette {
+			if color.RGBAModel.Convert(c) == magenta {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, method := range []QuantizerMethod{QuantizerNeuQuant, QuantizerPopularity} {
+		for _, maxColors := range []int{0, 16} {
+			opts := EncodeOptions{Quantizer: method, MaxColors: maxColors}
+			data, err := EncodeGIFWithOptions([]image.Image{img}, opts)
+			if err != nil {
+				t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+			}
+			if maxColors == 16 && hasMagenta(data) {
+				t.Errorf("%s/%d: magenta is in the palette without forcing it", method, maxColors)
+			}
+
+			opts.ForceColors = []color.RGBA{magenta}
+			data, err = EncodeGIFWithOptions([]image.Image{img}, opts)
+			if err != nil {
+				t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+			}
+			decoded, err := gif.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 2; x++ {
+					if c := color.RGBAModel.Convert(decoded.At(x, y)); c != magenta {
+						t.Errorf("%s/%d: pixel (%d,%d) is %v, expected exact magenta", method, maxColors, x, y, c)
+					}
+				}
+			}
+		}
+	}
+
+	// paletted frames get the forced colors too: with a full palette the
+	// near magenta entry is replaced by the exact color
+	stripes := []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}, {0, 255, 0, 255}, {250, 5, 250, 255}}
+	paletted := palettedCopy(createStripeImage(32, 8, stripes))
+	opts := EncodeOptions{Quantizer: QuantizerMedianCut, MaxColors: 4, ForceColors: []color.RGBA{magenta}}
+	data, err := EncodeGIFWithOptions([]image.Image{paletted}, opts)
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	decoded, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if c := color.RGBAModel.Convert(decoded.At(28, 4)); c != magenta {
+		t.Errorf("paletted: pixel (28,4) is %v, expected exact magenta", c)
+	}
+
+	if err := (EncodeOptions{MaxColors: 2, ForceColors: twelveColors}).Validate(); err == nil {
+		t.Error("expected an error for more forced colors than MaxColors")
+	}
+}
+
+func TestForcePaletteColors(t *testing.T) {
+	colormap := []byte{0, 0, 0, 250, 0, 250, 255, 255, 255}
+
+	// 已存在的颜色保持不变, 有空位时追加
+	got := forcePaletteColors(colormap, []color.RGBA{{0, 0, 0, 255}, {255, 0, 0, 255}}, 4)
+	if want := []byte{0, 0, 0, 250, 0, 250, 255, 255, 255, 255, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// 没有空位时替换最接近的条目, 不替换已强制的颜色
+	got = forcePaletteColors(colormap, []color.RGBA{{255, 0, 255, 255}, {240, 0, 240, 255}}, 3)
+	if want := []byte{0, 0, 0, 255, 0, 255, 240, 0, 240}; !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if !bytes.Equal(colormap, []byte{0, 0, 0, 250, 0, 250, 255, 255, 255}) {
+		t.Error("forcePaletteColors modified its input")
+	}
+}
+
+func TestAdaptivePaletteSize(t *testing.T) {
+	photo := noiseImage(32, 32, 3)
+	three := createStripeImage(32, 32, twelveColors[:3])
+	five := createStripeImage(32, 32, twelveColors[7:12])
+
+	data, err := EncodeGIFWithOptions([]image.Image{photo, three, five}, EncodeOptions{
+		AdaptivePaletteSize: true, Dither: DitherFloydSteinberg,
+	})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	s := parseGIFStructure(t, data)
+	if s.GCTSize != 256 {
+		t.Errorf("photographic frame: expected 256 colors, got %d", s.GCTSize)
+	}
+	for i, want := range []int{0, 4, 8} {
+		if i > 0 && s.Frames[i].LCTSize != want {
+			t.Errorf("frame %d: expected a table of %d colors, got %d", i, want, s.Frames[i].LCTSize)
+		}
+	}
+	if s.Frames[1].MinCodeSize != 2 || s.Frames[2].MinCodeSize != 3 {
+		t.Errorf("expected LZW code sizes 2 and 3, got %d and %d", s.Frames[1].MinCodeSize, s.Frames[2].MinCodeSize)
+	}
+
+	// 颜色少的帧使用精确颜色
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	for i, img := range []*image.RGBA{three, five} {
+		for x := 0; x < 32; x++ {
+			if got := color.RGBAModel.Convert(g.Image[i+1].At(x, 0)); got != img.At(x, 0) {
+				t.Fatalf("frame %d: pixel %d is %v, expected %v", i+1, x, got, img.At(x, 0))
+			}
+		}
+	}
+
+	if err := (EncodeOptions{AdaptivePaletteSize: true, AutoGlobalPalette: true}).Validate(); err == nil {
+		t.Error("expected an error with a global palette")
+	}
+}
@@ -0,0 +1,148 @@
+package gifencoder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ResizeMode selects how frames whose size differs from the encoder's are
+// scaled
+type ResizeMode int
+
+const (
+	ResizeNone     ResizeMode = iota // crop or pad frames to the encoder size
+	ResizeNearest                    // nearest neighbor, keeps hard pixel edges
+	ResizeBilinear                   // bilinear interpolation, smoother results
+)
+
+// SetResizeMode scales frames of a different size to the encoder's width
+// and height before quantization. With letterbox the aspect ratio is kept
+// and the uncovered bars are filled with black, otherwise frames are
+// stretched.
+func (ge *GIFEncoder) SetResizeMode(mode ResizeMode, letterbox bool) {
+	ge.resizeMode = mode
+	ge.letterbox = letterbox
+}
+
+// needsResize reports whether img is scaled before encoding
+func (ge *GIFEncoder) needsResize(img image.Image) bool {
+	size := img.Bounds().Size()
+	return ge.resizeMode != ResizeNone && size != image.Pt(ge.width, ge.height) &&
+		size.X > 0 && size.Y > 0
+}
+
+// resizeFrame returns img scaled to the encoder size, or img itself if no
+// scaling is needed
+func (ge *GIFEncoder) resizeFrame(img image.Image) image.Image {
+	if !ge.needsResize(img) {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, ge.width, ge.height))
+	target := dst.Bounds()
+	if ge.letterbox {
+		draw.Draw(dst, target, image.NewUniform(color.RGBA{fillColor, fillColor, fillColor, 255}), image.Point{}, draw.Src)
+		target = fitRect(img.Bounds().Size(), ge.width, ge.height)
+	}
+
+	if ge.resizeMode == ResizeBilinear {
+		scaleBilinear(dst, target, img)
+	} else {
+		scaleNearest(dst, target, img)
+	}
+	return dst
+}
+
+// fitRect returns the largest rectangle with the aspect ratio of size that
+// fits in width x height, centered
+func fitRect(size image.Point, width, height int) image.Rectangle {
+	w, h := width, size.Y*width/size.X
+	if h > height {
+		w, h = size.X*height/size.Y, height
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	x := (width - w) / 2
+	y := (height - h) / 2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// scaleNearest scales src into the target rectangle of dst picking the
+// nearest source pixel
+func scaleNearest(dst *image.RGBA, target image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	dw, dh := target.Dx(), target.Dy()
+	for y := 0; y < dh; y++ {
+		sy := sb.Min.Y + (2*y+1)*sb.Dy()/(2*dh)
+		for x := 0; x < dw; x++ {
+			sx := sb.Min.X + (2*x+1)*sb.Dx()/(2*dw)
+			dst.Set(target.Min.X+x, target.Min.Y+y, src.At(sx, sy))
+		}
+	}
+}
+
+// scaleBilinear scales src into the target rectangle of dst interpolating
+// between the four source pixels around each sample point
+func scaleBilinear(dst *image.RGBA, target image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	dw, dh := target.Dx(), target.Dy()
+	scaleX := float64(sb.Dx()) / float64(dw)
+	scaleY := float64(sb.Dy()) / float64(dh)
+
+	for y := 0; y < dh; y++ {
+		// sample at pixel centers
+		fy := (float64(y)+0.5)*scaleY - 0.5
+		y0, wy := splitCoord(fy, sb.Dy())
+		y1 := minInt(y0+1, sb.Dy()-1)
+		for x := 0; x < dw; x++ {
+			fx := (float64(x)+0.5)*scaleX - 0.5
+			x0, wx := splitCoord(fx, sb.Dx())
+			x1 := minInt(x0+1, sb.Dx()-1)
+
+			var c [4]float64
+			for _, s := range [4]struct {
+				x, y int
+				w    float64
+			}{
+				{x0, y0, (1 - wx) * (1 - wy)},
+				{x1, y0, wx * (1 - wy)},
+				{x0, y1, (1 - wx) * wy},
+				{x1, y1, wx * wy},
+			} {
+				r, g, b, a := src.At(sb.Min.X+s.x, sb.Min.Y+s.y).RGBA()
+				c[0] += float64(r) * s.w
+				c[1] += float64(g) * s.w
+				c[2] += float64(b) * s.w
+				c[3] += float64(a) * s.w
+			}
+			dst.SetRGBA64(target.Min.X+x, target.Min.Y+y, color.RGBA64{
+				uint16(c[0] + 0.5), uint16(c[1] + 0.5), uint16(c[2] + 0.5), uint16(c[3] + 0.5),
+			})
+		}
+	}
+}
+
+// splitCoord splits a source coordinate into the pixel before it, clamped
+// to [0, n), and the weight of the pixel after it
+func splitCoord(f float64, n int) (int, float64) {
+	if f <= 0 {
+		return 0, 0
+	}
+	i := int(f)
+	if i >= n-1 {
+		return n - 1, 0
+	}
+	return i, f - float64(i)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,29 @@
+package gifencoder
+
+// FrameStats describes how well a written frame compressed
+type FrameStats struct {
+	Index             int // 0-based index of the frame
+	UncompressedBytes int // pixels in the frame rectangle, one index byte each
+	CompressedBytes   int // LZW image data, with the code size byte and sub-block headers
+	ClearCodeCount    int // clear codes in the LZW stream, including the first one
+	UniqueColors      int // palette entries the frame refers to
+}
+
+// Ratio returns UncompressedBytes / CompressedBytes
+func (s FrameStats) Ratio() float64 {
+	if s.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(s.UncompressedBytes) / float64(s.CompressedBytes)
+}
+
+// FrameStatsFunc receives the statistics of each written frame
+type FrameStatsFunc func(stats FrameStats)
+
+// SetFrameStatsCallback sets a function called once after every frame is
+// written with its compression statistics, in frame order. Comparing the
+// compressed sizes is a quick way to weigh dithering and quantizer
+// settings. nil disables it.
+func (ge *GIFEncoder) SetFrameStatsCallback(fn FrameStatsFunc) {
+	ge.frameStats = fn
+}
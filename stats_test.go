@@ -0,0 +1,55 @@
+package gifencoder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFrameStats(t *testing.T) {
+	solid := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for i := 0; i < len(solid.Pix); i += 4 {
+		copy(solid.Pix[i:], []byte{30, 120, 200, 255})
+	}
+	stripes := createStripeImage(100, 100, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})
+
+	for _, workers := range []int{1, 4} {
+		var stats []FrameStats
+		_, err := EncodeGIFWithOptions([]image.Image{solid, stripes, solid}, EncodeOptions{
+			Parallelism:  workers,
+			OnFrameStats: func(s FrameStats) { stats = append(stats, s) },
+		})
+		if err != nil {
+			t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+		}
+		if len(stats) != 3 {
+			t.Fatalf("workers %d: expected 3 stats, got %d", workers, len(stats))
+		}
+
+		for i, s := range stats {
+			if s.Index != i {
+				t.Errorf("workers %d: stats %d has index %d", workers, i, s.Index)
+			}
+			if s.UncompressedBytes != 100*100 {
+				t.Errorf("workers %d: frame %d: expected 10000 uncompressed bytes, got %d", workers, i, s.UncompressedBytes)
+			}
+			if s.ClearCodeCount < 1 {
+				t.Errorf("workers %d: frame %d: expected a clear code, got %d", workers, i, s.ClearCodeCount)
+			}
+		}
+
+		s := stats[0]
+		if s.UniqueColors != 1 {
+			t.Errorf("workers %d: expected 1 color in the solid frame, got %d", workers, s.UniqueColors)
+		}
+		// a run of one color grows the code table by one entry per code
+		if s.Ratio() < 20 {
+			t.Errorf("workers %d: expected the solid frame to compress at least 20:1, got %d -> %d bytes",
+				workers, s.UncompressedBytes, s.CompressedBytes)
+		}
+		if stats[2] != (FrameStats{Index: 2, UncompressedBytes: s.UncompressedBytes,
+			CompressedBytes: s.CompressedBytes, ClearCodeCount: s.ClearCodeCount, UniqueColors: 1}) {
+			t.Errorf("workers %d: expected identical frames to give the same stats, got %+v and %+v", workers, s, stats[2])
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+)
+
+// ToStdGIF quantizes frames with this package, honoring every option in
+// opts, and returns the result as an image/gif.GIF ready for gif.EncodeAll.
+// Frames are *image.Paletted with the bounds actually encoded (smaller than
+// the canvas when OptimizeFrames crops them), and Delay, Disposal and
+// LoopCount mirror the stream this package would write.
+func ToStdGIF(frames []image.Image, opts EncodeOptions) (*gif.GIF, error) {
+	data, err := EncodeGIFWithOptions(frames, opts)
+	if err != nil {
+		return nil, err
+	}
+	// the stream is decoded rather than built from the encoder's state, so
+	// it always matches what EncodeGIFWithOptions writes
+	return gif.DecodeAll(bytes.NewReader(data))
+}
@@ -0,0 +1,158 @@
+package gifencoder
+
+import (
+	"testing"
+)
+
+// gifFrameInfo describes one image in a GIF stream
+type gifFrameInfo struct {
+	HasGCE      bool
+	Delay       int
+	Disposal    int
+	Transparent bool
+	TransIndex  int
+	Left        int
+	Top         int
+	Width       int
+	Height      int
+	LCTSize     int // 0 when no local color table
+	LCTSorted   bool
+	MinCodeSize int
+}
+
+// gifStructure is the block layout of a GIF stream, used to assert on
+// fields that image/gif does not expose
+type gifStructure struct {
+	Version        string
+	ScreenWidth    int
+	ScreenHeight   int
+	LSDFlags       byte
+	BackgroundIdx  int
+	AspectRatio    int
+	GCTSize        int // 0 when no global color table
+	LoopCount      int // -1 when no Netscape extension
+	AppExtensions  []string
+	ExtensionCount int
+	Frames         []gifFrameInfo
+}
+
+// parseGIFStructure walks the blocks of a GIF stream
+func parseGIFStructure(t *testing.T, data []byte) gifStructure {
+	t.Helper()
+
+	pos := 0
+	need := func(n int) {
+		if pos+n > len(data) {
+			t.Fatalf("GIF truncated at offset %d (need %d bytes)", pos, n)
+		}
+	}
+	u16 := func(at int) int {
+		return int(data[at]) | int(data[at+1])<<8
+	}
+	skipSubBlocks := func() {
+		for {
+			need(1)
+			n := int(data[pos])
+			pos++
+			if n == 0 {
+				return
+			}
+			need(n)
+			pos += n
+		}
+	}
+
+	s := gifStructure{LoopCount: -1}
+	need(13)
+	s.Version = string(data[0:6])
+	s.ScreenWidth = u16(6)
+	s.ScreenHeight = u16(8)
+	s.LSDFlags = data[10]
+	s.BackgroundIdx = int(data[11])
+	s.AspectRatio = int(data[12])
+	pos = 13
+	if s.LSDFlags&0x80 != 0 {
+		s.GCTSize = 1 << ((s.LSDFlags & 7) + 1)
+		need(s.GCTSize * 3)
+		pos += s.GCTSize * 3
+	}
+
+	var gce *gifFrameInfo
+	for {
+		need(1)
+		switch data[pos] {
+		case 0x21:
+			need(2)
+			label := data[pos+1]
+			pos += 2
+			s.ExtensionCount++
+			switch label {
+			case 0xf9:
+				need(6)
+				flags := data[pos+1]
+				gce = &gifFrameInfo{
+					HasGCE:      true,
+					Disposal:    int(flags>>2) & 7,
+					Transparent: flags&1 != 0,
+					Delay:       u16(pos + 2),
+					TransIndex:  int(data[pos+4]),
+				}
+				pos += 5
+				skipSubBlocks()
+			case 0xff:
+				need(12)
+				app := string(data[pos+1 : pos+12])
+				s.AppExtensions = append(s.AppExtensions, app)
+				pos += 12
+				if app == "NETSCAPE2.0" {
+					need(5)
+					s.LoopCount = u16(pos + 2)
+				}
+				skipSubBlocks()
+			default:
+				skipSubBlocks()
+			}
+		case 0x2c:
+			need(11)
+			f := gifFrameInfo{}
+			if gce != nil {
+				f = *gce
+			}
+			gce = nil
+			f.Left = u16(pos + 1)
+			f.Top = u16(pos + 3)
+			f.Width = u16(pos + 5)
+			f.Height = u16(pos + 7)
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				f.LCTSize = 1 << ((flags & 7) + 1)
+				f.LCTSorted = flags&0x20 != 0
+				need(f.LCTSize * 3)
+				pos += f.LCTSize * 3
+			}
+			f.MinCodeSize = int(data[pos])
+			pos++
+			skipSubBlocks()
+			s.Frames = append(s.Frames, f)
+		case 0x3b:
+			return s
+		default:
+			t.Fatalf("Unexpected block 0x%02x at offset %d", data[pos], pos)
+		}
+	}
+}
+
+// colorTableCount returns the number of color tables in the stream
+func (s gifStructure) colorTableCount() int {
+	n := 0
+	if s.GCTSize > 0 {
+		n++
+	}
+	for _, f := range s.Frames {
+		if f.LCTSize > 0 {
+			n++
+		}
+	}
+	return n
+}
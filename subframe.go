@@ -0,0 +1,49 @@
+package gifencoder
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// AddFrameAt adds img as a frame placed at (x, y) on the logical screen.
+// Only the image's own area is encoded, the rest of the screen keeps what
+// the previous frames and their disposal methods left there. The image
+// must fit inside the encoder's width and height. Inter-frame optimization
+// is skipped for such frames.
+func (ge *GIFEncoder) AddFrameAt(img image.Image, x, y int) error {
+	return ge.addFrameAt(context.Background(), img, image.Pt(x, y))
+}
+
+func (ge *GIFEncoder) addFrameAt(ctx context.Context, img image.Image, at image.Point) error {
+	if err := ge.writeHeldFirst(ctx); err != nil {
+		return err
+	}
+	size := img.Bounds().Size()
+	if at.X < 0 || at.Y < 0 || at.X+size.X > ge.width || at.Y+size.Y > ge.height {
+		return fmt.Errorf("frame %dx%d at (%d,%d) does not fit the %dx%d screen",
+			size.X, size.Y, at.X, at.Y, ge.width, ge.height)
+	}
+	if at == (image.Point{}) && size == image.Pt(ge.width, ge.height) {
+		return ge.AddFrameContext(ctx, img)
+	}
+	ge.applyDelays()
+	if held, err := ge.holdOrFlush(ctx, img, &at); held {
+		return err
+	}
+
+	// encode the frame as if the screen had its size, then place it
+	width, height, optimize := ge.width, ge.height, ge.optimize
+	defer func() {
+		ge.width, ge.height, ge.optimize = width, height, optimize
+		ge.screen = image.Point{}
+		ge.frameOffset = image.Point{}
+	}()
+	ge.screen = image.Pt(width, height)
+	ge.width, ge.height = size.X, size.Y
+	ge.frameOffset = at
+	ge.optimize = false
+	ge.prevPixels = nil
+
+	return ge.AddFrameContext(ctx, img)
+}
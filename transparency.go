@@ -0,0 +1,89 @@
+package gifencoder
+
+// SetReserveTransparentSlot keeps one palette entry for the color set with
+// SetTransparent alone. Only pixels of exactly that color are written as
+// transparent, every other pixel maps to one of the remaining 255 entries,
+// so a similar opaque color can no longer turn transparent. Without it the
+// transparent index is the palette entry closest to the color, shared with
+// any pixel that maps to the same entry.
+func (ge *GIFEncoder) SetReserveTransparentSlot(reserve bool) {
+	ge.reserveTrans = reserve
+}
+
+// SetAlphaThreshold makes pixels whose 8-bit alpha is below threshold
+// transparent. They get a palette slot of their own like with
+// SetReserveTransparentSlot, and a color set with SetTransparent is made
+// transparent as well. 0 disables it. A transparent index set with
+// SetTransparentIndex takes precedence.
+func (ge *GIFEncoder) SetAlphaThreshold(threshold int) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	if threshold > 256 {
+		threshold = 256
+	}
+	ge.alphaThreshold = threshold
+}
+
+// usesTransMask reports whether transparent pixels are picked per pixel
+// rather than by palette entry
+func (ge *GIFEncoder) usesTransMask() bool {
+	if ge.fixedTransIndex >= 0 {
+		return false
+	}
+	return ge.alphaThreshold > 0 || (ge.reserveTrans && ge.transparent != nil)
+}
+
+// buildTransMask marks the pixels of the current frame to write as
+// transparent, it must run while ge.pixels is still set. Pixels below the
+// alpha threshold were already marked by getImagePixels.
+func (ge *GIFEncoder) buildTransMask() {
+	if !ge.usesTransMask() {
+		ge.transMask = nil
+		return
+	}
+
+	nPix := len(ge.pixels) / 3
+	if len(ge.transMask) != nPix {
+		ge.transMask = make([]bool, nPix)
+	}
+	c := ge.transparent
+	if c == nil {
+		return
+	}
+	for j, k := 0, 0; j < nPix; j, k = j+1, k+3 {
+		if ge.pixels[k] == c.R && ge.pixels[k+1] == c.G && ge.pixels[k+2] == c.B {
+			ge.transMask[j] = true
+		}
+	}
+}
+
+// applyTransMask writes the masked pixels as a palette slot that no other
+// pixel uses
+func (ge *GIFEncoder) applyTransMask() {
+	if ge.transMask == nil {
+		return
+	}
+
+	counts := make([]int, 256)
+	for j, masked := range ge.transMask {
+		if !masked {
+			counts[ge.indexedPixels[j]]++
+		}
+	}
+
+	ge.transIndex = ge.reserveTransparentIndex(counts, ge.transMask)
+	for j, masked := range ge.transMask {
+		if masked {
+			ge.indexedPixels[j] = byte(ge.transIndex)
+		}
+	}
+
+	// 透明像素原先匹配的颜色可能不再被使用
+	ge.resetUsedEntries()
+	for _, index := range ge.indexedPixels {
+		ge.usedEntry[index] = true
+	}
+	ge.usedEntry[ge.transIndex] = true
+	ge.transMask = nil
+}
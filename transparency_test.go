@@ -0,0 +1,141 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// keyedImage draws a gradient with a block of the key color and a block of
+// a nearly identical opaque color
+func keyedImage(key, near color.RGBA) *image.RGBA {
+	img := createGradientImage(64, 64)
+	for y := 8; y < 24; y++ {
+		for x := 8; x < 24; x++ {
+			img.Set(x, y, key)
+			img.Set(x+24, y+24, near)
+		}
+	}
+	return img
+}
+
+func TestReserveTransparentSlot(t *testing.T) {
+	key := color.RGBA{255, 0, 255, 255}
+	near := color.RGBA{250, 2, 250, 255}
+	img := keyedImage(key, near)
+
+	for _, method := range []QuantizerMethod{QuantizerNeuQuant, QuantizerMedianCut} {
+		for _, dither := range []bool{false, true} {
+			encoder := NewGIFEncoder(64, 64)
+			encoder.SetQuantizerMethod(method)
+			encoder.SetDither(dither)
+			encoder.SetTransparent(&key)
+			encoder.SetReserveTransparentSlot(true)
+			for i := 0; i < 2; i++ {
+				if err := encoder.AddFrame(img); err != nil {
+					t.Fatalf("AddFrame failed: %v", err)
+				}
+			}
+			encoder.Finish()
+
+			g, err := gif.DecodeAll(bytes.NewReader(encoder.GetData()))
+			if err != nil {
+				t.Fatalf("%s dither=%v: failed to decode GIF: %v", method, dither, err)
+			}
+			for i, frame := range g.Image {
+				for y := 0; y < 64; y++ {
+					for x := 0; x < 64; x++ {
+						_, _, _, a := frame.At(x, y).RGBA()
+						isKey := img.RGBAAt(x, y) == key
+						if isKey && a != 0 {
+							t.Fatalf("%s dither=%v frame %d: key pixel (%d,%d) is opaque", method, dither, i, x, y)
+						}
+						if !isKey && a == 0 {
+							t.Fatalf("%s dither=%v frame %d: pixel (%d,%d) of %v is transparent", method, dither, i, x, y, img.RGBAAt(x, y))
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMatteColor(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 64; i++ {
+		img.SetNRGBA(i%8, i/8, color.NRGBA{255, 0, 0, 128})
+	}
+
+	tests := []struct {
+		name  string
+		matte color.RGBA
+		want  color.RGBA
+	}{
+		{"default black", color.RGBA{}, color.RGBA{128, 0, 0, 255}},
+		{"white", color.RGBA{255, 255, 255, 255}, color.RGBA{255, 127, 127, 255}},
+	}
+	for _, tt := range tests {
+		data, err := EncodeGIFWithOptions([]image.Image{img}, EncodeOptions{
+			Quantizer:  QuantizerMedianCut,
+			MatteColor: tt.matte,
+		})
+		if err != nil {
+			t.Fatalf("%s: Encode failed: %v", tt.name, err)
+		}
+		g, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: failed to decode GIF: %v", tt.name, err)
+		}
+		got := color.RGBAModel.Convert(g.At(3, 3)).(color.RGBA)
+		if absDiff(uint32(got.R), uint32(tt.want.R)) > 1 || absDiff(uint32(got.G), uint32(tt.want.G)) > 1 ||
+			absDiff(uint32(got.B), uint32(tt.want.B)) > 1 {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAlphaThreshold(t *testing.T) {
+	// gradient sprite with a cleared corner and a half transparent edge
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			a := uint8(255)
+			switch {
+			case x < 12 && y < 12:
+				a = 0
+			case x < 16 && y < 16:
+				a = 100
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 8), uint8(y * 8), 128, a})
+		}
+	}
+
+	data, err := EncodeGIFWithOptions([]image.Image{img, img}, EncodeOptions{AlphaThreshold: 128})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %v", err)
+	}
+
+	for i, frame := range g.Image {
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				_, _, _, a := frame.At(x, y).RGBA()
+				if want := x >= 16 || y >= 16; (a != 0) != want {
+					t.Fatalf("Frame %d pixel (%d,%d): expected opaque=%v, got alpha %d", i, x, y, want, a)
+				}
+			}
+		}
+	}
+
+	s := parseGIFStructure(t, data)
+	for i, f := range s.Frames {
+		if !f.Transparent {
+			t.Errorf("Frame %d: expected the transparency flag", i)
+		}
+	}
+}
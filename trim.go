@@ -0,0 +1,44 @@
+package gifencoder
+
+import (
+	"image"
+	"image/color"
+)
+
+// trimBlankFrames drops the images at both ends of the animation that are
+// blank, see isBlankFrame, together with their delays. Blank images
+// between other images are pauses and are kept, as is the first image when
+// all of them are blank.
+func trimBlankFrames(images []image.Image, delays []int, matte color.RGBA) ([]image.Image, []int) {
+	start, end := 0, len(images)
+	for start < end && isBlankFrame(images[start], matte) {
+		start++
+	}
+	if start == end {
+		return images[:1], delays[:1]
+	}
+	for isBlankFrame(images[end-1], matte) {
+		end--
+	}
+	return images[start:end], delays[start:end]
+}
+
+// isBlankFrame reports whether every pixel of img is fully transparent or
+// the opaque matte color, the background transparent pixels are flattened
+// onto
+func isBlankFrame(img image.Image, matte color.RGBA) bool {
+	mr, mg, mb, _ := matte.RGBA()
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a == 0 {
+				continue
+			}
+			if a != 0xffff || r != mr || g != mg || b != mb {
+				return false
+			}
+		}
+	}
+	return true
+}
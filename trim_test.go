@@ -0,0 +1,60 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestTrimBlankFrames(t *testing.T) {
+	red := createStripeImage(16, 16, []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}})
+	green := createStripeImage(16, 16, []color.RGBA{{0, 255, 0, 255}, {0, 0, 255, 255}})
+	transparent := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	black := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 255
+	}
+
+	tests := []struct {
+		name   string
+		frames []image.Image
+		want   []int // delays of the frames kept
+	}{
+		{"blank last frame", []image.Image{red, green, transparent}, []int{10, 20}},
+		{"blank at both ends", []image.Image{black, red, transparent, green, black}, []int{20, 30, 40}},
+		{"all blank", []image.Image{transparent, black}, []int{10}},
+	}
+
+	for _, tt := range tests {
+		delays := []int{100, 200, 300, 400, 500}[:len(tt.frames)]
+		data, err := EncodeGIFWithOptions(tt.frames, EncodeOptions{Delays: delays, TrimBlankFrames: true})
+		if err != nil {
+			t.Fatalf("%s: EncodeGIFWithOptions failed: %v", tt.name, err)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", tt.name, err)
+		}
+		if len(g.Image) != len(tt.want) {
+			t.Errorf("%s: expected %d frames, got %d", tt.name, len(tt.want), len(g.Image))
+			continue
+		}
+		for i, d := range tt.want {
+			if g.Delay[i] != d {
+				t.Errorf("%s: expected delays %v, got %v", tt.name, tt.want, g.Delay)
+				break
+			}
+		}
+	}
+
+	// 不开启时保留空白帧
+	data, err := EncodeGIFWithOptions([]image.Image{red, green, transparent}, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeGIFWithOptions failed: %v", err)
+	}
+	if g, err := gif.DecodeAll(bytes.NewReader(data)); err != nil || len(g.Image) != 3 {
+		t.Errorf("expected 3 frames without TrimBlankFrames, got %v", err)
+	}
+}
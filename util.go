@@ -1,8 +1,11 @@
 package gifencoder
 
 import (
+	"context"
 	"errors"
 	"image"
+	"image/color"
+	"io"
 	"math"
 )
 
@@ -32,22 +35,62 @@ func EncodeGIF(images []image.Image, delays []int) ([]byte, error) {
 	}
 
 	encoder.Finish()
-	return encoder.GetData(), nil
+	data := encoder.GetData()
+	encoder.CleanupAll()
+	return data, nil
 }
 
 // EncodeGIFWithOptions provides more control over encoding options
 type EncodeOptions struct {
-	Width           int         // width of output GIF
-	Height          int         // height of output GIF
-	Repeat          int         // -1 = once, 0 = forever, >0 = count
-	Quality         int         // 1-30, lower is better
-	Dither          interface{} // dithering method: bool, string, or DitherMethod
-	GlobalPalette   []byte      // optional global palette
-	Delays          []int       // delays in milliseconds
-	SaturationBoost float64     // 饱和度增强, [0.0,2.0], 1.0为原始
-	ContrastBoost   float64     // 对比度增强, [0.0,2.0], 1.0为原始
+	Width                int             // width of output GIF
+	Height               int             // height of output GIF
+	Repeat               int             // -1 = once, 0 = forever, >0 = count
+	Quality              int             // 1-30, lower is better
+	AutoQuality          bool            // pick the quality from each frame's size, unless Quality is set
+	Dither               interface{}     // dithering method: bool, string, or DitherMethod
+	GlobalPalette        []byte          // optional global palette
+	Delays               []int           // delays in milliseconds, rounded to whole centiseconds
+	DelaysCentiseconds   []int           // delays in centiseconds as GIF stores them, instead of Delays
+	MinDelayCentiseconds int             // shorter delays are raised to this, 0 = no change
+	SaturationBoost      float64         // 饱和度增强, [0.0,2.0], 1.0为原始
+	ContrastBoost        float64         // 对比度增强, [0.0,2.0], 1.0为原始
+	HueShift             float64         // 色相旋转（度）, 0为原始
+	Brightness           float64         // 亮度系数, 0 = 1.0 (原始)
+	Gamma                float64         // 伽马校正, >1 提亮中间调, 0 = 1.0 (原始)
+	Quantizer            QuantizerMethod // color quantizer, defaults to NeuQuant
+	AutoGlobalPalette    bool            // build one global palette from all frames
+	OptimizeFrames       bool            // make pixels unchanged since the previous frame transparent
+	DitherStrength       *float64        // error diffusion factor [0,1], nil = default 1.0
+	GlobalPaletteColors  color.Palette   // optional global palette, overrides GlobalPalette
+	Grayscale            bool            // quantize to a 256-level gray ramp
+	Monochrome           *MonoOptions    // 1-bit black and white output
+	SharedPalette        bool            // train one palette over the first frames and reuse it
+	SharedPaletteFrames  int             // frames sampled by SharedPalette, 0 = 8
+	Parallelism          int             // frames encoded concurrently, 0 or 1 = serial, <0 = runtime.NumCPU()
+	OnProgress           ProgressFunc    // called after each frame is written
+	ResizeMode           ResizeMode      // scale frames of a different size to Width x Height
+	Letterbox            bool            // keep the aspect ratio when resizing, padding with black
+	DedupPalettes        bool            // skip local color tables equal to the global one
+	PerceptualMatch      bool            // match colors by CIE Lab distance instead of RGB
+	MinimalExtensions    bool            // leave out graphic control extensions holding only defaults
+	MatteColor           color.RGBA      // color translucent pixels are composited over, default black
+	AlphaThreshold       int             // pixels with a lower 8-bit alpha are transparent, 0 = off
+	LinearLightDither    bool            // diffuse dithering error in linear light instead of sRGB
+	CoalesceIdentical    bool            // merge runs of identical frames, adding up their delays
+	OnFrameStats         FrameStatsFunc  // called with the compression statistics of each frame
+	SortPalette          bool            // order color tables by frequency and set their sort flag
+	MaxColors            int             // palette size limit 2-256, 0 = 256
+	TrimBlankFrames      bool            // drop transparent or matte colored frames at both ends
+	ForceColors          []color.RGBA    // exact colors every built palette must contain
+	Deterministic        bool            // encode serially, identical inputs give identical bytes
+	Posterize            int             // levels per color channel before quantization, 0 = off
+	Version87a           bool            // write a still GIF87a of the first frame, no extensions
+	AdaptivePaletteSize  bool            // exact, smaller color tables for frames with few colors
 }
 
+// NewGIFEncoderWithOptions creates a new GIF encoder configured from opts.
+// A GlobalPaletteColors longer than 256 colors is ignored, use
+// EncodeGIFWithOptions to get an error for it.
 func NewGIFEncoderWithOptions(width, height int, opts EncodeOptions) *GIFEncoder {
 	encoder := NewGIFEncoder(width, height)
 
@@ -64,19 +107,80 @@ func NewGIFEncoderWithOptions(width, height int, opts EncodeOptions) *GIFEncoder
 		quality = 10 // default
 	}
 	encoder.SetQuality(quality)
+	if opts.AutoQuality && opts.Quality == 0 {
+		encoder.SetAutoQuality(true)
+	}
 
 	// Set dither
 	if opts.Dither != nil {
 		encoder.SetDither(opts.Dither)
 	}
+	if opts.DitherStrength != nil {
+		encoder.SetDitherStrength(*opts.DitherStrength)
+	}
+
+	// Set quantizer
+	if opts.Quantizer != "" {
+		encoder.SetQuantizerMethod(opts.Quantizer)
+	}
+
+	if opts.MaxColors != 0 {
+		encoder.SetMaxColors(opts.MaxColors)
+	}
+
+	if opts.ForceColors != nil {
+		encoder.SetForceColors(opts.ForceColors)
+	}
+
+	// Set grayscale
+	if opts.Grayscale {
+		encoder.SetGrayscale(256)
+	}
+
+	// Set monochrome
+	if opts.Monochrome != nil {
+		encoder.SetMonochrome(opts.Monochrome)
+	}
+
+	// Set shared palette
+	if opts.SharedPalette {
+		frames := opts.SharedPaletteFrames
+		if frames <= 0 {
+			frames = defaultSharedPaletteFrames
+		}
+		encoder.SetSharedPalette(frames)
+	}
+
+	// Set resizing
+	encoder.SetResizeMode(opts.ResizeMode, opts.Letterbox)
+
+	// Set frame optimization
+	encoder.SetOptimizeFrames(opts.OptimizeFrames)
+	encoder.SetDedupPalettes(opts.DedupPalettes)
+	encoder.SetPerceptualMatch(opts.PerceptualMatch)
+	encoder.SetLinearLightDither(opts.LinearLightDither)
+	encoder.SetSortPalette(opts.SortPalette)
+	encoder.SetAdaptivePaletteSize(opts.AdaptivePaletteSize)
+	encoder.SetMatteColor(opts.MatteColor)
+	encoder.SetAlphaThreshold(opts.AlphaThreshold)
+	encoder.SetMinDelay(opts.MinDelayCentiseconds)
+	encoder.SetMinimalExtensions(opts.MinimalExtensions)
+	encoder.SetVersion87a(opts.Version87a)
 
 	// Set color enhancement
-	opts.ContrastBoost = minFloat(2.0, maxFloat(1.0, opts.ContrastBoost))
-	opts.SaturationBoost = minFloat(2.0, maxFloat(1.0, opts.SaturationBoost))
-	encoder.SetColorEnhancement(opts.SaturationBoost, opts.ContrastBoost)
+	encoder.SetColorAdjust(ColorAdjust{
+		Saturation: minFloat(2.0, maxFloat(1.0, opts.SaturationBoost)),
+		Contrast:   minFloat(2.0, maxFloat(1.0, opts.ContrastBoost)),
+		Brightness: opts.Brightness,
+		Gamma:      opts.Gamma,
+	})
+	encoder.SetHueShift(opts.HueShift)
+	encoder.SetPosterize(opts.Posterize)
 
 	// Set global palette
-	if opts.GlobalPalette != nil {
+	if opts.GlobalPaletteColors != nil {
+		encoder.SetGlobalPaletteFromColors(opts.GlobalPaletteColors)
+	} else if opts.GlobalPalette != nil {
 		encoder.SetGlobalPalette(opts.GlobalPalette)
 	}
 	return encoder
@@ -84,64 +188,129 @@ func NewGIFEncoderWithOptions(width, height int, opts EncodeOptions) *GIFEncoder
 
 // EncodeGIFWithOptions encodes images with custom options
 func EncodeGIFWithOptions(images []image.Image, opts EncodeOptions) ([]byte, error) {
-	if len(images) == 0 {
-		return nil, errors.New("no images provided")
-	}
+	return EncodeGIFWithContext(context.Background(), images, opts)
+}
 
-	width := opts.Width
-	height := opts.Height
-	if width == 0 || height == 0 {
-		bounds := images[0].Bounds()
-		width = bounds.Dx()
-		height = bounds.Dy()
+// EncodeGIFWithContext encodes images with custom options and stops as soon
+// as ctx is cancelled, returning ctx.Err(). With opts.Deterministic the
+// frames are encoded one at a time in order, whatever opts.Parallelism
+// says, and the same images and options always give the same bytes.
+func EncodeGIFWithContext(ctx context.Context, images []image.Image, opts EncodeOptions) ([]byte, error) {
+	encoder, err := encodeImages(ctx, images, opts)
+	if err != nil {
+		return nil, err
 	}
+	data := encoder.GetData()
+	encoder.CleanupAll()
+	return data, nil
+}
 
-	encoder := NewGIFEncoder(width, height)
+// EncodeGIFToWriter encodes images with custom options and writes the GIF
+// to w. The encoded pages are written out as they are, without first
+// copying them into one slice as EncodeGIFWithOptions does, which halves
+// the peak memory for large outputs. Nothing is written when encoding fails.
+func EncodeGIFToWriter(w io.Writer, images []image.Image, opts EncodeOptions) error {
+	encoder, err := encodeImages(context.Background(), images, opts)
+	if err != nil {
+		return err
+	}
+	defer encoder.CleanupAll()
+	_, err = encoder.WriteTo(w)
+	return err
+}
 
-	// Set repeat
-	if opts.Repeat != 0 {
-		encoder.SetRepeat(opts.Repeat)
-	} else {
-		encoder.SetRepeat(0) // default to loop forever
+// encodeImages runs EncodeGIFWithContext up to the finished encoder, whose
+// output the caller takes and then releases with CleanupAll
+func encodeImages(ctx context.Context, images []image.Image, opts EncodeOptions) (*GIFEncoder, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, errors.New("no images provided")
 	}
 
-	// Set quality
-	quality := opts.Quality
-	if quality == 0 {
-		quality = 10 // default
+	// Frame delays
+	delays := make([]int, len(images))
+	for i := range images {
+		delays[i] = 100 // default 100ms
+		if opts.DelaysCentiseconds != nil {
+			// 厘秒乘以 10 换算成毫秒是精确的
+			if i < len(opts.DelaysCentiseconds) && opts.DelaysCentiseconds[i] > 0 {
+				delays[i] = opts.DelaysCentiseconds[i] * 10
+			}
+		} else if i < len(opts.Delays) && opts.Delays[i] > 0 {
+			delays[i] = opts.Delays[i]
+		}
+	}
+	if opts.TrimBlankFrames {
+		images, delays = trimBlankFrames(images, delays, opts.MatteColor)
+	}
+	if opts.CoalesceIdentical {
+		images, delays = coalesceIdentical(images, delays)
+	}
+	if opts.Version87a {
+		// GIF87a 不支持动画, 只保留第一帧
+		images, delays = images[:1], delays[:1]
+	}
+	if opts.MinimalExtensions && len(images) == 1 {
+		// a still image shows no delay, leave it out with its extension
+		delays[0] = 0
 	}
-	encoder.SetQuality(quality)
 
-	// Set dither
-	if opts.Dither != nil {
-		encoder.SetDither(opts.Dither)
+	encoder := encoderForImages(images, opts)
+	if opts.OnProgress != nil {
+		encoder.SetProgressCallback(len(images), opts.OnProgress)
 	}
+	encoder.SetFrameStatsCallback(opts.OnFrameStats)
 
-	// Set color enhancement
-	opts.ContrastBoost = minFloat(2.0, maxFloat(1.0, opts.ContrastBoost))
-	opts.SaturationBoost = minFloat(2.0, maxFloat(1.0, opts.SaturationBoost))
-	encoder.SetColorEnhancement(opts.SaturationBoost, opts.ContrastBoost)
+	// Add frames
+	workers := opts.Parallelism
+	if workers == 0 || opts.Deterministic {
+		// 串行处理, 保证逐字节可复现
+		workers = 1
+	}
+	if err := encoder.addFramesParallel(ctx, images, delays, workers); err != nil {
+		encoder.CleanupAll()
+		return nil, err
+	}
 
-	// Set global palette
-	if opts.GlobalPalette != nil {
-		encoder.SetGlobalPalette(opts.GlobalPalette)
+	if err := encoder.FinishContext(ctx); err != nil {
+		encoder.CleanupAll()
+		return nil, err
 	}
+	return encoder, nil
+}
 
-	// Add frames
-	for i, img := range images {
-		delay := 100 // default 100ms
-		if i < len(opts.Delays) && opts.Delays[i] > 0 {
-			delay = opts.Delays[i]
-		}
-		encoder.SetDelay(delay)
+// encoderForImages creates an encoder configured from opts, sized as
+// opts or else as the first image, and builds the automatic global palette
+// over images when it is requested
+func encoderForImages(images []image.Image, opts EncodeOptions) *GIFEncoder {
+	width := opts.Width
+	height := opts.Height
+	if width == 0 || height == 0 {
+		bounds := images[0].Bounds()
+		width = bounds.Dx()
+		height = bounds.Dy()
+	}
 
-		if err := encoder.AddFrame(img); err != nil {
-			return nil, err
-		}
+	encoder := NewGIFEncoderWithOptions(width, height, opts)
+	if opts.AutoGlobalPalette && opts.GlobalPalette == nil && opts.GlobalPaletteColors == nil {
+		encoder.BuildGlobalPalette(images)
 	}
+	return encoder
+}
 
-	encoder.Finish()
-	return encoder.GetData(), nil
+// colormapToPalette converts an RGB triplet table into a color.Palette.
+// The entry at transIndex, if valid, is made fully transparent.
+func colormapToPalette(colormap []byte, transIndex int) color.Palette {
+	palette := make(color.Palette, len(colormap)/3)
+	for i := range palette {
+		palette[i] = color.RGBA{colormap[i*3], colormap[i*3+1], colormap[i*3+2], 255}
+	}
+	if transIndex >= 0 && transIndex < len(palette) {
+		palette[transIndex] = color.RGBA{}
+	}
+	return palette
 }
 
 // 辅助函数
@@ -170,6 +339,39 @@ func minFloat(a ...float64) float64 {
 	}
 	return min
 }
+
+// rgbToHSL converts r, g, b in [0, 1] to hue, saturation and lightness in [0, 1]
+func rgbToHSL(r, g, b float64) (float64, float64, float64) {
+	max := maxFloat(r, g, b)
+	min := minFloat(r, g, b)
+	l := (max + min) / 2.0
+	if max == min {
+		return 0, 0, l
+	}
+
+	var h, s float64
+	d := max - min
+	if l > 0.5 {
+		s = d / (2.0 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+
+	// 计算色调
+	switch max {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6.0
+		}
+	case g:
+		h = (b-r)/d + 2.0
+	case b:
+		h = (r-g)/d + 4.0
+	}
+	return h / 6.0, s, l
+}
+
 func hslToRGB(h, s, l float64) (float64, float64, float64) {
 	var r, g, b float64
 
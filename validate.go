@@ -0,0 +1,140 @@
+package gifencoder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate reports the first option that is out of range or contradicts
+// another one. EncodeGIFWithOptions calls it before encoding anything.
+// Zero values mean the defaults and are always valid.
+func (opts EncodeOptions) Validate() error {
+	if opts.Width < 0 || opts.Width > 65535 || opts.Height < 0 || opts.Height > 65535 {
+		return fmt.Errorf("invalid size %dx%d, expected 1-65535 pixels in each direction", opts.Width, opts.Height)
+	}
+	if opts.Quality != 0 && (opts.Quality < 1 || opts.Quality > 30) {
+		return fmt.Errorf("invalid quality %d, expected 1-30", opts.Quality)
+	}
+	if opts.Repeat < -1 || opts.Repeat > 65535 {
+		return fmt.Errorf("invalid repeat %d, expected -1-65535", opts.Repeat)
+	}
+	for i, d := range opts.Delays {
+		if d < 0 {
+			return fmt.Errorf("negative delay %d for frame %d", d, i)
+		}
+	}
+	for i, d := range opts.DelaysCentiseconds {
+		if d < 0 || d > 65535 {
+			return fmt.Errorf("invalid delay %dcs for frame %d, expected 0-65535", d, i)
+		}
+	}
+	if opts.Delays != nil && opts.DelaysCentiseconds != nil {
+		return errors.New("Delays and DelaysCentiseconds can't be used together")
+	}
+	if opts.MinDelayCentiseconds < 0 {
+		return fmt.Errorf("negative minimum delay %d", opts.MinDelayCentiseconds)
+	}
+	if err := validateDither(opts.Dither); err != nil {
+		return err
+	}
+	if opts.LinearLightDither && !opts.diffusesError() {
+		return errors.New("LinearLightDither needs an error diffusion dither method")
+	}
+	if s := opts.DitherStrength; s != nil && (*s < 0 || *s > 1) {
+		return fmt.Errorf("invalid dither strength %g, expected [0,1]", *s)
+	}
+	switch opts.Quantizer {
+	case "", QuantizerNeuQuant, QuantizerMedianCut, QuantizerOctree, QuantizerPopularity, QuantizerWebSafe:
+	default:
+		return fmt.Errorf("unknown quantizer %q", opts.Quantizer)
+	}
+	if opts.MaxColors != 0 && (opts.MaxColors < 2 || opts.MaxColors > 256) {
+		return fmt.Errorf("invalid max colors %d, expected 2-256", opts.MaxColors)
+	}
+	maxColors := opts.MaxColors
+	if maxColors == 0 {
+		maxColors = 256
+	}
+	if len(opts.ForceColors) > maxColors {
+		return fmt.Errorf("%d forced colors don't fit in a palette of %d", len(opts.ForceColors), maxColors)
+	}
+	if opts.Gamma < 0 {
+		return fmt.Errorf("invalid gamma %g, expected a positive value", opts.Gamma)
+	}
+	if opts.Posterize != 0 && (opts.Posterize < 2 || opts.Posterize > 255) {
+		return fmt.Errorf("invalid posterize levels %d, expected 2-255", opts.Posterize)
+	}
+	if opts.AlphaThreshold < 0 || opts.AlphaThreshold > 256 {
+		return fmt.Errorf("invalid alpha threshold %d, expected 0-256", opts.AlphaThreshold)
+	}
+
+	// 调色板
+	if len(opts.GlobalPaletteColors) > 256 {
+		return fmt.Errorf("global palette has %d colors, at most 256 are allowed", len(opts.GlobalPaletteColors))
+	}
+	if len(opts.GlobalPalette)%3 != 0 || len(opts.GlobalPalette) > 256*3 {
+		return fmt.Errorf("global palette has %d bytes, expected RGB triplets for at most 256 colors", len(opts.GlobalPalette))
+	}
+	global := opts.GlobalPalette != nil || opts.GlobalPaletteColors != nil
+	if global && opts.AutoGlobalPalette {
+		return errors.New("GlobalPalette and AutoGlobalPalette can't be used together")
+	}
+	if opts.SharedPalette && (global || opts.AutoGlobalPalette) {
+		return errors.New("SharedPalette can't be used with a global palette")
+	}
+	if opts.AdaptivePaletteSize && (global || opts.AutoGlobalPalette || opts.SharedPalette) {
+		return errors.New("AdaptivePaletteSize sizes per-frame palettes and can't be used with a global or shared palette")
+	}
+	if opts.Grayscale && opts.Monochrome != nil {
+		return errors.New("Grayscale and Monochrome can't be used together")
+	}
+	if (opts.Grayscale || opts.Monochrome != nil) && (global || opts.AutoGlobalPalette || opts.SharedPalette) {
+		return errors.New("Grayscale and Monochrome use their own palette, a global or shared palette can't be set")
+	}
+	if opts.Version87a && opts.AlphaThreshold > 0 {
+		return errors.New("GIF87a has no transparency, AlphaThreshold can't be used with Version87a")
+	}
+	return nil
+}
+
+// diffusesError reports whether opts select an error diffusion dither
+// method, Monochrome replaces Dither with its own setting
+func (opts EncodeOptions) diffusesError() bool {
+	if opts.Monochrome != nil {
+		return opts.Monochrome.Dither
+	}
+	var method DitherMethod
+	switch v := opts.Dither.(type) {
+	case bool:
+		if v {
+			method = DitherFloydSteinberg
+		}
+	case string:
+		name, _ := cutSerpentine(strings.TrimSpace(v))
+		method, _ = parseDitherName(name)
+	case DitherMethod:
+		method = v
+	}
+	return method != "" && method != DitherNone && orderedMatrixSize(method) == 0
+}
+
+// validateDither checks a dithering method given as EncodeOptions.Dither
+func validateDither(method interface{}) error {
+	switch v := method.(type) {
+	case nil, bool:
+		return nil
+	case string:
+		name, _ := cutSerpentine(strings.TrimSpace(v))
+		if _, ok := parseDitherName(name); !ok {
+			return fmt.Errorf("unknown dither method %q", v)
+		}
+	case DitherMethod:
+		if !isBuiltinDither(v) {
+			return fmt.Errorf("unknown dither method %q", v)
+		}
+	default:
+		return fmt.Errorf("invalid dither method of type %T, expected bool, string or DitherMethod", method)
+	}
+	return nil
+}
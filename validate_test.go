@@ -0,0 +1,66 @@
+package gifencoder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeOptionsValidate(t *testing.T) {
+	valid := []EncodeOptions{
+		{},
+		{Width: 320, Height: 240, Quality: 30, Repeat: -1, Delays: []int{0, 100}},
+		{Dither: true},
+		{Dither: "fs-serpentine"},
+		{Dither: DitherOrdered4x4, DitherStrength: floatPtr(0.5)},
+		{Dither: true, DitherStrength: floatPtr(0)},
+		{Quantizer: QuantizerOctree, AutoGlobalPalette: true},
+		{GlobalPaletteColors: color.Palette{color.Black, color.White}},
+		{GlobalPalette: []byte{0, 0, 0, 255, 255, 255}},
+		{Grayscale: true},
+		{Dither: "sierra-lite", LinearLightDither: true},
+		{Monochrome: &MonoOptions{Dither: true}, LinearLightDither: true},
+		{SharedPalette: true, SharedPaletteFrames: 4},
+	}
+	for i, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("valid options %d: %v", i, err)
+		}
+	}
+
+	invalid := map[string]EncodeOptions{
+		"negative width":       {Width: -1, Height: 10},
+		"height too large":     {Width: 10, Height: 70000},
+		"quality too low":      {Quality: -3},
+		"quality too high":     {Quality: 31},
+		"repeat":               {Repeat: -2},
+		"negative delay":       {Delays: []int{100, -10}},
+		"negative min delay":   {MinDelayCentiseconds: -1},
+		"unknown dither":       {Dither: "Sparkle"},
+		"unknown dither const": {Dither: DitherMethod("Sparkle")},
+		"dither type":          {Dither: 3},
+		"dither strength":      {DitherStrength: floatPtr(1.5)},
+		"negative strength":    {DitherStrength: floatPtr(-0.5)},
+		"unknown quantizer":    {Quantizer: "KMeans"},
+		"linear, no dither":    {LinearLightDither: true},
+		"linear, ordered":      {Dither: DitherOrdered4x4, LinearLightDither: true},
+		"alpha threshold":      {AlphaThreshold: 300},
+		"large palette":        {GlobalPaletteColors: make(color.Palette, 257)},
+		"palette bytes":        {GlobalPalette: []byte{1, 2, 3, 4}},
+		"global and auto":      {GlobalPaletteColors: color.Palette{color.Black}, AutoGlobalPalette: true},
+		"shared and global":    {GlobalPalette: []byte{0, 0, 0}, SharedPalette: true},
+		"shared and auto":      {SharedPalette: true, AutoGlobalPalette: true},
+		"grayscale and mono":   {Grayscale: true, Monochrome: &MonoOptions{}},
+		"grayscale and global": {Grayscale: true, GlobalPaletteColors: color.Palette{color.Black}},
+	}
+	for name, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	img := createStripeImage(4, 4, []color.RGBA{{255, 0, 0, 255}})
+	if _, err := EncodeGIFWithOptions([]image.Image{img}, invalid["negative delay"]); err == nil {
+		t.Error("expected EncodeGIFWithOptions to validate its options")
+	}
+}
@@ -0,0 +1,63 @@
+package gifencoder
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SetXMP embeds an XMP metadata packet, such as attribution or rights,
+// in an "XMP DataXMP" application extension written after the header.
+// The packet must be well-formed XML in UTF-8 without NUL bytes, since
+// readers that don't know XMP walk over it as data sub-blocks. An empty
+// string removes the packet.
+func (ge *GIFEncoder) SetXMP(packet string) error {
+	if packet == "" {
+		ge.xmp = ""
+		return nil
+	}
+	if strings.TrimSpace(packet) == "" {
+		return errors.New("xmp packet is blank")
+	}
+	if !utf8.ValidString(packet) {
+		return errors.New("xmp packet is not valid UTF-8")
+	}
+	if strings.IndexByte(packet, 0) >= 0 {
+		return errors.New("xmp packet contains a NUL byte")
+	}
+
+	d := xml.NewDecoder(strings.NewReader(packet))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("xmp packet is not well-formed: %w", err)
+		}
+	}
+
+	ge.xmp = packet
+	return nil
+}
+
+// writeXMPExt writes the XMP application extension. The packet is stored
+// as is, followed by a 257 byte "magic trailer" counting down from 0xff to
+// 0x00 so that a reader skipping sub-blocks lands on the block terminator
+// whatever length byte it starts from.
+func (ge *GIFEncoder) writeXMPExt() {
+	ge.out.WriteByte(0x21)              // extension introducer
+	ge.out.WriteByte(0xff)              // app extension label
+	ge.out.WriteByte(11)                // block size
+	ge.out.WriteUTFBytes("XMP DataXMP") // app id + auth code
+	ge.out.WriteUTFBytes(ge.xmp)
+
+	ge.out.WriteByte(1)
+	for i := 0xff; i >= 0; i-- {
+		ge.out.WriteByte(byte(i))
+	}
+	ge.out.WriteByte(0) // block terminator
+}
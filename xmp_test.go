@@ -0,0 +1,54 @@
+package gifencoder
+
+import (
+	"bytes"
+	"image/gif"
+	"testing"
+)
+
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+	`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" dc:creator="nicogif"/>` +
+	`</rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+func TestSetXMP(t *testing.T) {
+	encoder := NewGIFEncoder(16, 16)
+	if err := encoder.SetXMP(testXMP); err != nil {
+		t.Fatalf("SetXMP failed: %v", err)
+	}
+	for _, frame := range movingSquareFrames(2, 16) {
+		if err := encoder.AddFrame(frame); err != nil {
+			t.Fatalf("AddFrame failed: %v", err)
+		}
+	}
+	encoder.Finish()
+	data := encoder.GetData()
+
+	// 257 byte magic trailer, then the block terminator
+	trailer := []byte{1}
+	for i := 0xff; i >= 0; i-- {
+		trailer = append(trailer, byte(i))
+	}
+	want := append([]byte("XMP DataXMP"+testXMP), append(trailer, 0)...)
+	if !bytes.Contains(data, want) {
+		t.Error("Expected the XMP packet followed by the magic trailer")
+	}
+
+	s := parseGIFStructure(t, data)
+	found := false
+	for _, app := range s.AppExtensions {
+		found = found || app == "XMP DataXMP"
+	}
+	if !found || len(s.Frames) != 2 {
+		t.Errorf("Expected an XMP extension and 2 frames, got %v and %d frames", s.AppExtensions, len(s.Frames))
+	}
+	if g, err := gif.DecodeAll(bytes.NewReader(data)); err != nil || len(g.Image) != 2 {
+		t.Errorf("image/gif failed to read the GIF: %v", err)
+	}
+
+	for _, bad := range []string{" \n", "<a><b></a>", "<a>\x00</a>", "<a>\xff</a>"} {
+		if err := encoder.SetXMP(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}